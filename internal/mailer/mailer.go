@@ -0,0 +1,167 @@
+// Package mailer sends one message in one SMTP transaction. It is the single
+// SMTP path behind the bridge and decorator examples: it dials with the
+// caller's context, gives up after DefaultTimeout when the context has no
+// deadline, and encodes the subject so no header can be injected through it.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a whole transaction whose context has no deadline
+const DefaultTimeout = 30 * time.Second
+
+var ErrNoRecipients = errors.New("smtp: no recipient accepted")
+
+// Message is what gets mailed. HTML, when set, is sent next to Text as
+// multipart/alternative.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Error is a failed step of the transaction
+type Error struct {
+	Step string
+	// Recipient is set when the server refused this one mailbox
+	Recipient string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	if e.Recipient != "" {
+		return fmt.Sprintf("smtp: %s %s: %v", e.Step, e.Recipient, e.Err)
+	}
+	return fmt.Sprintf("smtp: %s: %v", e.Step, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Permanent reports a 5xx reply, which trying again will not change. A 4xx
+// refusal of one mailbox is not permanent, but when Send returns it next to
+// no ErrNoRecipients the others already have the message, so sending it all
+// again would mail them twice.
+func (e *Error) Permanent() bool {
+	var tp *textproto.Error
+	return errors.As(e.Err, &tp) && tp.Code >= 500
+}
+
+// Send mails msg through the server at addr, authenticating with auth when
+// it is set and the server offers AUTH. A refused mailbox does not stop
+// delivery to the others: the refusals are returned, joined, after the
+// message went to the rest. If every mailbox is refused ErrNoRecipients is
+// joined to them.
+func Send(ctx context.Context, addr string, auth smtp.Auth, msg Message) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return &Error{Step: "dial", Err: err}
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return &Error{Step: "greeting", Err: err}
+	}
+	defer client.Close()
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(auth); err != nil {
+				return &Error{Step: "auth", Err: err}
+			}
+		}
+	}
+	// net/smtp refuses addresses with line breaks, so they cannot reach the
+	// headers either
+	if err := client.Mail(msg.From); err != nil {
+		return &Error{Step: "MAIL FROM", Err: err}
+	}
+
+	var refused []error
+	accepted := 0
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			refused = append(refused, &Error{Step: "RCPT TO", Recipient: to, Err: err})
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		return errors.Join(append(refused, ErrNoRecipients)...)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return &Error{Step: "DATA", Err: err}
+	}
+	if err := writeMessage(w, msg); err != nil {
+		return &Error{Step: "DATA", Err: err}
+	}
+	if err := w.Close(); err != nil {
+		return &Error{Step: "DATA", Err: err}
+	}
+	if err := client.Quit(); err != nil {
+		return &Error{Step: "QUIT", Err: err}
+	}
+	return errors.Join(refused...)
+}
+
+// writeMessage writes the headers and body of msg
+func writeMessage(w io.Writer, msg Message) error {
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		msg.From, strings.Join(msg.To, ", "), mime.QEncoding.Encode("utf-8", msg.Subject), time.Now().Format(time.RFC1123Z))
+	if msg.HTML == "" {
+		_, err := io.WriteString(w, header+"Content-Type: text/plain; charset=utf-8\r\n\r\n"+crlf(msg.Text)+"\r\n")
+		return err
+	}
+
+	mw := multipart.NewWriter(w)
+	header += "Content-Type: multipart/alternative; boundary=" + mw.Boundary() + "\r\n\r\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	parts := []struct{ contentType, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}}
+	for _, part := range parts {
+		if part.body == "" {
+			continue
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + "; charset=utf-8"}})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, crlf(part.body)); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// crlf turns every line ending into CRLF, as SMTP requires
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
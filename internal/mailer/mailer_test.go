@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+func startStub(t *testing.T) *smtpstub.Server {
+	t.Helper()
+	server, err := smtpstub.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestSendSubjectCannotInjectHeaders(t *testing.T) {
+	server := startStub(t)
+	msg := Message{
+		From:    "alerts@example.com",
+		To:      []string{"ops@example.com"},
+		Subject: "[CRITICAL] db\r\nBcc: attacker@example.com\r\n\r\nforged body",
+		Text:    "real body",
+	}
+	if err := Send(context.Background(), server.Addr(), nil, msg); err != nil {
+		t.Fatal(err)
+	}
+	got := server.Messages()
+	if len(got) != 1 {
+		t.Fatalf("server accepted %d messages; want 1", len(got))
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(got[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("decoded subject = %q, %v; want %q", subject, err, msg.Subject)
+	}
+}
+
+func TestSendRefusedRecipients(t *testing.T) {
+	server := startStub(t)
+	server.Reject = func(rcpt string) bool { return strings.HasPrefix(rcpt, "gone") }
+	ctx := context.Background()
+
+	err := Send(ctx, server.Addr(), nil, Message{From: "a@example.com", To: []string{"ops@example.com", "gone@example.com"}, Text: "hi"})
+	var me *Error
+	if !errors.As(err, &me) || me.Recipient != "gone@example.com" || !me.Permanent() {
+		t.Fatalf("error = %v; want a permanent refusal of gone@example.com", err)
+	}
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("server accepted %d messages; want the one to ops", n)
+	}
+
+	err = Send(ctx, server.Addr(), nil, Message{From: "a@example.com", To: []string{"gone@example.com"}, Text: "hi"})
+	if !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("every mailbox refused: error = %v; want ErrNoRecipients", err)
+	}
+}
+
+func TestSendMultipart(t *testing.T) {
+	server := startStub(t)
+	msg := Message{From: "a@example.com", To: []string{"ops@example.com"}, Subject: "Déploiement", Text: "plain\nline", HTML: "<p>html</p>"}
+	if err := Send(context.Background(), server.Addr(), nil, msg); err != nil {
+		t.Fatal(err)
+	}
+	data := server.Messages()[0].Data
+	for _, want := range []string{"multipart/alternative", "text/plain; charset=utf-8", "text/html; charset=utf-8", "plain\r\nline", "<p>html</p>", "=?utf-8?q?"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message lacks %q:\n%s", want, data)
+		}
+	}
+}
+
+// A server that accepts the connection and never says a word must not hang Send
+func TestSendHonoursContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = Send(ctx, l.Addr().String(), nil, Message{From: "a@example.com", To: []string{"b@example.com"}})
+	if err == nil {
+		t.Fatal("Send to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v after the context expired", elapsed)
+	}
+}
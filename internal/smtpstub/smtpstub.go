@@ -0,0 +1,182 @@
+// Package smtpstub is a minimal local SMTP server that stands in for a real
+// mail server in the examples. It accepts plain-text sessions without
+// authentication or TLS and keeps every accepted message in memory.
+package smtpstub
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Message is one accepted mail transaction
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Server is a running SMTP stand-in
+type Server struct {
+	// Reject, when set, refuses RCPT TO for the recipients it returns true for
+	Reject func(recipient string) bool
+	// Defer, when set, refuses RCPT TO for now (a 4xx reply) for the
+	// recipients it returns true for
+	Defer func(recipient string) bool
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Start listens on a free local port and serves until Close
+func Start() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: l, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the host:port to dial
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Messages returns a copy of every message accepted so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops listening, drops every open session and waits for them to end
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(line string) {
+		w.WriteString(line + "\r\n")
+		w.Flush()
+	}
+
+	reply("220 smtpstub ready")
+	var msg Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "HELO", "EHLO":
+			reply("250 smtpstub")
+		case "MAIL":
+			msg = Message{From: address(arg)}
+			reply("250 OK")
+		case "RCPT":
+			rcpt := address(arg)
+			if s.Reject != nil && s.Reject(rcpt) {
+				reply("550 mailbox unavailable")
+				continue
+			}
+			if s.Defer != nil && s.Defer(rcpt) {
+				reply("450 mailbox busy, try again later")
+				continue
+			}
+			msg.To = append(msg.To, rcpt)
+			reply("250 OK")
+		case "DATA":
+			if len(msg.To) == 0 {
+				reply("503 no valid recipients")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				// Undo dot-stuffing
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = Message{}
+			reply("250 OK queued")
+		case "RSET":
+			msg = Message{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// address extracts the mailbox from "FROM:<a@b>" or "TO:<a@b>"
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr = strings.TrimSpace(addr)
+	if i := strings.IndexByte(addr, ' '); i >= 0 {
+		addr = addr[:i] // drop ESMTP parameters
+	}
+	return strings.Trim(addr, "<>")
+}
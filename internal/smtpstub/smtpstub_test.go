@@ -0,0 +1,35 @@
+package smtpstub
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// Close must not wait for a client that keeps its session open
+func TestCloseDropsOpenSessions(t *testing.T) {
+	s, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Wait for the greeting so the session is running
+	if _, err := conn.Read(make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on an open session")
+	}
+}
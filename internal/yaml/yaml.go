@@ -0,0 +1,483 @@
+// Package yaml reads and quotes the subset of YAML the examples need. The
+// standard library has no YAML package, so this covers nested block
+// mappings and sequences (including "- key: value" items), plain, single-
+// and double-quoted scalars, flow sequences of scalars, "{}" and "[]", and
+// comments. Anchors, tags, multi-line scalars and multiple documents are
+// not supported. Double-quoted scalars use YAML's escapes, which are not
+// Go's.
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind tells what a Node holds
+type Kind int
+
+const (
+	ScalarNode Kind = iota
+	MappingNode
+	SequenceNode
+)
+
+// Node is one parsed value and where it starts
+type Node struct {
+	Kind   Kind
+	Line   int // 1-based
+	Column int // 1-based
+	// Value is a scalar's text with quotes and escapes resolved; a plain
+	// scalar with no text is null
+	Value string
+	// Quoted scalars are always strings, whatever their text
+	Quoted bool
+	Pairs  []Pair  // MappingNode entries in document order
+	Items  []*Node // SequenceNode items
+}
+
+// Pair is one mapping entry
+type Pair struct {
+	Key    string
+	Line   int
+	Column int
+	Value  *Node
+}
+
+// SyntaxError reports input outside the supported subset
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("yaml: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+type line struct {
+	num    int // 1-based line number
+	indent int
+	text   string
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// Parse reads one document. An empty document gives a nil Node.
+func Parse(data []byte) (*Node, error) {
+	p := &parser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		text := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(text)
+		if strings.HasPrefix(text, "\t") {
+			return nil, &SyntaxError{Line: i + 1, Column: indent + 1, Msg: "tabs are not allowed for indentation"}
+		}
+		if text == "" || text[0] == '#' || text == "---" {
+			continue
+		}
+		p.lines = append(p.lines, line{num: i + 1, indent: indent, text: text})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	n, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos], 0, "unexpected indentation")
+	}
+	return n, nil
+}
+
+func (p *parser) errorf(l line, offset int, format string, args ...any) error {
+	return &SyntaxError{Line: l.num, Column: l.indent + offset + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// block parses the mapping or sequence whose lines start at indent
+func (p *parser) block(indent int) (*Node, error) {
+	if isItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// isEmpty reports whether the rest of a line holds no value
+func isEmpty(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || rest[0] == '#'
+}
+
+func (p *parser) sequence(indent int) (*Node, error) {
+	start := p.lines[p.pos]
+	seq := &Node{Kind: SequenceNode, Line: start.num, Column: indent + 1, Items: []*Node{}}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || !isItem(l.text) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, 0, "unexpected indentation")
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		offset := len(l.text) - len(rest)
+		var item *Node
+		var err error
+		switch {
+		case isEmpty(rest):
+			p.pos++
+			item, err = p.nested(l, indent, offset)
+		case isItem(rest) || isEntry(rest):
+			// The item is a block starting on the same line as the dash;
+			// continue it as if it had been written on its own line
+			p.lines[p.pos] = line{num: l.num, indent: l.indent + offset, text: rest}
+			item, err = p.block(l.indent + offset)
+		default:
+			item, err = p.scalar(l, offset, rest)
+			p.pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq.Items = append(seq.Items, item)
+	}
+	return seq, nil
+}
+
+// nested parses the value of a "key:" or "-" with nothing after it on
+// line l: a deeper block, or null
+func (p *parser) nested(l line, indent, offset int) (*Node, error) {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return p.block(p.lines[p.pos].indent)
+	}
+	return &Node{Kind: ScalarNode, Line: l.num, Column: l.indent + offset + 1}, nil
+}
+
+// isEntry reports whether text starts with a key followed by ":"
+func isEntry(text string) bool {
+	_, _, ok := splitKey(text)
+	return ok
+}
+
+// splitKey splits "key: value" or "key:"; keys may be quoted
+func splitKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.ContainsRune("[{#", rune(text[0])) {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		key, after, err := unquote(text)
+		if err != nil || !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+			return "", "", false
+		}
+		return key, after[1:], true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	return text[:i], text[i+1:], true
+}
+
+func (p *parser) mapping(indent int) (*Node, error) {
+	start := p.lines[p.pos]
+	m := &Node{Kind: MappingNode, Line: start.num, Column: indent + 1, Pairs: []Pair{}}
+	seen := map[string]bool{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, 0, "unexpected indentation")
+		}
+		if isItem(l.text) {
+			break
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, p.errorf(l, 0, "expected \"key: value\", found %q", l.text)
+		}
+		if seen[key] {
+			return nil, p.errorf(l, 0, "duplicate key %q", key)
+		}
+		seen[key] = true
+		p.pos++
+
+		value := strings.TrimLeft(rest, " ")
+		offset := len(l.text) - len(value)
+		var v *Node
+		var err error
+		switch {
+		case !isEmpty(value):
+			v, err = p.scalar(l, offset, value)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isItem(p.lines[p.pos].text):
+			// "key:" followed by a sequence at the same indent is allowed
+			v, err = p.sequence(indent)
+		default:
+			v, err = p.nested(l, indent, offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.Pairs = append(m.Pairs, Pair{Key: key, Line: l.num, Column: indent + 1, Value: v})
+	}
+	return m, nil
+}
+
+// scalar parses s, a value written on one line at offset within l
+func (p *parser) scalar(l line, offset int, s string) (*Node, error) {
+	n := &Node{Kind: ScalarNode, Line: l.num, Column: l.indent + offset + 1}
+	switch s[0] {
+	case '"', '\'':
+		v, rest, err := unquote(s)
+		if err != nil {
+			return nil, p.errorf(l, offset, "%v", err)
+		}
+		if !isEmpty(rest) || (rest != "" && rest[0] != ' ') {
+			return nil, p.errorf(l, offset, "unexpected %q after a quoted string", rest)
+		}
+		n.Value, n.Quoted = v, true
+		return n, nil
+	case '{':
+		if !isEmpty(strings.TrimPrefix(s, "{}")) || !strings.HasPrefix(s, "{}") {
+			return nil, p.errorf(l, offset, "flow mappings are not supported")
+		}
+		n.Kind, n.Pairs = MappingNode, []Pair{}
+		return n, nil
+	case '[':
+		return p.flow(l, offset, s)
+	case '|', '>', '&', '*', '!', '%', '@', '`':
+		return nil, p.errorf(l, offset, "%q starts a feature that is not supported", s[0])
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	n.Value = strings.TrimSpace(s)
+	return n, nil
+}
+
+// flow parses a flow sequence of scalars such as [a, "b, c"]
+func (p *parser) flow(l line, offset int, s string) (*Node, error) {
+	seq := &Node{Kind: SequenceNode, Line: l.num, Column: l.indent + offset + 1, Items: []*Node{}}
+	i := 1
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			return nil, p.errorf(l, offset, "unterminated flow sequence")
+		}
+		if s[i] == ']' {
+			if rest := s[i+1:]; !isEmpty(rest) || (rest != "" && rest[0] != ' ') {
+				return nil, p.errorf(l, offset+i+1, "unexpected %q after a flow sequence", rest)
+			}
+			return seq, nil
+		}
+		if s[i] == '[' || s[i] == '{' {
+			return nil, p.errorf(l, offset+i, "nested flow collections are not supported")
+		}
+		if s[i] == ',' {
+			return nil, p.errorf(l, offset+i, "empty flow sequence item")
+		}
+
+		var item *Node
+		if s[i] == '"' || s[i] == '\'' {
+			v, rest, err := unquote(s[i:])
+			if err != nil {
+				return nil, p.errorf(l, offset+i, "%v", err)
+			}
+			item = &Node{Kind: ScalarNode, Line: l.num, Column: l.indent + offset + i + 1, Value: v, Quoted: true}
+			i = len(s) - len(rest)
+		} else {
+			end := i + strings.IndexAny(s[i:]+",", ",]")
+			item = &Node{Kind: ScalarNode, Line: l.num, Column: l.indent + offset + i + 1, Value: strings.TrimSpace(s[i:end])}
+			i = end
+		}
+		seq.Items = append(seq.Items, item)
+
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i < len(s) && s[i] == ',' {
+			i++
+		} else if i < len(s) && s[i] != ']' {
+			return nil, p.errorf(l, offset+i, "expected , or ] in a flow sequence")
+		}
+	}
+}
+
+// unquote reads the single- or double-quoted scalar at the start of s and
+// returns its value and whatever follows the closing quote
+func unquote(s string) (value, rest string, err error) {
+	var b strings.Builder
+	if s[0] == '\'' {
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), s[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unterminated single-quoted string %s", s)
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated double-quoted string %s", s)
+			}
+			i++
+			if r, ok := escapes[s[i]]; ok {
+				b.WriteRune(r)
+				continue
+			}
+			digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if digits == 0 {
+				return "", "", fmt.Errorf("unknown escape \\%c", s[i])
+			}
+			if i+digits >= len(s) {
+				return "", "", fmt.Errorf("short escape \\%s", s[i:])
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", "", fmt.Errorf("bad escape \\%s", s[i:i+1+digits])
+			}
+			b.WriteRune(rune(code))
+			i += digits
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated double-quoted string %s", s)
+}
+
+// escapes are YAML's single-character escapes; \x, \u and \U take a code
+// point in hex
+var escapes = map[byte]rune{
+	'0': 0, 'a': '\a', 'b': '\b', 't': '\t', '\t': '\t', 'n': '\n', 'v': '\v', 'f': '\f',
+	'r': '\r', 'e': 0x1b, ' ': ' ', '"': '"', '/': '/', '\\': '\\',
+	'N': 0x85, '_': 0xa0, 'L': 0x2028, 'P': 0x2029,
+}
+
+// Interface converts n into the types encoding/json produces:
+// map[string]any, []any, string, float64, bool or nil
+func (n *Node) Interface() any {
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case MappingNode:
+		m := make(map[string]any, len(n.Pairs))
+		for _, pair := range n.Pairs {
+			m[pair.Key] = pair.Value.Interface()
+		}
+		return m
+	case SequenceNode:
+		items := make([]any, len(n.Items))
+		for i, item := range n.Items {
+			items[i] = item.Interface()
+		}
+		return items
+	}
+	s := n.Value
+	if n.Quoted {
+		return s
+	}
+	switch s {
+	case "", "null", "Null", "NULL", "~":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strings.ContainsAny(s[:1], "0123456789+-.") && !strings.ContainsAny(s, "_xXbBoOnN") {
+		return f
+	}
+	return s
+}
+
+// Quote returns s as a scalar that reads back as the same string: plain
+// when that is unambiguous, double-quoted otherwise. Invalid UTF-8 cannot
+// be written in YAML and becomes U+FFFD.
+func Quote(s string) string {
+	if isPlain(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			switch {
+			case unicode.IsPrint(r):
+				b.WriteRune(r)
+			case r <= 0xffff:
+				fmt.Fprintf(&b, `\u%04X`, r)
+			default:
+				fmt.Fprintf(&b, `\U%08X`, r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isPlain reports whether s can be written without quotes and still read
+// back as the same string
+func isPlain(s string) bool {
+	if s == "" || !utf8.ValidString(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` ") ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return false
+	}
+	for _, r := range s {
+		if r == '\\' || r == '"' || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", ".inf", ".nan":
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return false
+	}
+	return true
+}
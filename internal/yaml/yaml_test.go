@@ -0,0 +1,144 @@
+package yaml
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterface(t *testing.T) {
+	doc := `
+# a comment
+name: "pager" # trailing comment
+it's: it's plain
+empty:
+flags: [a, "b, c", 'd''e', 3]
+none: {}
+items:
+- plain
+- 1.5
+- "true"
+- true
+- ~
+- key: value
+  other: 2
+nested:
+  list:
+    - - deep
+`
+	n, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"name":  "pager",
+		"it's":  "it's plain",
+		"empty": nil,
+		"flags": []any{"a", "b, c", "d'e", 3.0},
+		"none":  map[string]any{},
+		"items": []any{"plain", 1.5, "true", true, nil, map[string]any{"key": "value", "other": 2.0}},
+		"nested": map[string]any{
+			"list": []any{[]any{"deep"}},
+		},
+	}
+	if got := n.Interface(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %#v\nwant %#v", got, want)
+	}
+	if n.Pairs[0].Key != "name" || n.Pairs[0].Line != 3 || n.Pairs[0].Value.Column != 7 {
+		t.Errorf("first pair at %d:%d", n.Pairs[0].Line, n.Pairs[0].Value.Column)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]struct {
+		doc          string
+		line, column int
+	}{
+		"tab":                {"a:\n\tb: c\n", 2, 1},
+		"duplicate key":      {"a: 1\na: 2\n", 2, 1},
+		"bad indentation":    {"a: 1\n  b: 2\n", 2, 3},
+		"not a key":          {"a: 1\njust text\n", 2, 1},
+		"unterminated":       {"a: \"open\n", 1, 4},
+		"text after quotes":  {"a: \"x\" y\n", 1, 4},
+		"go escape":          {"a: \"\\101\"\n", 1, 4},
+		"flow mapping":       {"a: {b: c}\n", 1, 4},
+		"nested flow":        {"a: [[b]]\n", 1, 5},
+		"block scalar":       {"a: |\n  text\n", 1, 4},
+		"anchor":             {"a: &x 1\n", 1, 4},
+		"unterminated flow":  {"a: [b, c\n", 1, 4},
+		"after flow":         {"a: [b] c\n", 1, 7},
+		"sequence indent":    {"- a\n  - b\n", 2, 3},
+		"surrogate escape":   {"a: \"\\uD800\"\n", 1, 4},
+		"short escape":       {"a: \"\\u12\"\n", 1, 4},
+		"single unterminate": {"a: 'x\n", 1, 4},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc))
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("error = %v; want a *SyntaxError", err)
+			}
+			if se.Line != tt.line || se.Column != tt.column {
+				t.Errorf("error at %d:%d (%v); want %d:%d", se.Line, se.Column, err, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestEmptyDocument(t *testing.T) {
+	n, err := Parse([]byte("# only a comment\n---\n"))
+	if n != nil || err != nil {
+		t.Errorf("Parse = %v, %v; want nil, nil", n, err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	plain := []string{"prod", "a b", "it's", "x:y", "ünïcødé", "a#b", "v1.2.3"}
+	quoted := []string{
+		"", " lead", "trail ", "-dash", "true", "No", "null", "~", "12", "1e3", "0x1F", ".inf",
+		"a: b", "a #b", "end:", `back\slash`, `"`, "tab\t", "nl\n", "\x00", "\x1b", "\u2028", "#", "[x]", "{x}", "*ref", "&anchor", "!tag", "|", ">",
+	}
+	for _, s := range plain {
+		if got := Quote(s); got != s {
+			t.Errorf("Quote(%q) = %s; want it plain", s, got)
+		}
+	}
+	for _, s := range quoted {
+		if got := Quote(s); !strings.HasPrefix(got, `"`) {
+			t.Errorf("Quote(%q) = %s; want it quoted", s, got)
+		}
+	}
+	for _, s := range append(plain, quoted...) {
+		n, err := Parse([]byte("k: " + Quote(s) + "\n"))
+		if err != nil {
+			t.Errorf("Quote(%q) = %s does not parse: %v", s, Quote(s), err)
+			continue
+		}
+		if got := n.Pairs[0].Value.Value; got != s {
+			t.Errorf("Quote(%q) = %s reads back as %q", s, Quote(s), got)
+		}
+	}
+	if got := Quote("bad \xff"); got != "\"bad \uFFFD\"" {
+		t.Errorf("invalid UTF-8 quoted as %s", got)
+	}
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, s := range []string{"plain", "a: b", "\"\\", "\t\n\x00", "ü", "- x"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.ToValidUTF8(s, "\uFFFD") != s {
+			return
+		}
+		n, err := Parse([]byte("k: " + Quote(s) + "\n"))
+		if err != nil {
+			t.Fatalf("Quote(%q) = %s does not parse: %v", s, Quote(s), err)
+		}
+		if got := n.Pairs[0].Value.Value; got != s {
+			t.Fatalf("Quote(%q) = %s reads back as %q", s, Quote(s), got)
+		}
+	})
+}
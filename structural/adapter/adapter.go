@@ -27,6 +27,11 @@ type Target interface {
 	Request() string
 }
 
+// SpecificRequester is the interface the existing code already exposes
+type SpecificRequester interface {
+	SpecificRequest() string
+}
+
 // Adaptee is an existing class with a different interface
 type Adaptee struct{}
 
@@ -36,16 +41,25 @@ func (a *Adaptee) SpecificRequest() string {
 
 // Adapter makes Adaptee compatible with Target
 type Adapter struct {
-	adaptee *Adaptee
+	adaptee SpecificRequester
 }
 
 func (a *Adapter) Request() string {
 	return a.adaptee.SpecificRequest()
 }
 
+func (a *Adapter) Unwrap() any {
+	return a.adaptee
+}
+
 // Usage
 func ExecuteAdapterPattern() {
 	adaptee := &Adaptee{}
 	adapter := &Adapter{adaptee}
 	fmt.Println(adapter.Request())
+
+	ExecuteLegacyXMLAdapter()
+	ExecutePaymentAdapters()
+	ExecuteLoggerAdapters()
+	ExecuteTwoWayAdapter()
 }
@@ -0,0 +1,334 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+/*
+Legacy XML service -> modern JSON API
+
+The legacy customer service speaks XML over HTTP: every call is a POST of an
+XML envelope, pages are numbered from 1 and failures come back as <Fault>
+elements with string codes. The modern side of the system expects a
+struct-based client with JSON tags, opaque page tokens and Go errors.
+LegacyXMLAdapter converts between the two without touching either side.
+*/
+
+// Customer is the modern representation of a customer
+type Customer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// ListCustomersRequest asks for one page of customers
+type ListCustomersRequest struct {
+	PageSize  int    `json:"page_size,omitempty"`
+	PageToken string `json:"page_token,omitempty"`
+}
+
+// ListCustomersResponse is one page of customers
+type ListCustomersResponse struct {
+	Customers     []Customer `json:"customers"`
+	NextPageToken string     `json:"next_page_token,omitempty"`
+}
+
+// CustomerAPI is the modern Target interface
+type CustomerAPI interface {
+	GetCustomer(ctx context.Context, id string) (Customer, error)
+	ListCustomers(ctx context.Context, req ListCustomersRequest) (ListCustomersResponse, error)
+}
+
+// Modern errors returned by CustomerAPI implementations
+var (
+	ErrNotFound       = errors.New("adapter: not found")
+	ErrInvalidRequest = errors.New("adapter: invalid request")
+	ErrUnavailable    = errors.New("adapter: service unavailable")
+)
+
+// APIError carries the original legacy fault next to the modern error
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v: %s (%s)", e.Err, e.Message, e.Code)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// JSON renders the error the way a modern API would return it
+func (e *APIError) JSON() []byte {
+	b, _ := json.Marshal(e)
+	return b
+}
+
+// Legacy XML schema
+
+type legacyGetCustomer struct {
+	XMLName xml.Name `xml:"GetCustomer"`
+	CustID  string   `xml:"CustID"`
+}
+
+type legacyListCustomers struct {
+	XMLName  xml.Name `xml:"ListCustomers"`
+	PageNo   int      `xml:"PageNo"`
+	PageSize int      `xml:"PageSize"`
+}
+
+type legacyCustomer struct {
+	CustID   string `xml:"CustID"`
+	FullName string `xml:"FullName"`
+	EMail    string `xml:"EMail,omitempty"`
+}
+
+type legacyFault struct {
+	Code string `xml:"Code"`
+	Text string `xml:"Text"`
+}
+
+type legacyResponse struct {
+	XMLName    xml.Name         `xml:"Response"`
+	Fault      *legacyFault     `xml:"Fault,omitempty"`
+	Customers  []legacyCustomer `xml:"Customer,omitempty"`
+	PageNo     int              `xml:"PageNo,omitempty"`
+	TotalPages int              `xml:"TotalPages,omitempty"`
+}
+
+// Legacy fault codes and their modern counterparts
+var legacyFaultCodes = map[string]error{
+	"E-NOREC": ErrNotFound,
+	"E-PARAM": ErrInvalidRequest,
+	"E-BUSY":  ErrUnavailable,
+}
+
+// LegacyXMLAdapter makes the legacy XML service compatible with CustomerAPI
+type LegacyXMLAdapter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewLegacyXMLAdapter returns an adapter for the legacy service at endpoint.
+// A nil client falls back to http.DefaultClient.
+func NewLegacyXMLAdapter(endpoint string, client *http.Client) *LegacyXMLAdapter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &LegacyXMLAdapter{endpoint: endpoint, client: client}
+}
+
+func (a *LegacyXMLAdapter) GetCustomer(ctx context.Context, id string) (Customer, error) {
+	if id == "" {
+		return Customer{}, &APIError{Code: "E-PARAM", Message: "empty customer id", Err: ErrInvalidRequest}
+	}
+	resp, err := a.call(ctx, legacyGetCustomer{CustID: id})
+	if err != nil {
+		return Customer{}, err
+	}
+	if len(resp.Customers) == 0 {
+		return Customer{}, &APIError{Code: "E-NOREC", Message: "customer " + id, Err: ErrNotFound}
+	}
+	return toCustomer(resp.Customers[0]), nil
+}
+
+func (a *LegacyXMLAdapter) ListCustomers(ctx context.Context, req ListCustomersRequest) (ListCustomersResponse, error) {
+	pageNo := 1
+	if req.PageToken != "" {
+		n, err := strconv.Atoi(req.PageToken)
+		if err != nil || n < 1 {
+			return ListCustomersResponse{}, &APIError{Code: "E-PARAM", Message: "bad page token " + strconv.Quote(req.PageToken), Err: ErrInvalidRequest}
+		}
+		pageNo = n
+	}
+
+	resp, err := a.call(ctx, legacyListCustomers{PageNo: pageNo, PageSize: req.PageSize})
+	if err != nil {
+		return ListCustomersResponse{}, err
+	}
+
+	out := ListCustomersResponse{Customers: make([]Customer, 0, len(resp.Customers))}
+	for _, c := range resp.Customers {
+		out.Customers = append(out.Customers, toCustomer(c))
+	}
+	if resp.PageNo < resp.TotalPages {
+		out.NextPageToken = strconv.Itoa(resp.PageNo + 1)
+	}
+	return out, nil
+}
+
+func (a *LegacyXMLAdapter) call(ctx context.Context, body any) (*legacyResponse, error) {
+	payload, err := xml.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+
+	httpResp, err := a.client.Do(req)
+	if err != nil {
+		return nil, &APIError{Code: "TRANSPORT", Message: err.Error(), Err: ErrUnavailable}
+	}
+	defer httpResp.Body.Close()
+
+	var resp legacyResponse
+	if err := xml.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, &APIError{Code: "DECODE", Message: fmt.Sprintf("HTTP %d: %v", httpResp.StatusCode, err), Err: ErrUnavailable}
+	}
+	if resp.Fault != nil {
+		return nil, faultToError(resp.Fault)
+	}
+	return &resp, nil
+}
+
+func faultToError(f *legacyFault) error {
+	err, ok := legacyFaultCodes[f.Code]
+	if !ok {
+		err = ErrUnavailable
+	}
+	return &APIError{Code: f.Code, Message: f.Text, Err: err}
+}
+
+func toCustomer(c legacyCustomer) Customer {
+	return Customer{ID: c.CustID, Name: c.FullName, Email: c.EMail}
+}
+
+// legacyCustomerServer is a local stand-in for the legacy XML service, used
+// by the example and the tests
+type legacyCustomerServer struct {
+	Customers       []Customer
+	DefaultPageSize int
+}
+
+func (s *legacyCustomerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if r.Method != http.MethodPost {
+		s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: "POST required"}})
+		return
+	}
+
+	dec := xml.NewDecoder(r.Body)
+	var start xml.StartElement
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: "malformed envelope"}})
+			return
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			start = se
+			break
+		}
+	}
+
+	switch start.Name.Local {
+	case "GetCustomer":
+		var q legacyGetCustomer
+		if err := dec.DecodeElement(&q, &start); err != nil {
+			s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: err.Error()}})
+			return
+		}
+		for _, c := range s.Customers {
+			if c.ID == q.CustID {
+				s.write(w, legacyResponse{Customers: []legacyCustomer{fromCustomer(c)}})
+				return
+			}
+		}
+		s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-NOREC", Text: "no record for " + q.CustID}})
+	case "ListCustomers":
+		var q legacyListCustomers
+		if err := dec.DecodeElement(&q, &start); err != nil {
+			s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: err.Error()}})
+			return
+		}
+		s.list(w, q)
+	default:
+		s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: "unknown operation " + start.Name.Local}})
+	}
+}
+
+func (s *legacyCustomerServer) list(w http.ResponseWriter, q legacyListCustomers) {
+	size := q.PageSize
+	if size <= 0 {
+		size = s.DefaultPageSize
+	}
+	if size <= 0 {
+		size = 10
+	}
+	total := (len(s.Customers) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	if q.PageNo < 1 || q.PageNo > total {
+		s.write(w, legacyResponse{Fault: &legacyFault{Code: "E-PARAM", Text: fmt.Sprintf("page %d out of range", q.PageNo)}})
+		return
+	}
+
+	from := (q.PageNo - 1) * size
+	to := min(from+size, len(s.Customers))
+	resp := legacyResponse{PageNo: q.PageNo, TotalPages: total}
+	for _, c := range s.Customers[from:to] {
+		resp.Customers = append(resp.Customers, fromCustomer(c))
+	}
+	s.write(w, resp)
+}
+
+func (s *legacyCustomerServer) write(w http.ResponseWriter, resp legacyResponse) {
+	// The legacy service always answers 200 and reports faults in the body
+	_ = xml.NewEncoder(w).Encode(resp)
+}
+
+func fromCustomer(c Customer) legacyCustomer {
+	return legacyCustomer{CustID: c.ID, FullName: c.Name, EMail: c.Email}
+}
+
+// Usage
+func ExecuteLegacyXMLAdapter() {
+	server := httptest.NewServer(&legacyCustomerServer{
+		Customers: []Customer{
+			{ID: "C1", Name: "Ada Lovelace", Email: "ada@example.com"},
+			{ID: "C2", Name: "Alan Turing"},
+			{ID: "C3", Name: "Grace Hopper"},
+		},
+		DefaultPageSize: 2,
+	})
+	defer server.Close()
+
+	var api CustomerAPI = NewLegacyXMLAdapter(server.URL, server.Client())
+	ctx := context.Background()
+
+	req := ListCustomersRequest{}
+	for {
+		page, err := api.ListCustomers(ctx, req)
+		if err != nil {
+			fmt.Println("list failed:", err)
+			return
+		}
+		b, _ := json.Marshal(page)
+		fmt.Println(string(b))
+		if page.NextPageToken == "" {
+			break
+		}
+		req.PageToken = page.NextPageToken
+	}
+
+	_, err := api.GetCustomer(ctx, "C9")
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && errors.Is(err, ErrNotFound) {
+		fmt.Println(string(apiErr.JSON()))
+	}
+}
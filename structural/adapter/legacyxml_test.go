@@ -0,0 +1,124 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func newLegacyServer(t *testing.T, handler http.Handler) *LegacyXMLAdapter {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewLegacyXMLAdapter(server.URL, server.Client())
+}
+
+var legacyCustomers = []Customer{
+	{ID: "C1", Name: "Ada Lovelace", Email: "ada@example.com"},
+	{ID: "C2", Name: "Alan Turing"},
+	{ID: "C3", Name: "Grace Hopper"},
+}
+
+func TestLegacyXMLAdapterGetCustomer(t *testing.T) {
+	api := newLegacyServer(t, &legacyCustomerServer{Customers: legacyCustomers})
+	ctx := context.Background()
+
+	got, err := api.GetCustomer(ctx, "C1")
+	if err != nil || got != legacyCustomers[0] {
+		t.Fatalf("GetCustomer(C1) = %+v, %v; want %+v", got, err, legacyCustomers[0])
+	}
+
+	_, err = api.GetCustomer(ctx, "C9")
+	var apiErr *APIError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Code != "E-NOREC" {
+		t.Fatalf("GetCustomer(C9) error = %v; want ErrNotFound with code E-NOREC", err)
+	}
+
+	if _, err := api.GetCustomer(ctx, ""); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("GetCustomer(\"\") error = %v; want ErrInvalidRequest", err)
+	}
+}
+
+func TestLegacyXMLAdapterListCustomersPages(t *testing.T) {
+	api := newLegacyServer(t, &legacyCustomerServer{Customers: legacyCustomers, DefaultPageSize: 2})
+	ctx := context.Background()
+
+	var all []Customer
+	var tokens []string
+	req := ListCustomersRequest{}
+	for {
+		page, err := api.ListCustomers(ctx, req)
+		if err != nil {
+			t.Fatalf("ListCustomers(%+v): %v", req, err)
+		}
+		all = append(all, page.Customers...)
+		if page.NextPageToken == "" {
+			break
+		}
+		tokens = append(tokens, page.NextPageToken)
+		req.PageToken = page.NextPageToken
+	}
+	if !slices.Equal(all, legacyCustomers) {
+		t.Errorf("customers = %+v; want %+v", all, legacyCustomers)
+	}
+	if !slices.Equal(tokens, []string{"2"}) {
+		t.Errorf("page tokens = %q; want [\"2\"]", tokens)
+	}
+}
+
+func TestLegacyXMLAdapterListCustomersErrors(t *testing.T) {
+	api := newLegacyServer(t, &legacyCustomerServer{Customers: legacyCustomers, DefaultPageSize: 2})
+	ctx := context.Background()
+
+	for _, token := range []string{"x", "0", "-1"} {
+		if _, err := api.ListCustomers(ctx, ListCustomersRequest{PageToken: token}); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("page token %q: error = %v; want ErrInvalidRequest", token, err)
+		}
+	}
+	// Out of range pages are rejected by the service with a fault
+	_, err := api.ListCustomers(ctx, ListCustomersRequest{PageToken: "7"})
+	var apiErr *APIError
+	if !errors.Is(err, ErrInvalidRequest) || !errors.As(err, &apiErr) || apiErr.Code != "E-PARAM" {
+		t.Errorf("page 7: error = %v; want ErrInvalidRequest with code E-PARAM", err)
+	}
+}
+
+func TestLegacyXMLAdapterFaults(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+		code string
+	}{
+		{"busy", `<Response><Fault><Code>E-BUSY</Code><Text>try later</Text></Fault></Response>`, ErrUnavailable, "E-BUSY"},
+		{"unknown code", `<Response><Fault><Code>E-WHAT</Code><Text>?</Text></Fault></Response>`, ErrUnavailable, "E-WHAT"},
+		{"not xml", `<html>502 Bad Gateway`, ErrUnavailable, "DECODE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newLegacyServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			_, err := api.GetCustomer(context.Background(), "C1")
+			var apiErr *APIError
+			if !errors.Is(err, tt.want) || !errors.As(err, &apiErr) || apiErr.Code != tt.code {
+				t.Fatalf("error = %v; want %v with code %s", err, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestLegacyXMLAdapterTransportError(t *testing.T) {
+	server := httptest.NewServer(&legacyCustomerServer{})
+	api := NewLegacyXMLAdapter(server.URL, server.Client())
+	server.Close()
+
+	_, err := api.GetCustomer(context.Background(), "C1")
+	var apiErr *APIError
+	if !errors.Is(err, ErrUnavailable) || !errors.As(err, &apiErr) || apiErr.Code != "TRANSPORT" {
+		t.Fatalf("error = %v; want ErrUnavailable with code TRANSPORT", err)
+	}
+}
@@ -0,0 +1,235 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Logging library adapters
+
+A library should not force a logging package onto the application that uses
+it. Logger is a small structured Target; the adapters below put the standard
+log package, log/slog and a printf-style legacy logger behind it, so the
+library logs the same way whatever the host application picked.
+*/
+
+// Level is the severity of a log record
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Field is one key/value pair attached to a log record
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F is shorthand for building a Field
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger is the structured Target interface. Every adapter drops records
+// below the minimum level it was created with, whatever the backend does.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+	With(fields ...Field) Logger
+}
+
+// formatFields renders fields as key=value pairs in the order given,
+// quoting values that would otherwise be ambiguous
+func formatFields(fields []Field) string {
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(formatValue(f.Value))
+	}
+	return b.String()
+}
+
+// formatValue leaves errors and Stringers to fmt, which also copes with a
+// nil pointer whose method would panic
+func formatValue(v any) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func joinFields(base, extra []Field) []Field {
+	out := make([]Field, 0, len(base)+len(extra))
+	return append(append(out, base...), extra...)
+}
+
+// StdLogAdapter puts a *log.Logger behind Logger. The standard logger has
+// no levels, so the level is written as the first word of every line.
+type StdLogAdapter struct {
+	logger *log.Logger
+	min    Level
+	fields []Field
+}
+
+func NewStdLogAdapter(logger *log.Logger, min Level) *StdLogAdapter {
+	return &StdLogAdapter{logger: logger, min: min}
+}
+
+func (a *StdLogAdapter) Log(level Level, msg string, fields ...Field) {
+	if level < a.min {
+		return
+	}
+	line := level.String() + " " + msg
+	if all := joinFields(a.fields, fields); len(all) > 0 {
+		line += " " + formatFields(all)
+	}
+	a.logger.Print(line)
+}
+
+func (a *StdLogAdapter) With(fields ...Field) Logger {
+	return &StdLogAdapter{logger: a.logger, min: a.min, fields: joinFields(a.fields, fields)}
+}
+
+// SlogAdapter puts a *slog.Logger behind Logger. Levels map onto the slog
+// levels of the same name and fields become attributes. Records below min
+// are dropped before they reach slog; the handler may drop more.
+type SlogAdapter struct {
+	logger *slog.Logger
+	min    Level
+}
+
+func NewSlogAdapter(logger *slog.Logger, min Level) *SlogAdapter {
+	return &SlogAdapter{logger: logger, min: min}
+}
+
+func (a *SlogAdapter) Log(level Level, msg string, fields ...Field) {
+	if level < a.min {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	a.logger.LogAttrs(context.Background(), toSlogLevel(level), msg, attrs...)
+}
+
+func (a *SlogAdapter) With(fields ...Field) Logger {
+	args := make([]any, 0, len(fields))
+	for _, f := range fields {
+		args = append(args, slog.Any(f.Key, f.Value))
+	}
+	return &SlogAdapter{logger: a.logger.With(args...), min: a.min}
+}
+
+func toSlogLevel(l Level) slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	// Unknown levels keep their distance from Info so ordering is preserved
+	return slog.Level(4 * (int(l) - int(LevelInfo)))
+}
+
+// LegacyLogger is an existing printf-style logger with only two severities
+type LegacyLogger struct {
+	Out io.Writer
+}
+
+func (l *LegacyLogger) Infof(format string, args ...any) {
+	fmt.Fprintf(l.Out, "[info] "+format+"\n", args...)
+}
+
+func (l *LegacyLogger) Errorf(format string, args ...any) {
+	fmt.Fprintf(l.Out, "[error] "+format+"\n", args...)
+}
+
+// LegacyLoggerAdapter puts a LegacyLogger behind Logger. Debug and Info go
+// to Infof, Warn and Error go to Errorf; the exact level is kept as the
+// first field so no information is lost.
+type LegacyLoggerAdapter struct {
+	legacy *LegacyLogger
+	min    Level
+	fields []Field
+}
+
+func NewLegacyLoggerAdapter(legacy *LegacyLogger, min Level) *LegacyLoggerAdapter {
+	return &LegacyLoggerAdapter{legacy: legacy, min: min}
+}
+
+func (a *LegacyLoggerAdapter) Log(level Level, msg string, fields ...Field) {
+	if level < a.min {
+		return
+	}
+	all := append([]Field{F("level", strings.ToLower(level.String()))}, joinFields(a.fields, fields)...)
+	// msg is passed as an argument so that a '%' in it is never read as a verb
+	if level >= LevelWarn {
+		a.legacy.Errorf("%s %s", msg, formatFields(all))
+	} else {
+		a.legacy.Infof("%s %s", msg, formatFields(all))
+	}
+}
+
+func (a *LegacyLoggerAdapter) With(fields ...Field) Logger {
+	return &LegacyLoggerAdapter{legacy: a.legacy, min: a.min, fields: joinFields(a.fields, fields)}
+}
+
+// Usage
+func ExecuteLoggerAdapters() {
+	// A library only ever sees Logger
+	fetch := func(logger Logger) {
+		logger = logger.With(F("component", "fetcher"))
+		logger.Log(LevelDebug, "cache miss", F("key", "user:42"))
+		logger.Log(LevelInfo, "fetched", F("url", "https://example.com"), F("bytes", 512))
+		logger.Log(LevelWarn, "slow response", F("elapsed", "1.5 s"))
+	}
+
+	fetch(NewStdLogAdapter(log.New(os.Stdout, "std: ", 0), LevelInfo))
+	fetch(NewSlogAdapter(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})), LevelInfo))
+	fetch(NewLegacyLoggerAdapter(&LegacyLogger{Out: os.Stdout}, LevelInfo))
+}
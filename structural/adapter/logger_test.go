@@ -0,0 +1,121 @@
+package adapter
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type nilStringer struct{ name string }
+
+func (s *nilStringer) String() string { return s.name }
+
+type nilError struct{ msg string }
+
+func (e *nilError) Error() string { return e.msg }
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"plain", "plain"},
+		{"two words", `"two words"`},
+		{"", `""`},
+		{"a=b", `"a=b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{42, "42"},
+		{errors.New("boom"), "boom"},
+		{errors.New("disk full"), `"disk full"`},
+		{&nilStringer{name: "ok"}, "ok"},
+		{(*nilStringer)(nil), "<nil>"},
+		{(*nilError)(nil), "<nil>"},
+		{nil, "<nil>"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.in); got != tt.want {
+			t.Errorf("formatValue(%#v) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStdLogAdapter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogAdapter(log.New(&buf, "", 0), LevelInfo).With(F("component", "fetcher"))
+	logger.Log(LevelDebug, "dropped")
+	logger.Log(LevelInfo, "fetched", F("url", "https://example.com"), F("bytes", 512))
+	logger.Log(LevelError, "failed", F("err", errors.New("timed out")))
+
+	want := "INFO fetched component=fetcher url=https://example.com bytes=512\n" +
+		"ERROR failed component=fetcher err=\"timed out\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSlogAdapter(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := NewSlogAdapter(slog.New(handler), LevelInfo).With(F("component", "fetcher"))
+	logger.Log(LevelDebug, "dropped by the adapter although the handler takes debug")
+	logger.Log(LevelInfo, "fetched", F("bytes", 512))
+	logger.Log(LevelWarn, "slow", F("elapsed", "1.5 s"))
+	logger.Log(LevelError, "failed")
+
+	want := "level=INFO msg=fetched component=fetcher bytes=512\n" +
+		"level=WARN msg=slow component=fetcher elapsed=\"1.5 s\"\n" +
+		"level=ERROR msg=failed component=fetcher\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestToSlogLevelKeepsOrder(t *testing.T) {
+	levels := []Level{LevelDebug - 1, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelError + 1}
+	for i := 1; i < len(levels); i++ {
+		if toSlogLevel(levels[i-1]) >= toSlogLevel(levels[i]) {
+			t.Errorf("toSlogLevel(%v) = %v is not below toSlogLevel(%v) = %v",
+				levels[i-1], toSlogLevel(levels[i-1]), levels[i], toSlogLevel(levels[i]))
+		}
+	}
+}
+
+func TestLegacyLoggerAdapter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLegacyLoggerAdapter(&LegacyLogger{Out: &buf}, LevelDebug)
+	logger.Log(LevelDebug, "cache miss", F("key", "user:42"))
+	logger.Log(LevelWarn, "100% full", F("disk", "/var"))
+	logger.With(F("req", 7)).Log(LevelError, "failed")
+
+	want := "[info] cache miss level=debug key=user:42\n" +
+		"[error] 100% full level=warn disk=/var\n" +
+		"[error] failed level=error req=7\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWithDoesNotShareFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := NewStdLogAdapter(log.New(&buf, "", 0), LevelDebug).With(F("a", 1))
+	left := base.With(F("b", 2))
+	right := base.With(F("c", 3))
+	left.Log(LevelInfo, "left")
+	right.Log(LevelInfo, "right")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != "INFO left a=1 b=2" || lines[1] != "INFO right a=1 c=3" {
+		t.Errorf("got %q", lines)
+	}
+}
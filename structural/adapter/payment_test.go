@@ -0,0 +1,171 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var paymentGateways = []struct {
+	name string
+	new  func() PaymentGateway
+}{
+	{"PayStream", func() PaymentGateway { return NewPayStreamAdapter(NewPayStreamSDK()) }},
+	{"DecimalPay", func() PaymentGateway { return NewDecimalPayAdapter(NewDecimalPaySDK()) }},
+	{"LedgerBank", func() PaymentGateway { return NewLedgerBankAdapter(NewLedgerBankSDK()) }},
+}
+
+// TestPaymentGatewayConformance runs the shared conformance suite against
+// every adapter, so switching provider never changes observable behaviour
+func TestPaymentGatewayConformance(t *testing.T) {
+	for _, gw := range paymentGateways {
+		t.Run(gw.name, func(t *testing.T) {
+			t.Run("ChargeKeepsAmount", func(t *testing.T) { testChargeKeepsAmount(t, gw.new) })
+			t.Run("ChargeErrors", func(t *testing.T) { testChargeErrors(t, gw.new) })
+			t.Run("IdempotentCharge", func(t *testing.T) { testIdempotentCharge(t, gw.new) })
+			t.Run("Refunds", func(t *testing.T) { testRefunds(t, gw.new) })
+			t.Run("KeysPerOperation", func(t *testing.T) { testKeysPerOperation(t, gw.new) })
+			t.Run("UnknownPayment", func(t *testing.T) { testUnknownPayment(t, gw.new) })
+			t.Run("CancelledContext", func(t *testing.T) { testCancelledContext(t, gw.new) })
+		})
+	}
+}
+
+func usd(cents int64) Money { return Money{Cents: cents, Currency: "USD"} }
+
+// Charge keeps the exact amount, including amounts that are not whole units
+func testChargeKeepsAmount(t *testing.T, newGateway func() PaymentGateway) {
+	for _, cents := range []int64{1, 99, 1005, 123456} {
+		p, err := newGateway().Charge(context.Background(), ChargeRequest{Amount: usd(cents), Source: SourceOK})
+		if err != nil {
+			t.Errorf("charge %d: unexpected error %v", cents, err)
+		} else if p.ID == "" || p.Amount != usd(cents) {
+			t.Errorf("charge %d: got %+v", cents, p)
+		}
+	}
+}
+
+func testChargeErrors(t *testing.T, newGateway func() PaymentGateway) {
+	ctx := context.Background()
+	g := newGateway()
+	if _, err := g.Charge(ctx, ChargeRequest{Amount: usd(500), Source: SourceDeclined}); !errors.Is(err, ErrPaymentDeclined) {
+		t.Errorf("declined charge: want ErrPaymentDeclined, got %v", err)
+	}
+	for _, cents := range []int64{0, -100} {
+		if _, err := g.Charge(ctx, ChargeRequest{Amount: usd(cents), Source: SourceOK}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("charge %d: want ErrInvalidAmount, got %v", cents, err)
+		}
+	}
+}
+
+// Retrying a charge with the same key must not charge twice
+func testIdempotentCharge(t *testing.T, newGateway func() PaymentGateway) {
+	ctx := context.Background()
+	g := newGateway()
+	req := ChargeRequest{IdempotencyKey: "charge-1", Amount: Money{Cents: 2500, Currency: "EUR"}, Source: SourceOK}
+	first, err1 := g.Charge(ctx, req)
+	retry, err2 := g.Charge(ctx, req)
+	other, err3 := g.Charge(ctx, ChargeRequest{IdempotencyKey: "charge-2", Amount: req.Amount, Source: SourceOK})
+	switch {
+	case err1 != nil || err2 != nil || err3 != nil:
+		t.Fatalf("unexpected errors %v, %v, %v", err1, err2, err3)
+	case first != retry:
+		t.Errorf("retry returned %+v, first was %+v", retry, first)
+	case other.ID == first.ID:
+		t.Errorf("distinct keys share payment %s", first.ID)
+	}
+}
+
+// Refunds: partial, idempotent retry, over-refund and the remaining balance
+func testRefunds(t *testing.T, newGateway func() PaymentGateway) {
+	ctx := context.Background()
+	g := newGateway()
+	eur := func(cents int64) Money { return Money{Cents: cents, Currency: "EUR"} }
+	p, err := g.Charge(ctx, ChargeRequest{Amount: eur(2500), Source: SourceOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := RefundRequest{IdempotencyKey: "refund-1", PaymentID: p.ID, Amount: eur(1000)}
+	r1, err1 := g.Refund(ctx, req)
+	r2, err2 := g.Refund(ctx, req)
+	switch {
+	case err1 != nil || err2 != nil:
+		t.Fatalf("unexpected errors %v, %v", err1, err2)
+	case r1 != r2:
+		t.Errorf("idempotent refund: retry returned %+v, first was %+v", r2, r1)
+	case r1.PaymentID != p.ID || r1.Amount != req.Amount:
+		t.Errorf("refund: got %+v", r1)
+	}
+	if _, err := g.Refund(ctx, RefundRequest{IdempotencyKey: "refund-2", PaymentID: p.ID, Amount: eur(1501)}); !errors.Is(err, ErrRefundExceedsCharge) {
+		t.Errorf("over-refund: want ErrRefundExceedsCharge, got %v", err)
+	}
+	if _, err := g.Refund(ctx, RefundRequest{IdempotencyKey: "refund-3", PaymentID: p.ID, Amount: eur(1500)}); err != nil {
+		t.Errorf("refund of remaining balance: unexpected error %v", err)
+	}
+	for _, cents := range []int64{0, -1} {
+		if _, err := g.Refund(ctx, RefundRequest{PaymentID: p.ID, Amount: eur(cents)}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("refund %d: want ErrInvalidAmount, got %v", cents, err)
+		}
+	}
+}
+
+// A refund that reuses a charge's key is a new refund, not a replay of the charge
+func testKeysPerOperation(t *testing.T, newGateway func() PaymentGateway) {
+	ctx := context.Background()
+	g := newGateway()
+	p, err := g.Charge(ctx, ChargeRequest{IdempotencyKey: "order-7", Amount: usd(1000), Source: SourceOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := g.Refund(ctx, RefundRequest{IdempotencyKey: "order-7", PaymentID: p.ID, Amount: usd(400)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID == p.ID || r.PaymentID != p.ID || r.Amount != usd(400) {
+		t.Errorf("refund with the charge's key returned %+v for payment %+v", r, p)
+	}
+	if again, err := g.Charge(ctx, ChargeRequest{IdempotencyKey: "order-7", Amount: usd(1000), Source: SourceOK}); err != nil || again != p {
+		t.Errorf("charge retry after refund = %+v, %v; want %+v", again, err, p)
+	}
+}
+
+func testUnknownPayment(t *testing.T, newGateway func() PaymentGateway) {
+	ctx := context.Background()
+	g := newGateway()
+	if _, err := g.Charge(ctx, ChargeRequest{Amount: usd(100), Source: SourceOK}); err != nil {
+		t.Fatal(err)
+	}
+	// IDs shaped like every provider's, including ones that parse to 0
+	for _, id := range []string{"", "missing", "LB-0", "LB-99", "LB-x", "ch_0", "ch_99", "TXN000000", "TXN999999"} {
+		r, err := g.Refund(ctx, RefundRequest{PaymentID: id, Amount: usd(1)})
+		if !errors.Is(err, ErrUnknownPayment) {
+			t.Errorf("refund of %q: want ErrUnknownPayment, got %+v, %v", id, r, err)
+		}
+	}
+}
+
+// A cancelled context stops the call before it reaches the provider
+func testCancelledContext(t *testing.T, newGateway func() PaymentGateway) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g := newGateway()
+	if _, err := g.Charge(ctx, ChargeRequest{Amount: usd(100), Source: SourceOK}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled charge: want context.Canceled, got %v", err)
+	}
+	if _, err := g.Refund(ctx, RefundRequest{PaymentID: "LB-1", Amount: usd(1)}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled refund: want context.Canceled, got %v", err)
+	}
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	for _, cents := range []int64{0, 1, 9, 10, 99, 100, 1005, -1, -150} {
+		got, err := parseDecimal(formatDecimal(cents))
+		if err != nil || got != cents {
+			t.Errorf("parseDecimal(formatDecimal(%d)) = %d, %v", cents, got, err)
+		}
+	}
+	if _, err := parseDecimal("1.005"); err == nil {
+		t.Error("parseDecimal(1.005): want an error for three decimal places")
+	}
+}
@@ -0,0 +1,264 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+Two-way adapters and adapter chains
+
+Adapter only converts in one direction. During a migration old and new code
+live side by side, so TwoWayAdapter satisfies both the new Target and the
+old SpecificRequester whichever side it wraps. The same idea is applied to
+streams: legacy callback-style sources and sinks are adapted to io.Reader
+and io.Writer and back. Every adapter here implements Unwrapper, so a chain
+of adapters can be inspected with Chain and DescribeChain.
+*/
+
+var ErrNoAdaptee = errors.New("adapter: nothing to adapt")
+
+// Unwrapper is implemented by adapters that can report what they wrap
+type Unwrapper interface {
+	Unwrap() any
+}
+
+// maxChainDepth guards Chain against adapters that end up wrapping themselves
+const maxChainDepth = 64
+
+// Chain returns v followed by everything it wraps, outermost first
+func Chain(v any) []any {
+	chain := []any{v}
+	for len(chain) < maxChainDepth {
+		u, ok := v.(Unwrapper)
+		if !ok {
+			break
+		}
+		v = u.Unwrap()
+		if v == nil {
+			break
+		}
+		chain = append(chain, v)
+	}
+	return chain
+}
+
+// DescribeChain renders the types of an adapter chain, e.g. "*adapter.Adapter -> *adapter.Adaptee"
+func DescribeChain(v any) string {
+	chain := Chain(v)
+	names := make([]string, len(chain))
+	for i, c := range chain {
+		names[i] = fmt.Sprintf("%T", c)
+	}
+	return strings.Join(names, " -> ")
+}
+
+// TwoWayAdapter satisfies both Target and SpecificRequester. A zero value
+// wraps nothing and answers "no adaptee" instead of panicking.
+type TwoWayAdapter struct {
+	target Target
+	legacy SpecificRequester
+}
+
+// NewTwoWayFromTarget lets new code be called through the old interface
+func NewTwoWayFromTarget(t Target) (*TwoWayAdapter, error) {
+	if t == nil {
+		return nil, ErrNoAdaptee
+	}
+	return &TwoWayAdapter{target: t}, nil
+}
+
+// NewTwoWayFromLegacy lets old code be called through the new interface
+func NewTwoWayFromLegacy(l SpecificRequester) (*TwoWayAdapter, error) {
+	if l == nil {
+		return nil, ErrNoAdaptee
+	}
+	return &TwoWayAdapter{legacy: l}, nil
+}
+
+func (a *TwoWayAdapter) Request() string {
+	switch {
+	case a.target != nil:
+		return a.target.Request()
+	case a.legacy != nil:
+		return a.legacy.SpecificRequest()
+	}
+	return "no adaptee"
+}
+
+func (a *TwoWayAdapter) SpecificRequest() string {
+	switch {
+	case a.legacy != nil:
+		return a.legacy.SpecificRequest()
+	case a.target != nil:
+		return a.target.Request()
+	}
+	return "no adaptee"
+}
+
+func (a *TwoWayAdapter) Unwrap() any {
+	if a.target != nil {
+		return a.target
+	}
+	return a.legacy
+}
+
+// ChunkSource is a legacy push-style reader: it calls fn once per chunk and
+// stops early when fn returns an error. fn must not retain chunk.
+type ChunkSource interface {
+	ReadChunks(fn func(chunk []byte) error) error
+}
+
+// ChunkSourceFunc turns a function into a ChunkSource
+type ChunkSourceFunc func(fn func(chunk []byte) error) error
+
+func (f ChunkSourceFunc) ReadChunks(fn func(chunk []byte) error) error {
+	return f(fn)
+}
+
+// ChunkSink is a legacy callback-style writer
+type ChunkSink interface {
+	WriteChunk(chunk []byte) error
+}
+
+// ChunkSinkFunc turns a function into a ChunkSink
+type ChunkSinkFunc func(chunk []byte) error
+
+func (f ChunkSinkFunc) WriteChunk(chunk []byte) error {
+	return f(chunk)
+}
+
+// SourceReader adapts a ChunkSource to io.ReadCloser. The source runs on its
+// own goroutine and is paced by Read; Close stops it early.
+type SourceReader struct {
+	src ChunkSource
+	pr  *io.PipeReader
+}
+
+func NewSourceReader(src ChunkSource) *SourceReader {
+	pr, pw := io.Pipe()
+	go func() {
+		err := src.ReadChunks(func(chunk []byte) error {
+			_, err := pw.Write(chunk)
+			return err
+		})
+		// A nil error closes the pipe with io.EOF
+		pw.CloseWithError(err)
+	}()
+	return &SourceReader{src: src, pr: pr}
+}
+
+func (r *SourceReader) Read(p []byte) (int, error) {
+	return r.pr.Read(p)
+}
+
+func (r *SourceReader) Close() error {
+	return r.pr.Close()
+}
+
+func (r *SourceReader) Unwrap() any {
+	return r.src
+}
+
+// ReaderSource adapts an io.Reader to ChunkSource
+type ReaderSource struct {
+	r         io.Reader
+	chunkSize int
+}
+
+func NewReaderSource(r io.Reader, chunkSize int) *ReaderSource {
+	if chunkSize <= 0 {
+		chunkSize = 32 * 1024
+	}
+	return &ReaderSource{r: r, chunkSize: chunkSize}
+}
+
+func (s *ReaderSource) ReadChunks(fn func(chunk []byte) error) error {
+	buf := make([]byte, s.chunkSize)
+	for {
+		n, err := s.r.Read(buf)
+		if n > 0 {
+			if ferr := fn(buf[:n]); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReaderSource) Unwrap() any {
+	return s.r
+}
+
+// SinkWriter adapts a ChunkSink to io.Writer. Each Write hands the sink a
+// copy, because io.Writer forbids retaining p and legacy sinks may do so.
+type SinkWriter struct {
+	sink ChunkSink
+}
+
+func NewSinkWriter(sink ChunkSink) *SinkWriter {
+	return &SinkWriter{sink: sink}
+}
+
+func (w *SinkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.sink.WriteChunk(append([]byte(nil), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *SinkWriter) Unwrap() any {
+	return w.sink
+}
+
+// WriterSink adapts an io.Writer to ChunkSink
+type WriterSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) WriteChunk(chunk []byte) error {
+	_, err := s.w.Write(chunk)
+	return err
+}
+
+func (s *WriterSink) Unwrap() any {
+	return s.w
+}
+
+// Usage
+func ExecuteTwoWayAdapter() {
+	// Old code wrapped for new callers, then handed back to old callers
+	twoWay, err := NewTwoWayFromLegacy(&Adaptee{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var target Target = &Adapter{adaptee: twoWay}
+	fmt.Println(target.Request())
+	fmt.Println(DescribeChain(target))
+
+	// io.Reader -> legacy source -> io.Reader -> legacy sink -> io.Writer
+	reader := NewSourceReader(NewReaderSource(strings.NewReader("streamed through four adapters\n"), 8))
+	defer reader.Close()
+	writer := NewSinkWriter(NewWriterSink(os.Stdout))
+	if _, err := io.Copy(writer, reader); err != nil {
+		fmt.Println("copy failed:", err)
+	}
+	fmt.Println(DescribeChain(reader))
+	fmt.Println(DescribeChain(writer))
+}
@@ -0,0 +1,227 @@
+package adapter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type newService struct{}
+
+func (newService) Request() string { return "new" }
+
+func TestTwoWayAdapter(t *testing.T) {
+	fromLegacy, err := NewTwoWayFromLegacy(&Adaptee{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTarget, err := NewTwoWayFromTarget(newService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name            string
+		a               *TwoWayAdapter
+		request, legacy string
+	}{
+		{"from legacy", fromLegacy, "Adaptee: Specific request", "Adaptee: Specific request"},
+		{"from target", fromTarget, "new", "new"},
+		{"zero value", &TwoWayAdapter{}, "no adaptee", "no adaptee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Request(); got != tt.request {
+				t.Errorf("Request = %q; want %q", got, tt.request)
+			}
+			if got := tt.a.SpecificRequest(); got != tt.legacy {
+				t.Errorf("SpecificRequest = %q; want %q", got, tt.legacy)
+			}
+		})
+	}
+
+	if _, err := NewTwoWayFromTarget(nil); !errors.Is(err, ErrNoAdaptee) {
+		t.Errorf("NewTwoWayFromTarget(nil): error = %v; want ErrNoAdaptee", err)
+	}
+	if _, err := NewTwoWayFromLegacy(nil); !errors.Is(err, ErrNoAdaptee) {
+		t.Errorf("NewTwoWayFromLegacy(nil): error = %v; want ErrNoAdaptee", err)
+	}
+}
+
+// selfWrapper unwraps to itself, as a misconfigured adapter might
+type selfWrapper struct{}
+
+func (s *selfWrapper) Unwrap() any { return s }
+
+func TestChain(t *testing.T) {
+	twoWay, err := NewTwoWayFromLegacy(&Adaptee{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := DescribeChain(&Adapter{adaptee: twoWay})
+	if want := "*adapter.Adapter -> *adapter.TwoWayAdapter -> *adapter.Adaptee"; got != want {
+		t.Errorf("DescribeChain = %q; want %q", got, want)
+	}
+	if chain := Chain(&TwoWayAdapter{}); len(chain) != 1 {
+		t.Errorf("a chain ending in nil has %d links; want 1", len(chain))
+	}
+	if chain := Chain(&selfWrapper{}); len(chain) != maxChainDepth {
+		t.Errorf("a self-wrapping chain has %d links; want the limit %d", len(chain), maxChainDepth)
+	}
+}
+
+func TestSourceReaderRoundTrip(t *testing.T) {
+	text := strings.Repeat("through four adapters\n", 100)
+	reader := NewSourceReader(NewReaderSource(strings.NewReader(text), 7))
+	defer reader.Close()
+	var out bytes.Buffer
+	if _, err := io.Copy(NewSinkWriter(NewWriterSink(&out)), reader); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != text {
+		t.Errorf("copied %d bytes that differ from the %d sent", out.Len(), len(text))
+	}
+	if got := DescribeChain(reader); got != "*adapter.SourceReader -> *adapter.ReaderSource -> *strings.Reader" {
+		t.Errorf("DescribeChain = %q", got)
+	}
+}
+
+// Closing a SourceReader early must stop the source's goroutine
+func TestSourceReaderCloseEarly(t *testing.T) {
+	stopped := make(chan error, 1)
+	endless := ChunkSourceFunc(func(fn func([]byte) error) error {
+		for {
+			if err := fn([]byte("more ")); err != nil {
+				stopped <- err
+				return err
+			}
+		}
+	})
+	r := NewSourceReader(endless)
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("source stopped with %v; want io.ErrClosedPipe", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the source kept running after Close")
+	}
+	if _, err := r.Read(buf); err == nil {
+		t.Error("Read after Close succeeded")
+	}
+}
+
+func TestSourceReaderError(t *testing.T) {
+	broken := errors.New("disk gone")
+	r := NewSourceReader(ChunkSourceFunc(func(fn func([]byte) error) error {
+		fn([]byte("partial"))
+		return broken
+	}))
+	got, err := io.ReadAll(r)
+	if string(got) != "partial" || !errors.Is(err, broken) {
+		t.Errorf("ReadAll = %q, %v; want partial data and the source's error", got, err)
+	}
+}
+
+// errReader returns data once and then err
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReaderSource(t *testing.T) {
+	var chunks []string
+	collect := func(chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	}
+	if err := NewReaderSource(strings.NewReader("abcdefgh"), 3).ReadChunks(collect); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chunks, "|"); got != "abc|def|gh" {
+		t.Errorf("chunks %s; want abc|def|gh", got)
+	}
+	if s := NewReaderSource(strings.NewReader(""), 0); s.chunkSize != 32*1024 {
+		t.Errorf("default chunk size %d", s.chunkSize)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := NewReaderSource(strings.NewReader("abcdefgh"), 2).ReadChunks(func([]byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("ReadChunks = %v after %d calls; want fn's error after 1", err, calls)
+	}
+
+	broken := errors.New("read failed")
+	chunks = nil
+	err = NewReaderSource(&errReader{data: "ab", err: broken}, 8).ReadChunks(collect)
+	if !errors.Is(err, broken) || strings.Join(chunks, "") != "ab" {
+		t.Errorf("ReadChunks = %v with %q; want the data, then the reader's error", err, chunks)
+	}
+}
+
+func TestSinkWriter(t *testing.T) {
+	var kept [][]byte
+	w := NewSinkWriter(ChunkSinkFunc(func(chunk []byte) error {
+		kept = append(kept, chunk) // a legacy sink that holds on to chunks
+		return nil
+	}))
+	p := []byte("first")
+	if n, err := w.Write(p); n != 5 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	copy(p, "XXXXX")
+	if string(kept[0]) != "first" {
+		t.Errorf("the sink saw the caller reuse its buffer: %q", kept[0])
+	}
+	if n, err := w.Write(nil); n != 0 || err != nil || len(kept) != 1 {
+		t.Errorf("empty Write = %d, %v and reached the sink", n, err)
+	}
+
+	full := errors.New("sink full")
+	failing := NewSinkWriter(ChunkSinkFunc(func([]byte) error { return full }))
+	if n, err := failing.Write([]byte("x")); n != 0 || !errors.Is(err, full) {
+		t.Errorf("Write = %d, %v; want 0 and the sink's error", n, err)
+	}
+}
+
+// failWriter fails every write
+type failWriter struct{ err error }
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestWriterSink(t *testing.T) {
+	var out bytes.Buffer
+	s := NewWriterSink(&out)
+	if err := errors.Join(s.WriteChunk([]byte("a")), s.WriteChunk([]byte("b"))); err != nil || out.String() != "ab" {
+		t.Errorf("WriteChunk: %v, wrote %q", err, out.String())
+	}
+	if s.Unwrap() != &out {
+		t.Error("Unwrap does not return the writer")
+	}
+	closed := errors.New("closed")
+	if err := NewWriterSink(failWriter{closed}).WriteChunk([]byte("a")); !errors.Is(err, closed) {
+		t.Errorf("WriteChunk = %v; want the writer's error", err)
+	}
+}
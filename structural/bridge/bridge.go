@@ -1,6 +1,9 @@
 package bridge
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 /*
 =================================
@@ -40,29 +43,102 @@ func (impl *ConcreteImplementationB) Operation() string {
 	return "ConcreteImplementationB: Operation"
 }
 
+// AbstractionBase holds the implementation shared by every abstraction.
+// The implementation can be swapped at runtime; an operation that already
+// started keeps the implementation it began with.
+type AbstractionBase struct {
+	impl atomic.Pointer[implementationBox]
+}
+
+// implementationBox lets atomic.Pointer hold any Implementation
+type implementationBox struct {
+	Implementation
+}
+
+// Swap installs impl and returns the implementation it replaced. A nil impl
+// leaves the abstraction without an implementation.
+func (b *AbstractionBase) Swap(impl Implementation) Implementation {
+	var box *implementationBox
+	if impl != nil {
+		box = &implementationBox{impl}
+	}
+	old := b.impl.Swap(box)
+	if old == nil {
+		return nil
+	}
+	return old.Implementation
+}
+
+// Current returns the implementation new operations will use, or nil
+func (b *AbstractionBase) Current() Implementation {
+	box := b.impl.Load()
+	if box == nil {
+		return nil
+	}
+	return box.Implementation
+}
+
+// operation runs the current implementation; a zero value or an
+// abstraction swapped to nil reports that instead of panicking
+func (b *AbstractionBase) operation() string {
+	impl := b.Current()
+	if impl == nil {
+		return "no implementation"
+	}
+	return impl.Operation()
+}
+
 // Abstraction defines the high-level interface
 type Abstraction struct {
-	impl Implementation
+	AbstractionBase
+}
+
+func NewAbstraction(impl Implementation) *Abstraction {
+	a := &Abstraction{}
+	a.Swap(impl)
+	return a
 }
 
 func (a *Abstraction) Operation() string {
-	return "Abstraction: " + a.impl.Operation()
+	return "Abstraction: " + a.operation()
 }
 
 // ExtendedAbstraction can extend Abstraction further
 type ExtendedAbstraction struct {
-	impl Implementation
+	AbstractionBase
+}
+
+func NewExtendedAbstraction(impl Implementation) *ExtendedAbstraction {
+	ea := &ExtendedAbstraction{}
+	ea.Swap(impl)
+	return ea
 }
 
 func (ea *ExtendedAbstraction) Operation() string {
-	return "ExtendedAbstraction: " + ea.impl.Operation()
+	return "ExtendedAbstraction: " + ea.operation()
 }
 
 // Usage
 func ExecuteBridgePattern() {
-	a := &Abstraction{impl: &ConcreteImplementationA{}}
+	a := NewAbstraction(&ConcreteImplementationA{})
 	fmt.Println(a.Operation())
 
-	b := &ExtendedAbstraction{impl: &ConcreteImplementationB{}}
+	b := NewExtendedAbstraction(&ConcreteImplementationB{})
 	fmt.Println(b.Operation())
+
+	// Switch backend at runtime; an operation already running keeps the
+	// implementation it started with
+	live := NewAbstraction(&ConcreteImplementationA{})
+	fmt.Println(live.Operation())
+	old := live.Swap(&ConcreteImplementationB{})
+	fmt.Printf("Swapped out %T\n", old)
+	fmt.Println(live.Operation())
+
+	var unset Abstraction
+	fmt.Println(unset.Operation())
+
+	ExecuteRemoteBridge()
+	ExecuteShapeBridge()
+	ExecuteStorageBridge()
+	ExecuteNotificationBridge()
 }
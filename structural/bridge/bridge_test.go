@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"sync"
+	"testing"
+)
+
+// gatedImplementation blocks every operation until release is closed, so
+// the test can switch backends while operations are in flight
+type gatedImplementation struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGatedImplementation(name string) *gatedImplementation {
+	return &gatedImplementation{name: name, started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (impl *gatedImplementation) Operation() string {
+	impl.started <- struct{}{}
+	<-impl.release
+	return impl.name
+}
+
+func TestSwapWhileOperationsInFlight(t *testing.T) {
+	primary, secondary := newGatedImplementation("primary"), newGatedImplementation("secondary")
+	close(secondary.release)
+	a := NewAbstraction(primary)
+
+	const inFlight = 3
+	results := make(chan string, 2*inFlight)
+	var wg sync.WaitGroup
+	run := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- a.Operation()
+		}()
+	}
+	for range inFlight {
+		run()
+	}
+	// Every one of them holds the primary implementation before the swap
+	for range inFlight {
+		<-primary.started
+	}
+
+	if old := a.Swap(secondary); old != primary {
+		t.Fatalf("Swap returned %v; want the primary implementation", old)
+	}
+	if a.Current() != secondary {
+		t.Fatal("Current does not return the new implementation")
+	}
+	// New operations complete on secondary while primary is still blocked
+	for range inFlight {
+		run()
+	}
+	for range inFlight {
+		if got := <-results; got != "Abstraction: secondary" {
+			t.Fatalf("operation started after the swap returned %q", got)
+		}
+	}
+
+	close(primary.release)
+	wg.Wait()
+	close(results)
+	for got := range results {
+		if got != "Abstraction: primary" {
+			t.Errorf("operation started before the swap returned %q", got)
+		}
+	}
+}
+
+func TestNoImplementation(t *testing.T) {
+	var zero Abstraction
+	if got := zero.Operation(); got != "Abstraction: no implementation" {
+		t.Errorf("zero Abstraction: Operation() = %q", got)
+	}
+	if zero.Current() != nil {
+		t.Error("zero Abstraction: Current() is not nil")
+	}
+
+	ea := NewExtendedAbstraction(&ConcreteImplementationB{})
+	if old := ea.Swap(nil); old == nil {
+		t.Error("Swap(nil) did not return the old implementation")
+	}
+	if got := ea.Operation(); got != "ExtendedAbstraction: no implementation" {
+		t.Errorf("after Swap(nil): Operation() = %q", got)
+	}
+	if old := ea.Swap(&ConcreteImplementationA{}); old != nil {
+		t.Errorf("Swap after Swap(nil) returned %v; want nil", old)
+	}
+	if got := ea.Operation(); got != "ExtendedAbstraction: ConcreteImplementationA: Operation" {
+		t.Errorf("after Swap: Operation() = %q", got)
+	}
+}
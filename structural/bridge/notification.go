@@ -0,0 +1,318 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/mailer"
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+/*
+Notifications: message kinds x transports
+
+Message kinds (alert, digest, receipt) are the abstraction and decide what a
+notification says. Transports (SMTP, file spool, in-memory) are the
+implementation and decide how it travels, how recipients are addressed and
+what a failure looks like. Three kinds and three transports are six types,
+not nine, and any kind works with any transport.
+*/
+
+// Content is what a message kind hands to a transport
+type Content struct {
+	Subject string
+	Body    string
+}
+
+// Transport is the implementation side of the notification bridge. It
+// delivers to each recipient separately and reports failures per recipient.
+type Transport interface {
+	Deliver(ctx context.Context, to []string, c Content) error
+}
+
+var ErrInvalidRecipient = errors.New("bridge: invalid recipient")
+
+// DeliveryError is the failure to deliver to one recipient
+type DeliveryError struct {
+	Transport string
+	Recipient string
+	Err       error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%s: deliver to %s: %v", e.Transport, e.Recipient, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// notification is shared by every message kind
+type notification struct {
+	transport Transport
+}
+
+func (n notification) send(ctx context.Context, c Content, to []string) error {
+	if len(to) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrInvalidRecipient)
+	}
+	return n.transport.Deliver(ctx, to, c)
+}
+
+// Alert reports something that needs attention now
+type Alert struct {
+	notification
+	Severity string
+	Service  string
+	Text     string
+}
+
+func NewAlert(t Transport, severity, service, text string) *Alert {
+	return &Alert{notification: notification{t}, Severity: severity, Service: service, Text: text}
+}
+
+func (a *Alert) Format() Content {
+	return Content{
+		Subject: fmt.Sprintf("[%s] %s", strings.ToUpper(a.Severity), a.Service),
+		Body:    fmt.Sprintf("%s reports: %s\n", a.Service, a.Text),
+	}
+}
+
+func (a *Alert) Send(ctx context.Context, to ...string) error {
+	return a.send(ctx, a.Format(), to)
+}
+
+// Digest summarises many items in one message
+type Digest struct {
+	notification
+	Title string
+	Items []string
+}
+
+func NewDigest(t Transport, title string, items ...string) *Digest {
+	return &Digest{notification: notification{t}, Title: title, Items: items}
+}
+
+func (d *Digest) Format() Content {
+	var b strings.Builder
+	for i, item := range d.Items {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, item)
+	}
+	return Content{Subject: fmt.Sprintf("%s (%d items)", d.Title, len(d.Items)), Body: b.String()}
+}
+
+func (d *Digest) Send(ctx context.Context, to ...string) error {
+	return d.send(ctx, d.Format(), to)
+}
+
+// ReceiptLine is one purchased item, priced in cents
+type ReceiptLine struct {
+	Item       string
+	Quantity   int
+	PriceCents int64
+}
+
+// Receipt confirms a purchase
+type Receipt struct {
+	notification
+	OrderID string
+	Lines   []ReceiptLine
+}
+
+func NewReceipt(t Transport, orderID string, lines ...ReceiptLine) *Receipt {
+	return &Receipt{notification: notification{t}, OrderID: orderID, Lines: lines}
+}
+
+func (r *Receipt) Format() Content {
+	var b strings.Builder
+	var total int64
+	for _, l := range r.Lines {
+		sum := int64(l.Quantity) * l.PriceCents
+		total += sum
+		fmt.Fprintf(&b, "%-20s %3d x %8s = %9s\n", l.Item, l.Quantity, cents(l.PriceCents), cents(sum))
+	}
+	fmt.Fprintf(&b, "%-20s %26s\n", "Total", cents(total))
+	return Content{Subject: "Receipt for order " + r.OrderID, Body: b.String()}
+}
+
+func (r *Receipt) Send(ctx context.Context, to ...string) error {
+	return r.send(ctx, r.Format(), to)
+}
+
+func cents(c int64) string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// SMTPTransport delivers through an SMTP server. Recipients must be email
+// addresses; each one gets its own transaction so one rejected mailbox does
+// not stop the rest. Each transaction ends when ctx does, or after Timeout.
+type SMTPTransport struct {
+	Addr string
+	From string
+	// Timeout bounds each transaction; zero means mailer.DefaultTimeout
+	Timeout time.Duration
+}
+
+func (t *SMTPTransport) Deliver(ctx context.Context, to []string, c Content) error {
+	var errs []error
+	for _, rcpt := range to {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, &DeliveryError{Transport: "smtp", Recipient: rcpt, Err: err})
+			continue
+		}
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			errs = append(errs, &DeliveryError{Transport: "smtp", Recipient: rcpt, Err: fmt.Errorf("%w: %v", ErrInvalidRecipient, err)})
+			continue
+		}
+		if err := t.send(ctx, addr.Address, c); err != nil {
+			errs = append(errs, &DeliveryError{Transport: "smtp", Recipient: rcpt, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *SMTPTransport) send(ctx context.Context, to string, c Content) error {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	err := mailer.Send(ctx, t.Addr, nil, mailer.Message{From: t.From, To: []string{to}, Subject: c.Subject, Text: c.Body})
+	var me *mailer.Error
+	if errors.As(err, &me) && me.Recipient != "" {
+		// The recipient is already named by DeliveryError
+		return me.Err
+	}
+	return err
+}
+
+// SpoolTransport writes one file per recipient into a spool directory,
+// grouped in a sub-directory per recipient, for a separate process to pick up
+type SpoolTransport struct {
+	Dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func (t *SpoolTransport) Deliver(ctx context.Context, to []string, c Content) error {
+	var errs []error
+	for _, rcpt := range to {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, &DeliveryError{Transport: "spool", Recipient: rcpt, Err: err})
+			continue
+		}
+		if err := t.write(rcpt, c); err != nil {
+			errs = append(errs, &DeliveryError{Transport: "spool", Recipient: rcpt, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *SpoolTransport) write(rcpt string, c Content) error {
+	// Recipients become directory names, so they must not escape the spool
+	if rcpt == "" || rcpt != filepath.Base(rcpt) || strings.HasPrefix(rcpt, ".") {
+		return fmt.Errorf("%w: %q is not a spool name", ErrInvalidRecipient, rcpt)
+	}
+	dir := filepath.Join(t.Dir, rcpt)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.seq++
+	name := fmt.Sprintf("%d-%04d.msg", time.Now().UnixNano(), t.seq)
+	t.mu.Unlock()
+	return os.WriteFile(filepath.Join(dir, name), []byte("Subject: "+c.Subject+"\n\n"+c.Body), 0o644)
+}
+
+// Delivered is one message kept by MemoryTransport
+type Delivered struct {
+	To      string
+	Content Content
+}
+
+// MemoryTransport keeps deliveries in memory. Recipients listed in Unreachable
+// fail, which makes failure paths easy to exercise.
+type MemoryTransport struct {
+	Unreachable []string
+
+	mu        sync.Mutex
+	delivered []Delivered
+}
+
+func (t *MemoryTransport) Deliver(ctx context.Context, to []string, c Content) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for _, rcpt := range to {
+		switch {
+		case ctx.Err() != nil:
+			errs = append(errs, &DeliveryError{Transport: "memory", Recipient: rcpt, Err: ctx.Err()})
+		case slices.Contains(t.Unreachable, rcpt):
+			errs = append(errs, &DeliveryError{Transport: "memory", Recipient: rcpt, Err: errors.New("unreachable")})
+		default:
+			t.delivered = append(t.delivered, Delivered{To: rcpt, Content: c})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *MemoryTransport) Delivered() []Delivered {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Delivered(nil), t.delivered...)
+}
+
+// Usage
+func ExecuteNotificationBridge() {
+	ctx := context.Background()
+
+	server, err := smtpstub.Start()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer server.Close()
+	server.Reject = func(rcpt string) bool { return strings.HasPrefix(rcpt, "gone@") }
+
+	spoolDir, err := os.MkdirTemp("", "bridge-spool-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(spoolDir)
+
+	smtpT := &SMTPTransport{Addr: server.Addr(), From: "noreply@example.com"}
+	spoolT := &SpoolTransport{Dir: spoolDir}
+	memT := &MemoryTransport{Unreachable: []string{"pager-2"}}
+
+	_ = NewReceipt(smtpT, "A-1001", ReceiptLine{"Notebook", 2, 450}, ReceiptLine{"Pen", 3, 120}).Send(ctx, "ada@example.com")
+	if err := NewAlert(smtpT, "critical", "payments", "error rate above 5%").Send(ctx, "oncall@example.com", "gone@example.com", "not an address"); err != nil {
+		fmt.Println("SMTP failures:")
+		fmt.Println(err)
+	}
+	_ = NewDigest(spoolT, "Daily summary", "3 deploys", "1 incident").Send(ctx, "ops")
+	if err := NewAlert(memT, "warning", "search", "latency p99 800ms").Send(ctx, "pager-1", "pager-2"); err != nil {
+		fmt.Println("Memory failures:", err)
+	}
+
+	fmt.Printf("SMTP server accepted %d messages\n", len(server.Messages()))
+	spooled, _ := filepath.Glob(filepath.Join(spoolDir, "*", "*.msg"))
+	fmt.Printf("Spool holds %d messages\n", len(spooled))
+	for _, d := range memT.Delivered() {
+		fmt.Printf("Memory delivered %q to %s\n", d.Content.Subject, d.To)
+	}
+}
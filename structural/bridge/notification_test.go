@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+func TestCents(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 150: "1.50", -5: "-0.05", -150: "-1.50", -100: "-1.00"}
+	for in, want := range tests {
+		if got := cents(in); got != want {
+			t.Errorf("cents(%d) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestSMTPTransport(t *testing.T) {
+	server, err := smtpstub.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Reject = func(rcpt string) bool { return strings.HasPrefix(rcpt, "gone@") }
+	transport := &SMTPTransport{Addr: server.Addr(), From: "noreply@example.com"}
+
+	// The service name ends up in the subject; a line break must not add headers
+	alert := NewAlert(transport, "critical", "db\r\nBcc: attacker@example.com", "down")
+	err = alert.Send(context.Background(), "ops@example.com", "gone@example.com", "not an address")
+
+	var failed []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var de *DeliveryError
+		if errors.As(e, &de) {
+			failed = append(failed, de.Recipient)
+		}
+	}
+	if len(failed) != 2 || failed[0] != "gone@example.com" || failed[1] != "not an address" {
+		t.Errorf("failed recipients = %q; want gone@example.com and not an address", failed)
+	}
+	if !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("error %v does not report the invalid address", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "ops@example.com" {
+		t.Fatalf("server accepted %+v; want one message to ops", messages)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+}
+
+func TestSMTPTransportCancelled(t *testing.T) {
+	server, err := smtpstub.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = (&SMTPTransport{Addr: server.Addr(), From: "a@example.com"}).Deliver(ctx, []string{"b@example.com"}, Content{Subject: "s"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v; want context.Canceled", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("server accepted %d messages after cancel", n)
+	}
+}
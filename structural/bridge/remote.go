@@ -0,0 +1,258 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+Remote control and devices
+
+The remote is the abstraction and the device is the implementation. Remote
+and AdvancedRemote only talk to the Device interface, so adding a new kind of
+device (the SmartSpeaker below) needs no change to any remote, and adding a
+new kind of remote needs no change to any device.
+*/
+
+// Device is the implementation side of the remote control bridge
+type Device interface {
+	Name() string
+	IsEnabled() bool
+	Enable()
+	Disable()
+	Volume() int
+	// SetVolume clamps the volume to the device's own range
+	SetVolume(volume int)
+	VolumeRange() (min, max int)
+	Channel() int
+	SetChannel(channel int) error
+	Channels() []string
+}
+
+var ErrNoSuchChannel = errors.New("bridge: no such channel")
+
+// deviceState holds what every device keeps track of
+type deviceState struct {
+	name      string
+	enabled   bool
+	volume    int
+	minVolume int
+	maxVolume int
+	channel   int
+	channels  []string
+}
+
+func (d *deviceState) Name() string       { return d.name }
+func (d *deviceState) IsEnabled() bool    { return d.enabled }
+func (d *deviceState) Enable()            { d.enabled = true }
+func (d *deviceState) Disable()           { d.enabled = false }
+func (d *deviceState) Volume() int        { return d.volume }
+func (d *deviceState) Channel() int       { return d.channel }
+func (d *deviceState) Channels() []string { return append([]string(nil), d.channels...) }
+
+func (d *deviceState) VolumeRange() (int, int) {
+	return d.minVolume, d.maxVolume
+}
+
+func (d *deviceState) SetVolume(volume int) {
+	d.volume = max(d.minVolume, min(volume, d.maxVolume))
+}
+
+func (d *deviceState) SetChannel(channel int) error {
+	if channel < 0 || channel >= len(d.channels) {
+		return fmt.Errorf("%w: %d on %s", ErrNoSuchChannel, channel, d.name)
+	}
+	d.channel = channel
+	return nil
+}
+
+// TV has a wide volume range and numbered broadcast channels
+type TV struct {
+	deviceState
+}
+
+func NewTV(channels ...string) *TV {
+	return &TV{deviceState{name: "TV", volume: 20, maxVolume: 100, channels: channels}}
+}
+
+// Radio has a short volume dial and a list of stations
+type Radio struct {
+	deviceState
+}
+
+func NewRadio(stations ...string) *Radio {
+	return &Radio{deviceState{name: "Radio", volume: 5, maxVolume: 30, channels: stations}}
+}
+
+// SmartSpeaker treats playlists as channels and has a coarse volume scale
+type SmartSpeaker struct {
+	deviceState
+}
+
+func NewSmartSpeaker(playlists ...string) *SmartSpeaker {
+	return &SmartSpeaker{deviceState{name: "SmartSpeaker", volume: 4, maxVolume: 10, channels: playlists}}
+}
+
+// Remote is the abstraction side of the remote control bridge
+type Remote struct {
+	device Device
+}
+
+func NewRemote(device Device) *Remote {
+	return &Remote{device: device}
+}
+
+func (r *Remote) TogglePower() {
+	if r.device.IsEnabled() {
+		r.device.Disable()
+	} else {
+		r.device.Enable()
+	}
+}
+
+// volumeStep moves roughly a tenth of the device's range per press
+func (r *Remote) volumeStep() int {
+	lo, hi := r.device.VolumeRange()
+	return max(1, (hi-lo)/10)
+}
+
+func (r *Remote) VolumeUp() {
+	if r.device.IsEnabled() {
+		r.device.SetVolume(r.device.Volume() + r.volumeStep())
+	}
+}
+
+func (r *Remote) VolumeDown() {
+	if r.device.IsEnabled() {
+		r.device.SetVolume(r.device.Volume() - r.volumeStep())
+	}
+}
+
+// ChannelUp and ChannelDown wrap around the device's channel list
+func (r *Remote) ChannelUp() {
+	r.moveChannel(1)
+}
+
+func (r *Remote) ChannelDown() {
+	r.moveChannel(-1)
+}
+
+func (r *Remote) moveChannel(delta int) {
+	n := len(r.device.Channels())
+	if !r.device.IsEnabled() || n == 0 {
+		return
+	}
+	_ = r.device.SetChannel(((r.device.Channel()+delta)%n + n) % n)
+}
+
+func (r *Remote) Status() string {
+	d := r.device
+	if !d.IsEnabled() {
+		return d.Name() + ": off"
+	}
+	_, hi := d.VolumeRange()
+	status := fmt.Sprintf("%s: on, volume %d/%d", d.Name(), d.Volume(), hi)
+	if channels := d.Channels(); len(channels) > 0 {
+		status += fmt.Sprintf(", channel %d (%s)", d.Channel(), channels[d.Channel()])
+	}
+	return status
+}
+
+// AdvancedRemote extends Remote with mute and favourites
+type AdvancedRemote struct {
+	Remote
+	muted      bool
+	savedLevel int
+	favourites map[string]int
+}
+
+func NewAdvancedRemote(device Device) *AdvancedRemote {
+	return &AdvancedRemote{Remote: Remote{device: device}, favourites: map[string]int{}}
+}
+
+// Mute drops to the lowest volume and remembers the previous level; a
+// second call restores it. Changing the volume in between, with the remote
+// or on the device, ends the mute, so nothing stale is restored.
+func (r *AdvancedRemote) Mute() {
+	if !r.device.IsEnabled() {
+		return
+	}
+	if r.IsMuted() {
+		r.device.SetVolume(r.savedLevel)
+		r.muted = false
+		return
+	}
+	lo, _ := r.device.VolumeRange()
+	r.savedLevel = r.device.Volume()
+	r.device.SetVolume(lo)
+	r.muted = true
+}
+
+// IsMuted reports whether the device is still at the level Mute left it
+func (r *AdvancedRemote) IsMuted() bool {
+	if lo, _ := r.device.VolumeRange(); r.muted && r.device.Volume() != lo {
+		r.muted = false
+	}
+	return r.muted
+}
+
+// VolumeUp unmutes first, like most real remotes
+func (r *AdvancedRemote) VolumeUp() {
+	if r.IsMuted() {
+		r.Mute()
+	}
+	r.Remote.VolumeUp()
+}
+
+// VolumeDown ends the mute and steps down from the muted level
+func (r *AdvancedRemote) VolumeDown() {
+	if r.device.IsEnabled() {
+		r.muted = false
+	}
+	r.Remote.VolumeDown()
+}
+
+// SaveFavourite remembers the current channel under name
+func (r *AdvancedRemote) SaveFavourite(name string) {
+	r.favourites[name] = r.device.Channel()
+}
+
+func (r *AdvancedRemote) GoToFavourite(name string) error {
+	channel, ok := r.favourites[name]
+	if !ok {
+		return fmt.Errorf("bridge: no favourite %q", name)
+	}
+	if !r.device.IsEnabled() {
+		r.device.Enable()
+	}
+	return r.device.SetChannel(channel)
+}
+
+// Usage
+func ExecuteRemoteBridge() {
+	devices := []Device{
+		NewTV("News", "Sports", "Movies"),
+		NewRadio("FM 91.5", "FM 101.0"),
+		NewSmartSpeaker("Focus", "Chill", "Workout"),
+	}
+
+	for _, device := range devices {
+		remote := NewAdvancedRemote(device)
+		remote.TogglePower()
+		remote.ChannelUp()
+		remote.SaveFavourite("usual")
+		remote.ChannelDown()
+		remote.ChannelDown()
+		remote.VolumeUp()
+		fmt.Println(remote.Status())
+
+		remote.Mute()
+		fmt.Println(remote.Status(), "(muted)")
+		remote.Mute()
+
+		if err := remote.GoToFavourite("usual"); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println(remote.Status())
+	}
+}
@@ -0,0 +1,144 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+)
+
+// devices returns one of each device, switched off, with the volume it
+// starts at and the step a remote press moves it by
+func devices() []struct {
+	device       Device
+	volume, step int
+} {
+	return []struct {
+		device       Device
+		volume, step int
+	}{
+		{NewTV("News", "Sports", "Movies"), 20, 10},
+		{NewRadio("FM 91.5", "FM 101.0"), 5, 3},
+		{NewSmartSpeaker("Focus", "Chill", "Workout"), 4, 1},
+	}
+}
+
+func TestRemoteVolumeAndChannels(t *testing.T) {
+	for _, tt := range devices() {
+		d := tt.device
+		t.Run(d.Name(), func(t *testing.T) {
+			r := NewRemote(d)
+			r.VolumeUp()
+			r.ChannelUp()
+			if d.Volume() != tt.volume || d.Channel() != 0 {
+				t.Errorf("a remote changed a device that is off")
+			}
+			if got := r.Status(); got != d.Name()+": off" {
+				t.Errorf("Status = %q", got)
+			}
+
+			r.TogglePower()
+			r.VolumeUp()
+			if d.Volume() != tt.volume+tt.step {
+				t.Errorf("VolumeUp: volume %d; want %d", d.Volume(), tt.volume+tt.step)
+			}
+			for range 20 {
+				r.VolumeUp()
+			}
+			if lo, hi := d.VolumeRange(); d.Volume() != hi || lo != 0 {
+				t.Errorf("volume %d; want it clamped to %d", d.Volume(), hi)
+			}
+
+			n := len(d.Channels())
+			r.ChannelDown()
+			if d.Channel() != n-1 {
+				t.Errorf("ChannelDown from 0: channel %d; want %d", d.Channel(), n-1)
+			}
+			r.ChannelUp()
+			if d.Channel() != 0 {
+				t.Errorf("ChannelUp from the last: channel %d; want 0", d.Channel())
+			}
+			if err := d.SetChannel(n); !errors.Is(err, ErrNoSuchChannel) {
+				t.Errorf("SetChannel(%d) = %v; want ErrNoSuchChannel", n, err)
+			}
+		})
+	}
+}
+
+func TestAdvancedRemoteMute(t *testing.T) {
+	for _, tt := range devices() {
+		d := tt.device
+		t.Run(d.Name(), func(t *testing.T) {
+			r := NewAdvancedRemote(d)
+			r.Mute()
+			if r.IsMuted() {
+				t.Fatal("Mute worked on a device that is off")
+			}
+			r.TogglePower()
+
+			r.Mute()
+			if !r.IsMuted() || d.Volume() != 0 {
+				t.Fatalf("after Mute: muted %t, volume %d", r.IsMuted(), d.Volume())
+			}
+			r.Mute()
+			if r.IsMuted() || d.Volume() != tt.volume {
+				t.Errorf("after a second Mute: muted %t, volume %d; want %d", r.IsMuted(), d.Volume(), tt.volume)
+			}
+
+			// VolumeUp unmutes and steps up from the saved level
+			r.Mute()
+			r.VolumeUp()
+			if r.IsMuted() || d.Volume() != tt.volume+tt.step {
+				t.Errorf("VolumeUp while muted: muted %t, volume %d; want %d", r.IsMuted(), d.Volume(), tt.volume+tt.step)
+			}
+
+			// VolumeDown ends the mute, so the next Mute saves the new level
+			r.Mute()
+			r.VolumeDown()
+			if r.IsMuted() {
+				t.Error("still muted after VolumeDown")
+			}
+			r.Mute()
+			r.Mute()
+			if d.Volume() != 0 {
+				t.Errorf("Mute twice after VolumeDown restored %d; want 0", d.Volume())
+			}
+
+			// So does a change made on the device itself
+			d.SetVolume(tt.volume)
+			r.Mute()
+			d.SetVolume(tt.step)
+			if r.IsMuted() {
+				t.Error("still muted after the device's volume changed")
+			}
+			r.Mute()
+			r.Mute()
+			if d.Volume() != tt.step {
+				t.Errorf("Mute twice restored %d; want %d", d.Volume(), tt.step)
+			}
+		})
+	}
+}
+
+func TestAdvancedRemoteFavourites(t *testing.T) {
+	for _, tt := range devices() {
+		d := tt.device
+		t.Run(d.Name(), func(t *testing.T) {
+			r := NewAdvancedRemote(d)
+			r.TogglePower()
+			r.ChannelUp()
+			r.SaveFavourite("usual")
+			r.ChannelDown()
+			r.TogglePower()
+
+			// Going to a favourite switches the device on
+			if err := r.GoToFavourite("usual"); err != nil {
+				t.Fatal(err)
+			}
+			if !d.IsEnabled() || d.Channel() != 1 {
+				t.Errorf("GoToFavourite: on %t, channel %d; want on, 1", d.IsEnabled(), d.Channel())
+			}
+			if err := r.GoToFavourite("missing"); err == nil {
+				t.Error("GoToFavourite found a favourite that was never saved")
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package bridge
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+/*
+Shapes and renderers
+
+Shapes are the abstraction, rendering backends are the implementation. A
+shape only knows how to describe itself in terms of the Renderer primitives,
+and a renderer only knows how to draw those primitives, so N shapes and M
+backends need N + M types instead of N x M.
+*/
+
+// Renderer is the implementation side of the shape bridge. Coordinates are
+// in abstract units with the origin at the top left.
+type Renderer interface {
+	DrawCircle(cx, cy, r int)
+	DrawRect(x, y, w, h int)
+	DrawPolygon(points []image.Point)
+	DrawText(x, y int, text string)
+	// WriteTo writes the finished picture in the renderer's format
+	WriteTo(w io.Writer) (int64, error)
+}
+
+// Shape is the abstraction side of the shape bridge
+type Shape interface {
+	Draw(r Renderer)
+}
+
+type Circle struct {
+	Center image.Point
+	Radius int
+}
+
+func (c *Circle) Draw(r Renderer) {
+	r.DrawCircle(c.Center.X, c.Center.Y, c.Radius)
+}
+
+type Rectangle struct {
+	Min, Max image.Point
+}
+
+func (rc *Rectangle) Draw(r Renderer) {
+	r.DrawRect(rc.Min.X, rc.Min.Y, rc.Max.X-rc.Min.X, rc.Max.Y-rc.Min.Y)
+}
+
+type Polygon struct {
+	Points []image.Point
+}
+
+func (p *Polygon) Draw(r Renderer) {
+	r.DrawPolygon(p.Points)
+}
+
+type Text struct {
+	At    image.Point
+	Value string
+}
+
+func (t *Text) Draw(r Renderer) {
+	r.DrawText(t.At.X, t.At.Y, t.Value)
+}
+
+// Render draws every shape through r and writes the result to w
+func Render(r Renderer, w io.Writer, shapes ...Shape) error {
+	for _, s := range shapes {
+		s.Draw(r)
+	}
+	_, err := r.WriteTo(w)
+	return err
+}
+
+// Raster helpers shared by the ASCII and PNG renderers
+
+type plotFunc func(x, y int)
+
+// plotLine is Bresenham's line algorithm
+func plotLine(plot plotFunc, x0, y0, x1, y1 int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		plot(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// plotCircle is the midpoint circle algorithm
+func plotCircle(plot plotFunc, cx, cy, r int) {
+	x, y, e := r, 0, 1-r
+	for x >= y {
+		for _, p := range [][2]int{{x, y}, {y, x}, {-y, x}, {-x, y}, {-x, -y}, {-y, -x}, {y, -x}, {x, -y}} {
+			plot(cx+p[0], cy+p[1])
+		}
+		y++
+		if e < 0 {
+			e += 2*y + 1
+		} else {
+			x--
+			e += 2*(y-x) + 1
+		}
+	}
+}
+
+func plotPolygon(plot plotFunc, points []image.Point) {
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		plotLine(plot, p.X, p.Y, q.X, q.Y)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ASCIIRenderer rasterises onto a grid of characters, one cell per unit.
+// Text may hold any runes; each takes one cell.
+type ASCIIRenderer struct {
+	grid [][]rune
+}
+
+func NewASCIIRenderer(width, height int) *ASCIIRenderer {
+	grid := make([][]rune, height)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", width))
+	}
+	return &ASCIIRenderer{grid: grid}
+}
+
+func (a *ASCIIRenderer) set(x, y int, c rune) {
+	if y >= 0 && y < len(a.grid) && x >= 0 && x < len(a.grid[y]) {
+		a.grid[y][x] = c
+	}
+}
+
+func (a *ASCIIRenderer) plot(x, y int) {
+	a.set(x, y, '*')
+}
+
+func (a *ASCIIRenderer) DrawCircle(cx, cy, r int) {
+	plotCircle(a.plot, cx, cy, r)
+}
+
+func (a *ASCIIRenderer) DrawRect(x, y, w, h int) {
+	plotPolygon(a.plot, []image.Point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}})
+}
+
+func (a *ASCIIRenderer) DrawPolygon(points []image.Point) {
+	plotPolygon(a.plot, points)
+}
+
+func (a *ASCIIRenderer) DrawText(x, y int, text string) {
+	for i, r := range []rune(text) {
+		a.set(x+i, y, r)
+	}
+}
+
+func (a *ASCIIRenderer) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	for _, row := range a.grid {
+		b.WriteString(strings.TrimRight(string(row), " "))
+		b.WriteByte('\n')
+	}
+	return b.WriteTo(w)
+}
+
+// SVGRenderer collects SVG elements, one user unit per unit
+type SVGRenderer struct {
+	width, height int
+	elements      []string
+}
+
+func NewSVGRenderer(width, height int) *SVGRenderer {
+	return &SVGRenderer{width: width, height: height}
+}
+
+func (s *SVGRenderer) DrawCircle(cx, cy, r int) {
+	s.elements = append(s.elements, fmt.Sprintf(`<circle cx="%d" cy="%d" r="%d" fill="none" stroke="black"/>`, cx, cy, r))
+}
+
+func (s *SVGRenderer) DrawRect(x, y, w, h int) {
+	s.elements = append(s.elements, fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`, x, y, w, h))
+}
+
+func (s *SVGRenderer) DrawPolygon(points []image.Point) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%d,%d", p.X, p.Y)
+	}
+	s.elements = append(s.elements, fmt.Sprintf(`<polygon points="%s" fill="none" stroke="black"/>`, strings.Join(coords, " ")))
+}
+
+func (s *SVGRenderer) DrawText(x, y int, text string) {
+	s.elements = append(s.elements, fmt.Sprintf(`<text x="%d" y="%d" dominant-baseline="hanging" font-family="monospace">%s</text>`, x, y, html.EscapeString(text)))
+}
+
+func (s *SVGRenderer) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", s.width, s.height, s.width, s.height)
+	for _, e := range s.elements {
+		b.WriteString("  " + e + "\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.WriteTo(w)
+}
+
+// PNGRenderer rasterises onto an image with scale pixels per unit
+type PNGRenderer struct {
+	img   *image.Gray
+	scale int
+}
+
+func NewPNGRenderer(width, height, scale int) *PNGRenderer {
+	scale = max(scale, 1)
+	img := image.NewGray(image.Rect(0, 0, width*scale, height*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return &PNGRenderer{img: img, scale: scale}
+}
+
+func (p *PNGRenderer) plot(x, y int) {
+	p.img.SetGray(x, y, color.Gray{})
+}
+
+func (p *PNGRenderer) DrawCircle(cx, cy, r int) {
+	s := p.scale
+	plotCircle(p.plot, cx*s, cy*s, r*s)
+}
+
+func (p *PNGRenderer) DrawRect(x, y, w, h int) {
+	p.DrawPolygon([]image.Point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}})
+}
+
+func (p *PNGRenderer) DrawPolygon(points []image.Point) {
+	scaled := make([]image.Point, len(points))
+	for i, pt := range points {
+		scaled[i] = pt.Mul(p.scale)
+	}
+	plotPolygon(p.plot, scaled)
+}
+
+// DrawText uses a built-in 3x5 bitmap font; each character fills one unit
+// of width, so text lines up with the ASCII renderer
+func (p *PNGRenderer) DrawText(x, y int, text string) {
+	dot := max(p.scale/4, 1)
+	for i, r := range []rune(strings.ToUpper(text)) {
+		glyph, ok := font3x5[r]
+		if !ok {
+			glyph = font3x5['?']
+		}
+		ox, oy := (x+i)*p.scale, y*p.scale
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+				for dy := 0; dy < dot; dy++ {
+					for dx := 0; dx < dot; dx++ {
+						p.plot(ox+col*dot+dx, oy+row*dot+dy)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (p *PNGRenderer) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, p.img); err != nil {
+		return 0, err
+	}
+	return b.WriteTo(w)
+}
+
+// Image exposes the raster, e.g. for comparing against a reference image
+func (p *PNGRenderer) Image() image.Image {
+	return p.img
+}
+
+// font3x5 holds one row of three bits per line, most significant bit left
+var font3x5 = map[rune][5]byte{
+	' ': {0, 0, 0, 0, 0}, '?': {6, 1, 2, 0, 2}, '!': {2, 2, 2, 0, 2},
+	'.': {0, 0, 0, 0, 2}, ',': {0, 0, 0, 2, 4}, '-': {0, 0, 7, 0, 0},
+	':': {0, 2, 0, 2, 0}, '/': {1, 1, 2, 4, 4},
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 3, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 2, 2},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+}
+
+// RegularPolygon returns the corners of an n-sided polygon around center,
+// or nil when sides is less than 1
+func RegularPolygon(center image.Point, radius, sides int) []image.Point {
+	if sides < 1 {
+		return nil
+	}
+	points := make([]image.Point, sides)
+	for i := range points {
+		angle := 2*math.Pi*float64(i)/float64(sides) - math.Pi/2
+		points[i] = image.Pt(
+			center.X+int(math.Round(float64(radius)*math.Cos(angle))),
+			center.Y+int(math.Round(float64(radius)*math.Sin(angle))),
+		)
+	}
+	return points
+}
+
+// Usage
+func ExecuteShapeBridge() {
+	shapes := []Shape{
+		&Rectangle{Min: image.Pt(1, 1), Max: image.Pt(38, 14)},
+		&Circle{Center: image.Pt(9, 7), Radius: 4},
+		&Polygon{Points: RegularPolygon(image.Pt(22, 7), 5, 3)},
+		&Text{At: image.Pt(29, 7), Value: "BRIDGE"},
+	}
+
+	if err := Render(NewASCIIRenderer(40, 16), os.Stdout, shapes...); err != nil {
+		fmt.Println(err)
+	}
+
+	var svg, pngData bytes.Buffer
+	if err := Render(NewSVGRenderer(40, 16), &svg, shapes...); err != nil {
+		fmt.Println(err)
+	}
+	if err := Render(NewPNGRenderer(40, 16, 8), &pngData, shapes...); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Printf("SVG: %d elements, PNG: %d bytes\n", strings.Count(svg.String(), "\n")-2, pngData.Len())
+}
@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenScene draws one of every shape, with text that is not all ASCII
+func goldenScene() []Shape {
+	return []Shape{
+		&Rectangle{Min: image.Pt(1, 1), Max: image.Pt(38, 14)},
+		&Circle{Center: image.Pt(9, 7), Radius: 4},
+		&Polygon{Points: RegularPolygon(image.Pt(22, 7), 5, 3)},
+		&Text{At: image.Pt(29, 5), Value: "BRIDGE"},
+		&Text{At: image.Pt(29, 9), Value: "ÜBER→1"},
+	}
+}
+
+// golden compares got with testdata/name, or rewrites it with -update
+func golden(t *testing.T, name string, got []byte) []byte {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	return want
+}
+
+func TestASCIIRendererGolden(t *testing.T) {
+	var got bytes.Buffer
+	if err := Render(NewASCIIRenderer(40, 16), &got, goldenScene()...); err != nil {
+		t.Fatal(err)
+	}
+	if want := golden(t, "shapes.txt", got.Bytes()); !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("ASCII output differs from testdata/shapes.txt\ngot:\n%s\nwant:\n%s", got.Bytes(), want)
+	}
+}
+
+func TestSVGRendererGolden(t *testing.T) {
+	var got bytes.Buffer
+	if err := Render(NewSVGRenderer(40, 16), &got, goldenScene()...); err != nil {
+		t.Fatal(err)
+	}
+	if want := golden(t, "shapes.svg", got.Bytes()); !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("SVG output differs from testdata/shapes.svg\ngot:\n%s\nwant:\n%s", got.Bytes(), want)
+	}
+}
+
+// The PNG is compared pixel by pixel, since the encoder may change
+func TestPNGRendererGolden(t *testing.T) {
+	r := NewPNGRenderer(40, 16, 4)
+	var encoded bytes.Buffer
+	if err := Render(r, &encoded, goldenScene()...); err != nil {
+		t.Fatal(err)
+	}
+	want, err := png.Decode(bytes.NewReader(golden(t, "shapes.png", encoded.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Image()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds = %v; want %v", got.Bounds(), want.Bounds())
+	}
+	diff := 0
+	for y := got.Bounds().Min.Y; y < got.Bounds().Max.Y; y++ {
+		for x := got.Bounds().Min.X; x < got.Bounds().Max.X; x++ {
+			gr, gg, gb, _ := got.At(x, y).RGBA()
+			wr, wg, wb, _ := want.At(x, y).RGBA()
+			if gr != wr || gg != wg || gb != wb {
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%d pixels differ from testdata/shapes.png", diff)
+	}
+}
+
+// Each rune of text takes one unit, wherever the multi-byte runes are
+func TestDrawTextMultiByte(t *testing.T) {
+	a := NewASCIIRenderer(6, 1)
+	a.DrawText(0, 0, "ÜB→X")
+	var out bytes.Buffer
+	a.WriteTo(&out)
+	if got := out.String(); got != "ÜB→X\n" {
+		t.Errorf("ASCII DrawText = %q; want %q", got, "ÜB→X\n")
+	}
+
+	// The X must land in the fourth unit on both renderers
+	p := NewPNGRenderer(6, 1, 4)
+	p.DrawText(0, 0, "ÜB→X")
+	ref := NewPNGRenderer(6, 1, 4)
+	ref.DrawText(3, 0, "X")
+	for x := 12; x < 16; x++ {
+		for y := 0; y < 4; y++ {
+			if p.img.GrayAt(x, y) != ref.img.GrayAt(x, y) {
+				t.Fatalf("PNG DrawText: pixel (%d,%d) of the X is misplaced", x, y)
+			}
+		}
+	}
+}
+
+func TestRegularPolygon(t *testing.T) {
+	for _, sides := range []int{-3, -1, 0} {
+		if got := RegularPolygon(image.Pt(5, 5), 3, sides); got != nil {
+			t.Errorf("RegularPolygon(sides=%d) = %v; want nil", sides, got)
+		}
+	}
+	got := RegularPolygon(image.Pt(10, 10), 4, 4)
+	want := []image.Point{{10, 6}, {14, 10}, {10, 14}, {6, 10}}
+	if len(got) != len(want) {
+		t.Fatalf("RegularPolygon(4 sides) = %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RegularPolygon(4 sides) = %v; want %v", got, want)
+			break
+		}
+	}
+	// Drawing an empty polygon is a no-op, not a panic
+	NewASCIIRenderer(4, 4).DrawPolygon(RegularPolygon(image.Pt(1, 1), 1, -1))
+}
@@ -0,0 +1,620 @@
+package bridge
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+/*
+Repository and storage backends
+
+Repository is the abstraction domain code works with: typed values under
+string IDs. Storage is the implementation: raw bytes under string keys.
+Services pick a Storage (memory, one file per key, append-only log) at
+wiring time and the domain code never notices the difference; the tests
+hold every backend to the same behaviour.
+*/
+
+var ErrKeyNotFound = errors.New("bridge: key not found")
+
+// Storage is the implementation side of the repository bridge
+type Storage interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	// Keys returns every key starting with prefix, in sorted order
+	Keys(prefix string) ([]string, error)
+}
+
+// Record is one typed value and its ID
+type Record[T any] struct {
+	ID    string
+	Value T
+}
+
+// Repository is the abstraction side of the repository bridge. Values are
+// stored as JSON under "namespace/id" so several repositories can share a
+// Storage.
+type Repository[T any] struct {
+	storage   Storage
+	namespace string
+}
+
+func NewRepository[T any](storage Storage, namespace string) *Repository[T] {
+	return &Repository[T]{storage: storage, namespace: namespace + "/"}
+}
+
+func (r *Repository[T]) Get(id string) (T, error) {
+	var v T
+	data, err := r.storage.Get(r.namespace + id)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("bridge: decode %s%s: %w", r.namespace, id, err)
+	}
+	return v, nil
+}
+
+func (r *Repository[T]) Put(id string, v T) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.storage.Put(r.namespace+id, data)
+}
+
+func (r *Repository[T]) Delete(id string) error {
+	return r.storage.Delete(r.namespace + id)
+}
+
+// List returns every record whose ID starts with prefix, ordered by ID
+func (r *Repository[T]) List(prefix string) ([]Record[T], error) {
+	keys, err := r.storage.Keys(r.namespace + prefix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record[T], 0, len(keys))
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, r.namespace)
+		v, err := r.Get(id)
+		if errors.Is(err, ErrKeyNotFound) {
+			// Deleted between Keys and Get
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record[T]{ID: id, Value: v})
+	}
+	return records, nil
+}
+
+// MemoryStorage keeps everything in a map
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: map[string][]byte{}}
+}
+
+func (m *MemoryStorage) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return slices.Clone(v), nil
+}
+
+func (m *MemoryStorage) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = slices.Clone(value)
+	return nil
+}
+
+func (m *MemoryStorage) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	delete(m.data, key)
+	return nil
+}
+
+func (m *MemoryStorage) Keys(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// FileStorage keeps one file per key in a directory. A file is named "k"
+// and the base64url form of its key, so any key is a valid file name. Keys
+// too long for that are named "h" and the SHA-256 of the key, and the file
+// starts with the key itself.
+type FileStorage struct {
+	dir string
+}
+
+// maxFileNameLen keeps names well inside the usual 255 byte limit
+const maxFileNameLen = 200
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// path returns the file for key and whether the file starts with the key
+func (f *FileStorage) path(key string) (string, bool) {
+	name := "k" + base64.RawURLEncoding.EncodeToString([]byte(key))
+	if len(name) <= maxFileNameLen {
+		return filepath.Join(f.dir, name), false
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, "h"+hex.EncodeToString(sum[:])), true
+}
+
+func (f *FileStorage) Get(key string) ([]byte, error) {
+	path, hashed := f.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	if err != nil || !hashed {
+		return data, err
+	}
+	stored, value, err := splitKeyedFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("bridge: %s: %w", path, err)
+	}
+	if stored != key {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return value, nil
+}
+
+// splitKeyedFile splits the contents of an "h" file into key and value
+func splitKeyedFile(data []byte) (string, []byte, error) {
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || keyLen > uint64(len(data)-n) {
+		return "", nil, errors.New("corrupt key header")
+	}
+	end := n + int(keyLen)
+	return string(data[n:end]), data[end:], nil
+}
+
+// Put writes to a temporary file first so readers never see half a value
+func (f *FileStorage) Put(key string, value []byte) error {
+	path, hashed := f.path(key)
+	if hashed {
+		header := binary.AppendUvarint(nil, uint64(len(key)))
+		value = append(append(header, key...), value...)
+	}
+	tmp, err := os.CreateTemp(f.dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileStorage) Delete(key string) error {
+	path, _ := f.path(key)
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return err
+}
+
+func (f *FileStorage) Keys(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		key, err := f.keyOf(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && strings.HasPrefix(*key, prefix) {
+			keys = append(keys, *key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// keyOf returns the key stored under file name, or nil if the file is not
+// one of ours
+func (f *FileStorage) keyOf(name string) (*string, error) {
+	switch {
+	case strings.HasPrefix(name, "k"):
+		key, err := base64.RawURLEncoding.DecodeString(name[1:])
+		if err != nil {
+			return nil, nil
+		}
+		s := string(key)
+		return &s, nil
+	case strings.HasPrefix(name, "h"):
+		data, err := os.ReadFile(filepath.Join(f.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted while listing
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, _, err := splitKeyedFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("bridge: %s: %w", name, err)
+		}
+		return &key, nil
+	}
+	return nil, nil
+}
+
+// LogStorage appends every Put and Delete to a single log file and keeps an
+// in-memory index of where the latest value of each key lives. Compact
+// rewrites the log with only the live values.
+//
+// Record layout: op byte, key length uvarint, value length uvarint, key, value
+type LogStorage struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	size    int64
+	index   map[string]logEntry
+	garbage int
+}
+
+type logEntry struct {
+	offset int64
+	length int
+}
+
+const (
+	logOpPut    byte = 'P'
+	logOpDelete byte = 'D'
+)
+
+// OpenLogStorage opens or creates the log at path and replays it
+func OpenLogStorage(path string) (*LogStorage, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &LogStorage{path: path, file: file, index: map[string]logEntry{}}
+	if err := l.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *LogStorage) replay() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(l.file)
+	var offset int64
+	for {
+		op, key, valueLen, headerLen, err := readLogHeader(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A torn write at the end of the log: drop it
+			break
+		}
+		if _, err := r.Discard(valueLen); err != nil {
+			break
+		}
+		if _, live := l.index[key]; live {
+			l.garbage++
+		}
+		switch op {
+		case logOpPut:
+			l.index[key] = logEntry{offset: offset + int64(headerLen), length: valueLen}
+		case logOpDelete:
+			delete(l.index, key)
+			l.garbage++
+		default:
+			return fmt.Errorf("bridge: corrupt log %s at offset %d: unknown op %q", l.path, offset, op)
+		}
+		offset += int64(headerLen + valueLen)
+	}
+	l.size = offset
+	return l.file.Truncate(offset)
+}
+
+// readLogHeader reads everything up to the value and reports the header
+// size. Lengths that run past the remaining bytes of the log come from a
+// torn or corrupt record and are reported as io.ErrUnexpectedEOF.
+func readLogHeader(r *bufio.Reader, remaining int64) (op byte, key string, valueLen, headerLen int, err error) {
+	op, err = r.ReadByte()
+	if err != nil {
+		return
+	}
+	counter := &countingByteReader{r: r}
+	keyLen, err := binary.ReadUvarint(counter)
+	if err != nil {
+		return op, "", 0, 0, io.ErrUnexpectedEOF
+	}
+	vLen, err := binary.ReadUvarint(counter)
+	if err != nil {
+		return op, "", 0, 0, io.ErrUnexpectedEOF
+	}
+	left := uint64(remaining - 1 - int64(counter.n))
+	if keyLen > left || vLen > left-keyLen {
+		return op, "", 0, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, keyLen)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return op, "", 0, 0, io.ErrUnexpectedEOF
+	}
+	return op, string(buf), int(vLen), 1 + counter.n + int(keyLen), nil
+}
+
+type countingByteReader struct {
+	r *bufio.Reader
+	n int
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func encodeLogRecord(op byte, key string, value []byte) []byte {
+	rec := []byte{op}
+	rec = binary.AppendUvarint(rec, uint64(len(key)))
+	rec = binary.AppendUvarint(rec, uint64(len(value)))
+	rec = append(rec, key...)
+	return append(rec, value...)
+}
+
+func (l *LogStorage) append(op byte, key string, value []byte) error {
+	rec := encodeLogRecord(op, key, value)
+	if _, err := l.file.WriteAt(rec, l.size); err != nil {
+		return err
+	}
+	if op == logOpPut {
+		l.index[key] = logEntry{offset: l.size + int64(len(rec)-len(value)), length: len(value)}
+	}
+	l.size += int64(len(rec))
+	return nil
+}
+
+func (l *LogStorage) Get(key string) ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	e, ok := l.index[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	buf := make([]byte, e.length)
+	if _, err := l.file.ReadAt(buf, e.offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (l *LogStorage) Put(key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, live := l.index[key]; live {
+		l.garbage++
+	}
+	return l.append(logOpPut, key, value)
+}
+
+func (l *LogStorage) Delete(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.index[key]; !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	if err := l.append(logOpDelete, key, nil); err != nil {
+		return err
+	}
+	delete(l.index, key)
+	l.garbage += 2
+	return nil
+}
+
+func (l *LogStorage) Keys(prefix string) ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var keys []string
+	for k := range l.index {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// Garbage reports how many records in the log are overwritten or deleted
+func (l *LogStorage) Garbage() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.garbage
+}
+
+// Compact rewrites the log with only live values and swaps it in place
+func (l *LogStorage) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tmpPath := l.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(l.index))
+	for k := range l.index {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	index := make(map[string]logEntry, len(keys))
+	var size int64
+	for _, k := range keys {
+		e := l.index[k]
+		value := make([]byte, e.length)
+		if _, err = l.file.ReadAt(value, e.offset); err != nil {
+			break
+		}
+		rec := encodeLogRecord(logOpPut, k, value)
+		if _, err = tmp.WriteAt(rec, size); err != nil {
+			break
+		}
+		index[k] = logEntry{offset: size + int64(len(rec)-len(value)), length: len(value)}
+		size += int64(len(rec))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, l.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// From here the old file is unlinked, so later writes must go to the
+	// new one even if making the rename durable fails
+	l.file.Close()
+	l.file, l.size, l.index, l.garbage = tmp, size, index, 0
+	return syncDir(filepath.Dir(l.path))
+}
+
+func (l *LogStorage) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// syncDir makes the entries of dir durable; tests replace it to fail
+var syncDir = func(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+type customer struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// Usage
+func ExecuteStorageBridge() {
+	dir, err := os.MkdirTemp("", "bridge-storage-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	backends := []struct {
+		name string
+		new  func() (Storage, error)
+	}{
+		{"memory", func() (Storage, error) { return NewMemoryStorage(), nil }},
+		{"files", func() (Storage, error) { return NewFileStorage(filepath.Join(dir, "files")) }},
+		{"log", func() (Storage, error) { return OpenLogStorage(filepath.Join(dir, "data.log")) }},
+	}
+
+	for _, b := range backends {
+		s, err := b.new()
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		users := NewRepository[customer](s, "users")
+		_ = users.Put("u1", customer{Name: "Grace", Level: "gold"})
+		u, err := users.Get("u1")
+		fmt.Printf("%s storage: %+v %v\n", b.name, u, err)
+		if c, ok := s.(interface{ Close() error }); ok {
+			c.Close()
+		}
+	}
+
+	// The same domain code on top of the log backend, which survives a restart
+	logPath := filepath.Join(dir, "customers.log")
+	store, err := OpenLogStorage(logPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	customers := NewRepository[customer](store, "customers")
+	_ = customers.Put("c1", customer{Name: "Ada", Level: "bronze"})
+	_ = customers.Put("c1", customer{Name: "Ada", Level: "gold"})
+	_ = customers.Put("c2", customer{Name: "Alan", Level: "silver"})
+	_ = customers.Delete("c2")
+	fmt.Println("Garbage before compaction:", store.Garbage())
+	_ = store.Compact()
+	store.Close()
+
+	reopened, err := OpenLogStorage(logPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer reopened.Close()
+	records, _ := NewRepository[customer](reopened, "customers").List("")
+	for _, r := range records {
+		fmt.Printf("%s: %+v\n", r.ID, r.Value)
+	}
+}
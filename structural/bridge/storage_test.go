@@ -0,0 +1,321 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var storageBackends = []struct {
+	name string
+	new  func(t *testing.T) Storage
+}{
+	{"memory", func(t *testing.T) Storage { return NewMemoryStorage() }},
+	{"files", func(t *testing.T) Storage {
+		s, err := NewFileStorage(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+	{"log", func(t *testing.T) Storage {
+		s, err := OpenLogStorage(filepath.Join(t.TempDir(), "data.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}},
+}
+
+// TestStorageConformance holds every backend to the same behaviour
+func TestStorageConformance(t *testing.T) {
+	for _, b := range storageBackends {
+		t.Run(b.name, func(t *testing.T) {
+			t.Run("Missing", func(t *testing.T) { testStorageMissing(t, b.new(t)) })
+			t.Run("PutGet", func(t *testing.T) { testStoragePutGet(t, b.new(t)) })
+			t.Run("NoAliasing", func(t *testing.T) { testStorageNoAliasing(t, b.new(t)) })
+			t.Run("OverwriteDelete", func(t *testing.T) { testStorageOverwriteDelete(t, b.new(t)) })
+			t.Run("Keys", func(t *testing.T) { testStorageKeys(t, b.new(t)) })
+		})
+	}
+}
+
+func testStorageMissing(t *testing.T, s Storage) {
+	if _, err := s.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get missing: want ErrKeyNotFound, got %v", err)
+	}
+	if err := s.Delete("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Delete missing: want ErrKeyNotFound, got %v", err)
+	}
+}
+
+// storageValues covers awkward keys: empty, file system metacharacters and
+// one far longer than any file name may be
+var storageValues = map[string]string{
+	"user/1":                            "ada",
+	"user/2":                            "alan",
+	"user/10":                           "grace",
+	"order/1":                           "books",
+	"odd key/ä?*:\\":                    "any key must work",
+	"empty value":                       "",
+	"":                                  "the empty key",
+	"..":                                "not the parent directory",
+	"long/" + strings.Repeat("x", 1000): "longer than NAME_MAX",
+}
+
+func testStoragePutGet(t *testing.T, s Storage) {
+	for k, v := range storageValues {
+		if err := s.Put(k, []byte(v)); err != nil {
+			t.Errorf("Put %.20q: %v", k, err)
+		}
+	}
+	for k, v := range storageValues {
+		if got, err := s.Get(k); err != nil || string(got) != v {
+			t.Errorf("Get %.20q: got %q, %v; want %q", k, got, err, v)
+		}
+	}
+}
+
+// Values must not alias the caller's buffers
+func testStorageNoAliasing(t *testing.T, s Storage) {
+	buf := []byte("original")
+	if err := s.Put("alias", buf); err != nil {
+		t.Fatal(err)
+	}
+	buf[0] = 'X'
+	got, err := s.Get("alias")
+	if err != nil || string(got) != "original" {
+		t.Fatalf("Put kept a reference to the caller's slice: got %q, %v", got, err)
+	}
+	got[0] = 'Y'
+	if again, _ := s.Get("alias"); string(again) != "original" {
+		t.Errorf("Get returned an internal slice: got %q", again)
+	}
+}
+
+func testStorageOverwriteDelete(t *testing.T, s Storage) {
+	for _, k := range []string{"user/2", "", "long/" + strings.Repeat("y", 500)} {
+		if err := s.Put(k, []byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(k, []byte("second")); err != nil {
+			t.Fatalf("overwrite %.20q: %v", k, err)
+		}
+		if got, err := s.Get(k); err != nil || string(got) != "second" {
+			t.Errorf("overwrite %.20q: got %q, %v", k, got, err)
+		}
+		if err := s.Delete(k); err != nil {
+			t.Errorf("Delete %.20q: %v", k, err)
+		}
+		if _, err := s.Get(k); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Get %.20q after Delete: want ErrKeyNotFound, got %v", k, err)
+		}
+	}
+}
+
+func testStorageKeys(t *testing.T, s Storage) {
+	long := "user/" + strings.Repeat("z", 400)
+	for _, k := range []string{"user/1", "user/2", "user/10", "order/1", "", long} {
+		if err := s.Put(k, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := s.Keys("user/")
+	if want := []string{"user/1", "user/10", "user/2", long}; err != nil || !slices.Equal(keys, want) {
+		t.Errorf("Keys(user/): got %.30q, %v; want %.30q", keys, err, want)
+	}
+	all, err := s.Keys("")
+	if err != nil || len(all) != 6 || all[0] != "" {
+		t.Errorf("Keys(\"\"): got %.30q, %v; want all 6 keys starting with the empty one", all, err)
+	}
+	if keys, err := s.Keys("nope/"); err != nil || len(keys) != 0 {
+		t.Errorf("Keys(nope/): got %q, %v; want none", keys, err)
+	}
+}
+
+func TestFileStorageNames(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"", "a", strings.Repeat("k", 1000)} {
+		if err := s.Put(k, []byte("v")); err != nil {
+			t.Fatalf("Put %.20q: %v", k, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d files; want 3", len(entries))
+	}
+	for _, e := range entries {
+		if len(e.Name()) > maxFileNameLen || e.IsDir() {
+			t.Errorf("bad file %q", e.Name())
+		}
+	}
+	// Files that are not ours are left alone
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.Keys(""); err != nil || len(keys) != 3 {
+		t.Errorf("Keys with a foreign file: got %d keys, %v", len(keys), err)
+	}
+}
+
+func TestLogStorageReopenAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	s, err := OpenLogStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("a", []byte("1"))
+	s.Put("a", []byte("2"))
+	s.Put("b", []byte("3"))
+	s.Delete("b")
+	if got := s.Garbage(); got != 3 {
+		t.Errorf("Garbage() = %d; want 3", got)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Garbage(); got != 0 {
+		t.Errorf("Garbage() after Compact = %d; want 0", got)
+	}
+	s.Put("c", []byte("4"))
+	s.Close()
+
+	s, err = OpenLogStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	keys, _ := s.Keys("")
+	if !slices.Equal(keys, []string{"a", "c"}) {
+		t.Errorf("keys after reopen = %q", keys)
+	}
+	if got, err := s.Get("a"); err != nil || string(got) != "2" {
+		t.Errorf("Get(a) after reopen = %q, %v", got, err)
+	}
+}
+
+// When the rename succeeds but the directory cannot be synced, the store
+// must already be using the compacted file, or later writes would go to the
+// unlinked old one
+func TestLogStorageCompactSyncDirFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	s, err := OpenLogStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("a", []byte("1"))
+	s.Put("a", []byte("2"))
+
+	failed := errors.New("fsync failed")
+	saved := syncDir
+	syncDir = func(string) error { return failed }
+	t.Cleanup(func() { syncDir = saved })
+	if err := s.Compact(); !errors.Is(err, failed) {
+		t.Fatalf("Compact = %v; want the sync error", err)
+	}
+	syncDir = saved
+	if got := s.Garbage(); got != 0 {
+		t.Errorf("Garbage() = %d; want the compacted file's 0", got)
+	}
+	if err := errors.Join(s.Put("b", []byte("3")), s.Delete("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenLogStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	keys, _ := reopened.Keys("")
+	if !slices.Equal(keys, []string{"b"}) {
+		t.Errorf("keys on disk = %q; want the writes made after Compact", keys)
+	}
+}
+
+// A damaged tail is dropped on replay, whatever its length fields claim
+func TestLogStorageDamagedTail(t *testing.T) {
+	huge := binary.AppendUvarint([]byte{logOpPut}, 1<<62)
+	huge = binary.AppendUvarint(huge, 1)
+	hugeValue := binary.AppendUvarint([]byte{logOpPut}, 1)
+	hugeValue = binary.AppendUvarint(hugeValue, 1<<62)
+	hugeValue = append(hugeValue, 'k')
+	overflow := binary.AppendUvarint([]byte{logOpPut}, 1<<63)
+	overflow = binary.AppendUvarint(overflow, 1<<63)
+
+	tails := map[string][]byte{
+		"huge key length":   huge,
+		"huge value length": hugeValue,
+		"overflowing sum":   overflow,
+		"torn record":       encodeLogRecord(logOpPut, "b", []byte("value"))[:6],
+		"half a varint":     {logOpPut, 0x80},
+	}
+	for name, tail := range tails {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.log")
+			good := encodeLogRecord(logOpPut, "a", []byte("kept"))
+			if err := os.WriteFile(path, append(good, tail...), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := OpenLogStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if got, err := s.Get("a"); err != nil || string(got) != "kept" {
+				t.Errorf("Get(a) = %q, %v", got, err)
+			}
+			if keys, _ := s.Keys(""); len(keys) != 1 {
+				t.Errorf("keys = %q; want only a", keys)
+			}
+			// The tail is cut off so new records follow the good one
+			if info, _ := os.Stat(path); info.Size() != int64(len(good)) {
+				t.Errorf("log is %d bytes; want %d", info.Size(), len(good))
+			}
+		})
+	}
+}
+
+func TestLogStorageUnknownOp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	if err := os.WriteFile(path, encodeLogRecord('X', "a", nil), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLogStorage(path); err == nil || !strings.Contains(err.Error(), "unknown op") {
+		t.Errorf("OpenLogStorage on a corrupt log: got %v", err)
+	}
+}
+
+func TestRepositoryList(t *testing.T) {
+	type item struct{ N int }
+	s := NewMemoryStorage()
+	items := NewRepository[item](s, "items")
+	other := NewRepository[item](s, "other")
+	items.Put("b", item{2})
+	items.Put("a", item{1})
+	other.Put("a", item{9})
+
+	records, err := items.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record[item]{{"a", item{1}}, {"b", item{2}}}
+	if !slices.Equal(records, want) {
+		t.Errorf("List = %+v; want %+v", records, want)
+	}
+	if _, err := items.Get("c"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get missing: %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package composite
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 /*
 =================================
@@ -29,21 +33,36 @@ type Component interface {
 
 // Leaf is a simple element (e.g., file)
 type Leaf struct {
-	Name string
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Attrs   map[string]string
+
+	parent *Composite
 }
 
 func (l *Leaf) Display(indent string) {
 	fmt.Println(indent + "- " + l.Name)
 }
 
-// Composite can hold other components (e.g., folder)
+// Composite can hold other components (e.g., folder). A tree built with
+// Children literals has no parent links until Link is called.
 type Composite struct {
 	Name     string
+	ModTime  time.Time
+	Attrs    map[string]string
 	Children []Component
+	// UniqueNames rejects a child whose name is already taken in this folder
+	UniqueNames bool
+
+	parent *Composite
 }
 
-func (c *Composite) Add(child Component) {
-	c.Children = append(c.Children, child)
+// Add appends child, refusing anything that would break the tree: a child
+// that already has a parent, a folder added under itself, or a duplicate
+// name when UniqueNames is set
+func (c *Composite) Add(child Component) error {
+	return c.Insert(len(c.Children), child)
 }
 
 func (c *Composite) Display(indent string) {
@@ -60,11 +79,24 @@ func ExecuteCompositePattern() {
 	file2 := &Leaf{Name: "File2"}
 
 	subFolder := &Composite{Name: "SubFolder"}
-	subFolder.Add(&Leaf{Name: "File3"})
-
-	root.Add(file1)
-	root.Add(file2)
-	root.Add(subFolder)
+	if err := errors.Join(
+		subFolder.Add(&Leaf{Name: "File3"}),
+		root.Add(file1),
+		root.Add(file2),
+		root.Add(subFolder),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	root.Display("")
+
+	ExecuteFilesystemComposite()
+	ExecuteTreeOperations()
+	ExecuteSerialization()
+	ExecuteRendering()
+	ExecuteParallelTraversal()
+	ExecuteDiff()
+	ExecuteQueries()
+	ExecuteTypedComposite()
 }
@@ -0,0 +1,448 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+/*
+Diff and patch
+
+Compare describes how one tree differs from another as a list of changes:
+nodes added, removed, moved (same content at a new path) and changed (same
+path, different details), plus folders whose children changed order. Apply
+replays the changes on the first tree to turn it into the second, and
+WriteUnified prints them for review. Paths are relative to the roots and
+assume unique child names.
+*/
+
+// ChangeKind says what happened to a node
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Moved
+	Changed
+	Reordered
+)
+
+func (k ChangeKind) String() string {
+	return [...]string{"added", "removed", "moved", "changed", "reordered"}[k]
+}
+
+// Change is one difference between two trees
+type Change struct {
+	Kind ChangeKind
+	// Path is where the node is in the old tree; for Added, in the new tree
+	Path string
+	// To is the new path of a Moved node
+	To string
+	// Index is the position among its new siblings of an Added or Moved node
+	Index int
+	// Old and New describe the node before and after, where they apply
+	Old, New NodeData
+	// Order lists the new child names of a Reordered folder
+	Order []string
+}
+
+// Diff is an ordered list of changes
+type Diff []Change
+
+// flatNode is one node of a flattened tree
+type flatNode struct {
+	data   NodeData
+	parent string
+	index  int
+}
+
+// flatten maps every path under and including the root, which is "", to its node
+func flatten(d NodeData, p, parent string, index int, out map[string]flatNode) error {
+	if _, dup := out[p]; dup {
+		return fmt.Errorf("composite: duplicate path %q; diff needs unique child names", p)
+	}
+	out[p] = flatNode{data: d, parent: parent, index: index}
+	for i, c := range d.Children {
+		if err := flatten(c, path.Join(p, c.Name), p, i, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameDetails compares a node without its name and children
+func sameDetails(a, b NodeData) bool {
+	return a.Kind == b.Kind && a.Size == b.Size && a.ModTime.Equal(b.ModTime) && maps.Equal(a.Attrs, b.Attrs)
+}
+
+// sameContent compares whole subtrees, ignoring the name of the top node
+func sameContent(a, b NodeData) bool {
+	a.Name, b.Name = "", ""
+	ja, _ := json.Marshal(toJSONNode(a))
+	jb, _ := json.Marshal(toJSONNode(b))
+	return bytes.Equal(ja, jb)
+}
+
+func sortedPaths(m map[string]flatNode) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// Compare returns the changes that turn the tree old into the tree new
+func Compare(old, new Component) (Diff, error) {
+	od, err := DefaultRegistry.Encode(old)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := DefaultRegistry.Encode(new)
+	if err != nil {
+		return nil, err
+	}
+	before, after := map[string]flatNode{}, map[string]flatNode{}
+	if err := flatten(od, "", "", 0, before); err != nil {
+		return nil, err
+	}
+	if err := flatten(nd, "", "", 0, after); err != nil {
+		return nil, err
+	}
+	if od.Kind != nd.Kind {
+		return nil, fmt.Errorf("composite: cannot compare a %s with a %s", od.Kind, nd.Kind)
+	}
+
+	// A node is replaced when its kind changed; only the topmost removed
+	// and added nodes are recorded, their subtrees go with them
+	gone := func(p string) bool {
+		a, ok := after[p]
+		return p != "" && (!ok || a.data.Kind != before[p].data.Kind)
+	}
+	fresh := func(p string) bool {
+		b, ok := before[p]
+		return p != "" && (!ok || b.data.Kind != after[p].data.Kind)
+	}
+
+	var diff Diff
+	var removed, added []string
+	for _, p := range sortedPaths(before) {
+		b := before[p]
+		switch {
+		case gone(p):
+			if !gone(b.parent) {
+				removed = append(removed, p)
+			}
+		// Paths carry the names of everything but the root
+		case !sameDetails(b.data, after[p].data) || (p == "" && od.Name != nd.Name):
+			diff = append(diff, Change{Kind: Changed, Path: p, Old: withoutChildren(b.data), New: withoutChildren(after[p].data)})
+		}
+	}
+	for _, p := range sortedPaths(after) {
+		if fresh(p) && !fresh(after[p].parent) {
+			added = append(added, p)
+		}
+	}
+
+	// A removed and an added subtree with the same content are a move
+	for _, r := range slices.Clone(removed) {
+		for _, a := range added {
+			if r == a || !sameContent(before[r].data, after[a].data) {
+				continue
+			}
+			diff = append(diff, Change{Kind: Moved, Path: r, To: a, Index: after[a].index, Old: before[r].data, New: after[a].data})
+			removed = slices.DeleteFunc(removed, func(p string) bool { return p == r })
+			added = slices.DeleteFunc(added, func(p string) bool { return p == a })
+			break
+		}
+	}
+	for _, r := range removed {
+		diff = append(diff, Change{Kind: Removed, Path: r, Old: before[r].data})
+	}
+	for _, a := range added {
+		diff = append(diff, Change{Kind: Added, Path: a, Index: after[a].index, New: after[a].data})
+	}
+
+	// Folders whose surviving children changed their relative order
+	for _, p := range sortedPaths(before) {
+		if _, ok := after[p]; !ok || before[p].data.Kind != after[p].data.Kind || len(after[p].data.Children) == 0 {
+			continue
+		}
+		oldKids, newKids := before[p].data, after[p].data
+		if order := childOrder(newKids); !slices.Equal(common(childOrder(oldKids), order), common(order, childOrder(oldKids))) {
+			diff = append(diff, Change{Kind: Reordered, Path: p, Order: order})
+		}
+	}
+	return diff, nil
+}
+
+func withoutChildren(d NodeData) NodeData {
+	d.Children = nil
+	return d
+}
+
+func childOrder(d NodeData) []string {
+	names := make([]string, len(d.Children))
+	for i, c := range d.Children {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// common keeps the names of a that also appear in b, in a's order
+func common(a, b []string) []string {
+	return slices.DeleteFunc(slices.Clone(a), func(s string) bool { return !slices.Contains(b, s) })
+}
+
+// Apply turns root, which must look like the old tree given to Compare,
+// into the new tree. Changes are applied in a safe order: details, then
+// moves out and removals, then additions and moves in, then reordering.
+func (d Diff) Apply(root *Composite) error {
+	find := func(p string) (Component, error) {
+		return root.Find(p)
+	}
+	folderAt := func(p string) (*Composite, error) {
+		c, err := find(p)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := c.(*Composite)
+		if !ok {
+			return nil, fmt.Errorf("composite: patch: %s is not a folder", p)
+		}
+		return f, nil
+	}
+
+	for _, ch := range d {
+		if ch.Kind != Changed {
+			continue
+		}
+		c, err := find(ch.Path)
+		if err != nil {
+			return fmt.Errorf("composite: patch %s %s: %w", ch.Kind, ch.Path, err)
+		}
+		if ch.Path == "" {
+			root.Name = ch.New.Name
+		}
+		switch c := c.(type) {
+		case *Leaf:
+			c.Size, c.ModTime, c.Attrs = ch.New.Size, ch.New.ModTime, maps.Clone(ch.New.Attrs)
+		case *Composite:
+			c.ModTime, c.Attrs = ch.New.ModTime, maps.Clone(ch.New.Attrs)
+		default:
+			return fmt.Errorf("composite: patch: cannot change %T at %s", c, ch.Path)
+		}
+	}
+
+	// Detach moved and removed nodes before anything is inserted
+	detached := map[string]Node{}
+	for _, ch := range d {
+		if ch.Kind != Moved && ch.Kind != Removed {
+			continue
+		}
+		c, err := find(ch.Path)
+		if err != nil {
+			return fmt.Errorf("composite: patch %s %s: %w", ch.Kind, ch.Path, err)
+		}
+		n, ok := c.(Node)
+		if !ok || n.Parent() == nil {
+			return fmt.Errorf("composite: patch: cannot detach %s", ch.Path)
+		}
+		if err := n.Parent().Remove(n); err != nil {
+			return err
+		}
+		if ch.Kind == Moved {
+			detached[ch.Path] = n
+		}
+	}
+
+	// Insert parents before children, each at its final index
+	inserts := slices.DeleteFunc(slices.Clone(d), func(ch Change) bool { return ch.Kind != Added && ch.Kind != Moved })
+	slices.SortStableFunc(inserts, func(a, b Change) int {
+		if da, db := strings.Count(insertPath(a), "/"), strings.Count(insertPath(b), "/"); da != db {
+			return da - db
+		}
+		return a.Index - b.Index
+	})
+	for _, ch := range inserts {
+		target := insertPath(ch)
+		parent, err := folderAt(path.Dir(target))
+		if err != nil {
+			return fmt.Errorf("composite: patch %s %s: %w", ch.Kind, target, err)
+		}
+		var child Component
+		if ch.Kind == Moved {
+			n := detached[ch.Path]
+			renameNode(n, path.Base(target))
+			child = n
+		} else if child, err = DefaultRegistry.Decode(ch.New); err != nil {
+			return err
+		}
+		if err := parent.Insert(ch.Index, child); err != nil {
+			return fmt.Errorf("composite: patch %s %s: %w", ch.Kind, target, err)
+		}
+	}
+
+	for _, ch := range d {
+		if ch.Kind != Reordered {
+			continue
+		}
+		folder, err := folderAt(ch.Path)
+		if err != nil {
+			return fmt.Errorf("composite: patch %s %s: %w", ch.Kind, ch.Path, err)
+		}
+		slices.SortStableFunc(folder.Children, func(a, b Component) int {
+			return slices.Index(ch.Order, NameOf(a)) - slices.Index(ch.Order, NameOf(b))
+		})
+	}
+	return nil
+}
+
+func insertPath(ch Change) string {
+	if ch.Kind == Moved {
+		return ch.To
+	}
+	return ch.Path
+}
+
+func renameNode(n Node, name string) {
+	switch n := n.(type) {
+	case *Leaf:
+		n.Name = name
+	case *Composite:
+		n.Name = name
+	}
+}
+
+// WriteUnified prints the diff one change per line: "-" removed, "+" added
+// (with everything under it), "~" changed, ">" moved, "=" reordered
+func (d Diff) WriteUnified(w io.Writer, oldName, newName string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, ch := range d {
+		switch ch.Kind {
+		case Removed:
+			writeSubtree(&b, "-", ch.Path, ch.Old)
+		case Added:
+			writeSubtree(&b, "+", ch.Path, ch.New)
+		case Moved:
+			fmt.Fprintf(&b, "> %s -> %s\n", ch.Path, ch.To)
+		case Changed:
+			p := ch.Path
+			if p == "" {
+				p = "/"
+			}
+			fmt.Fprintf(&b, "~ %s: %s\n", p, describeChange(ch.Old, ch.New))
+		case Reordered:
+			fmt.Fprintf(&b, "= %s/: %s\n", ch.Path, strings.Join(ch.Order, ", "))
+		}
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func writeSubtree(b *bytes.Buffer, mark, p string, d NodeData) {
+	suffix := ""
+	if len(d.Children) > 0 || d.Kind == "folder" {
+		suffix = "/"
+	}
+	fmt.Fprintf(b, "%s %s%s\n", mark, p, suffix)
+	for _, c := range d.Children {
+		writeSubtree(b, mark, path.Join(p, c.Name), c)
+	}
+}
+
+func describeChange(old, new NodeData) string {
+	var parts []string
+	if old.Name != new.Name {
+		parts = append(parts, fmt.Sprintf("name %q -> %q", old.Name, new.Name))
+	}
+	if old.Size != new.Size {
+		parts = append(parts, fmt.Sprintf("size %d -> %d", old.Size, new.Size))
+	}
+	if !old.ModTime.Equal(new.ModTime) {
+		parts = append(parts, fmt.Sprintf("modtime %s -> %s", formatTime(old.ModTime), formatTime(new.ModTime)))
+	}
+	for _, k := range slices.Sorted(maps.Keys(maps.Collect(func(yield func(string, bool) bool) {
+		for k := range old.Attrs {
+			yield(k, true)
+		}
+		for k := range new.Attrs {
+			yield(k, true)
+		}
+	}))) {
+		ov, inOld := old.Attrs[k]
+		nv, inNew := new.Attrs[k]
+		switch {
+		case !inOld:
+			parts = append(parts, fmt.Sprintf("%s +%q", k, nv))
+		case !inNew:
+			parts = append(parts, fmt.Sprintf("%s -%q", k, ov))
+		case ov != nv:
+			parts = append(parts, fmt.Sprintf("%s %q -> %q", k, ov, nv))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Usage
+func ExecuteDiff() {
+	build := func(env string, workerIn string, extra bool) (*Composite, error) {
+		root := &Composite{Name: "config", UniqueNames: true}
+		services := &Composite{Name: "services", UniqueNames: true}
+		archive := &Composite{Name: "archive", UniqueNames: true}
+		errs := []error{
+			root.Add(services),
+			root.Add(archive),
+			services.Add(&Leaf{Name: "api.yaml", Size: 120, Attrs: map[string]string{"env": env}}),
+		}
+		if workerIn == "services" {
+			errs = append(errs, services.Add(&Leaf{Name: "worker.yaml", Size: 80}))
+		} else {
+			errs = append(errs, archive.Add(&Leaf{Name: "worker.yaml", Size: 80}))
+		}
+		if extra {
+			errs = append(errs, services.Add(&Leaf{Name: "cron.yaml", Size: 30}))
+		} else {
+			errs = append(errs, root.Add(&Leaf{Name: "legacy.ini", Size: 10}))
+		}
+		return root, errors.Join(errs...)
+	}
+
+	before, err := build("staging", "services", false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	after, err := build("prod", "archive", true)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	after.Children[0], after.Children[1] = after.Children[1], after.Children[0]
+	after.Attrs = map[string]string{"release": "v2"}
+
+	diff, err := Compare(before, after)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := diff.WriteUnified(os.Stdout, "config@v1", "config@v2"); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := diff.Apply(before); err != nil {
+		fmt.Println(err)
+		return
+	}
+	remaining, err := Compare(before, after)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("after patch: %d differences\n", len(remaining))
+}
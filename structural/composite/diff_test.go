@@ -0,0 +1,133 @@
+package composite
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var diffTime = time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+// diffBase is the tree every case edits into its new version
+func diffBase() *Composite {
+	return &Composite{Name: "config", Attrs: map[string]string{"owner": "ops"}, Children: []Component{
+		&Composite{Name: "services", Children: []Component{
+			&Leaf{Name: "api.yaml", Size: 120, Attrs: map[string]string{"env": "staging"}},
+			&Leaf{Name: "worker.yaml", Size: 80},
+		}},
+		&Composite{Name: "archive"},
+		&Leaf{Name: "legacy.ini", Size: 10},
+	}}
+}
+
+func folderAt(t *testing.T, root *Composite, p string) *Composite {
+	t.Helper()
+	c, err := root.Find(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*Composite)
+}
+
+func TestApplyCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(t *testing.T, root *Composite)
+	}{
+		{"nothing", func(t *testing.T, root *Composite) {}},
+		{"root attrs", func(t *testing.T, root *Composite) { root.Attrs = map[string]string{"owner": "dev", "tier": "1"} }},
+		{"root modtime", func(t *testing.T, root *Composite) { root.ModTime = diffTime }},
+		{"root name", func(t *testing.T, root *Composite) { root.Name = "settings" }},
+		{"leaf details", func(t *testing.T, root *Composite) {
+			api := folderAt(t, root, "services").Children[0].(*Leaf)
+			api.Size, api.ModTime, api.Attrs = 130, diffTime, nil
+		}},
+		{"folder details", func(t *testing.T, root *Composite) {
+			folderAt(t, root, "archive").Attrs = map[string]string{"frozen": "yes"}
+		}},
+		{"add and remove", func(t *testing.T, root *Composite) {
+			root.Children = root.Children[:2]
+			folderAt(t, root, "archive").Children = []Component{&Composite{Name: "2023", Children: []Component{&Leaf{Name: "old.yaml"}}}}
+		}},
+		{"move", func(t *testing.T, root *Composite) {
+			services := folderAt(t, root, "services")
+			worker := services.Children[1]
+			services.Children = services.Children[:1]
+			folderAt(t, root, "archive").Children = []Component{worker}
+		}},
+		{"move and rename", func(t *testing.T, root *Composite) {
+			root.Children = root.Children[:2]
+			folderAt(t, root, "archive").Children = []Component{&Leaf{Name: "legacy.ini.bak", Size: 10}}
+		}},
+		{"reorder", func(t *testing.T, root *Composite) {
+			root.Children[0], root.Children[2] = root.Children[2], root.Children[0]
+		}},
+		{"replace a file with a folder", func(t *testing.T, root *Composite) {
+			root.Children[2] = &Composite{Name: "legacy.ini", Children: []Component{&Leaf{Name: "inside"}}}
+		}},
+		{"everything at once", func(t *testing.T, root *Composite) {
+			root.Name, root.Attrs = "settings", nil
+			root.Children[0], root.Children[1] = root.Children[1], root.Children[0]
+			services := folderAt(t, root, "services")
+			services.Children = append(services.Children[:1], &Leaf{Name: "cron.yaml", Size: 30})
+			services.Children[0].(*Leaf).Attrs = map[string]string{"env": "prod"}
+			folderAt(t, root, "archive").Children = []Component{&Leaf{Name: "worker.yaml", Size: 80}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := diffBase(), diffBase()
+			tt.edit(t, b)
+			if err := Link(a); err != nil {
+				t.Fatal(err)
+			}
+
+			diff, err := Compare(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.name != "nothing" && len(diff) == 0 {
+				t.Fatal("Compare found no difference")
+			}
+			if err := diff.Apply(a); err != nil {
+				t.Fatal(err)
+			}
+			if rest, err := Compare(a, b); err != nil || len(rest) != 0 {
+				var out strings.Builder
+				rest.WriteUnified(&out, "patched", "want")
+				t.Errorf("after Apply, %v:\n%s", err, out.String())
+			}
+			if a.Name != b.Name {
+				t.Errorf("root name = %q; want %q", a.Name, b.Name)
+			}
+		})
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	if _, err := Compare(diffBase(), &Leaf{Name: "config"}); err == nil {
+		t.Error("Compare of a folder with a file succeeded")
+	}
+	dup := &Composite{Name: "x", Children: []Component{&Leaf{Name: "a"}, &Leaf{Name: "a"}}}
+	if _, err := Compare(dup, diffBase()); err == nil || !strings.Contains(err.Error(), "duplicate path") {
+		t.Errorf("Compare with duplicate names: error = %v", err)
+	}
+}
+
+func TestWriteUnified(t *testing.T) {
+	a, b := diffBase(), diffBase()
+	b.Attrs["owner"] = "dev"
+	b.Children = b.Children[:2]
+	diff, err := Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := diff.WriteUnified(&out, "v1", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	want := "--- v1\n+++ v2\n~ /: owner \"ops\" -> \"dev\"\n- legacy.ini\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
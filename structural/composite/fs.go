@@ -0,0 +1,217 @@
+package composite
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+/*
+Composite trees from a filesystem
+
+FromFS and FromDir turn a directory into a Composite of Composites (folders)
+and Leaves (files). Leaves carry their size and modification time, and
+SizeOf and CountFiles aggregate them recursively, which is all a du-like
+report needs.
+*/
+
+// FromFS builds a tree from the directory root of fsys
+func FromFS(fsys fs.FS, root string) (*Composite, error) {
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("composite: %s is not a directory", root)
+	}
+	name := path.Base(root)
+	if root == "." {
+		name = "."
+	}
+	return buildFolder(fsys, root, name, info.ModTime())
+}
+
+// FromDir builds a tree from a directory on disk
+func FromDir(dir string) (*Composite, error) {
+	c, err := FromFS(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+	c.Name = filepath.Base(filepath.Clean(dir))
+	return c, nil
+}
+
+func buildFolder(fsys fs.FS, dir, name string, modTime time.Time) (*Composite, error) {
+	folder := &Composite{Name: name, ModTime: modTime}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if e.IsDir() {
+			child, err := buildFolder(fsys, path.Join(dir, e.Name()), e.Name(), info.ModTime())
+			if err != nil {
+				return nil, err
+			}
+			if err := folder.Add(child); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := folder.Add(&Leaf{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+			return nil, err
+		}
+	}
+	return folder, nil
+}
+
+// SizeOf returns the size of a leaf or the total size of everything under a folder
+func SizeOf(c Component) int64 {
+	switch c := c.(type) {
+	case *Leaf:
+		return c.Size
+	case *Composite:
+		var total int64
+		for _, child := range c.Children {
+			total += SizeOf(child)
+		}
+		return total
+	}
+	return 0
+}
+
+// CountFiles returns the number of leaves at or under c
+func CountFiles(c Component) int {
+	switch c := c.(type) {
+	case *Leaf:
+		return 1
+	case *Composite:
+		n := 0
+		for _, child := range c.Children {
+			n += CountFiles(child)
+		}
+		return n
+	}
+	return 0
+}
+
+// LatestModTime returns the newest modification time at or under c
+func LatestModTime(c Component) time.Time {
+	switch c := c.(type) {
+	case *Leaf:
+		return c.ModTime
+	case *Composite:
+		latest := c.ModTime
+		for _, child := range c.Children {
+			if t := LatestModTime(child); t.After(latest) {
+				latest = t
+			}
+		}
+		return latest
+	}
+	return time.Time{}
+}
+
+// WriteDiskUsage writes one line per folder, children before parents like
+// du: total size, file count and path. With human set, sizes use K, M, G.
+func WriteDiskUsage(w io.Writer, root *Composite, human bool) error {
+	return writeDiskUsage(w, root, root.Name, human)
+}
+
+func writeDiskUsage(w io.Writer, folder *Composite, p string, human bool) error {
+	for _, child := range folder.Children {
+		if sub, ok := child.(*Composite); ok {
+			if err := writeDiskUsage(w, sub, path.Join(p, sub.Name), human); err != nil {
+				return err
+			}
+		}
+	}
+	size := fmt.Sprint(SizeOf(folder))
+	if human {
+		size = humanSize(SizeOf(folder))
+	}
+	_, err := fmt.Fprintf(w, "%-8s %6d files  %s\n", size, CountFiles(folder), p)
+	return err
+}
+
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Usage
+func ExecuteFilesystemComposite() {
+	dir, err := os.MkdirTemp("", "composite-fs-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	mod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := []struct {
+		path    string
+		size    int
+		modTime time.Time
+	}{
+		{"project/README.md", 1200, mod},
+		{"project/go.mod", 40, mod},
+		{"project/cmd/app/main.go", 2048, mod.Add(time.Hour)},
+		{"project/internal/db/db.go", 5000, mod},
+		{"project/internal/db/sql.go", 3000, mod},
+		{"project/assets/logo.png", 150_000, mod},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.path))
+		err := os.MkdirAll(filepath.Dir(p), 0o755)
+		if err == nil {
+			err = os.WriteFile(p, make([]byte, f.size), 0o644)
+		}
+		if err == nil {
+			err = os.Chtimes(p, f.modTime, f.modTime)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// Creating the files touched the folders; give them a fixed time too
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return os.Chtimes(p, mod, mod)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	root, err := FromDir(filepath.Join(dir, "project"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	root.Display("")
+	fmt.Printf("%d files, %d bytes, last change %s\n", CountFiles(root), SizeOf(root), LatestModTime(root).UTC().Format(time.RFC3339))
+	if err := WriteDiskUsage(os.Stdout, root, true); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,110 @@
+package composite
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var fsMod = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func projectFS() fstest.MapFS {
+	return fstest.MapFS{
+		"project/README.md":          {Data: make([]byte, 1200), ModTime: fsMod},
+		"project/go.mod":             {Data: make([]byte, 40), ModTime: fsMod},
+		"project/cmd/app/main.go":    {Data: make([]byte, 2048), ModTime: fsMod.Add(time.Hour)},
+		"project/internal/db/db.go":  {Data: make([]byte, 5000), ModTime: fsMod},
+		"project/internal/db/sql.go": {Data: make([]byte, 3000), ModTime: fsMod},
+		"project/assets/logo.png":    {Data: make([]byte, 150_000), ModTime: fsMod},
+		"project/empty":              {Mode: fs.ModeDir, ModTime: fsMod},
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	root, err := FromFS(projectFS(), "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "project" {
+		t.Errorf("root name = %q", root.Name)
+	}
+	if got := CountFiles(root); got != 6 {
+		t.Errorf("CountFiles = %d; want 6", got)
+	}
+	if got := SizeOf(root); got != 161_288 {
+		t.Errorf("SizeOf = %d; want 161288", got)
+	}
+	if got := LatestModTime(root); !got.Equal(fsMod.Add(time.Hour)) {
+		t.Errorf("LatestModTime = %v; want %v", got, fsMod.Add(time.Hour))
+	}
+
+	db, err := root.Find("internal/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := SizeOf(db); got != 8000 {
+		t.Errorf("SizeOf(internal/db) = %d; want 8000", got)
+	}
+	empty, err := root.Find("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folder, ok := empty.(*Composite); !ok || len(folder.Children) != 0 || SizeOf(folder) != 0 {
+		t.Errorf("empty folder = %#v", empty)
+	}
+	// Children are linked to their folder
+	if parent := db.(*Composite).Children[0].(*Leaf).Parent(); parent != db {
+		t.Errorf("db.go parent = %v; want internal/db", parent)
+	}
+}
+
+func TestFromFSErrors(t *testing.T) {
+	if _, err := FromFS(projectFS(), "project/go.mod"); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("FromFS on a file: error = %v", err)
+	}
+	if _, err := FromFS(projectFS(), "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("FromFS on a missing directory: error = %v; want fs.ErrNotExist", err)
+	}
+}
+
+func TestWriteDiskUsage(t *testing.T) {
+	root, err := FromFS(projectFS(), "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := WriteDiskUsage(&b, root, true); err != nil {
+		t.Fatal(err)
+	}
+	want := `146.5K        1 files  project/assets
+2.0K          1 files  project/cmd/app
+2.0K          1 files  project/cmd
+0B            0 files  project/empty
+7.8K          2 files  project/internal/db
+7.8K          2 files  project/internal
+157.5K        6 files  project
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	b.Reset()
+	if err := WriteDiskUsage(&b, root, false); err != nil {
+		t.Fatal(err)
+	}
+	if last := strings.Split(strings.TrimSpace(b.String()), "\n"); !strings.HasPrefix(last[len(last)-1], "161288 ") {
+		t.Errorf("exact sizes: last line = %q", last[len(last)-1])
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := map[int64]string{0: "0B", 1023: "1023B", 1024: "1.0K", 1536: "1.5K", 1 << 20: "1.0M", 5 << 30: "5.0G"}
+	for in, want := range tests {
+		if got := humanSize(in); got != want {
+			t.Errorf("humanSize(%d) = %q; want %q", in, got, want)
+		}
+	}
+}
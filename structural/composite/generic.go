@@ -0,0 +1,311 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+Typed composites
+
+Leaf and Composite describe files. TypedLeaf[T] and TypedComposite[T] carry
+any payload instead, so the same part-whole structure can model an org
+chart, a bill of materials or a UI tree. Both still satisfy Component.
+
+Operations are written once against the payload type: WalkTyped visits
+nodes top-down, Fold combines results bottom-up, and Accept runs a Visitor,
+which keeps a leaf case and a branch case side by side. Types that embed
+TypedLeaf or TypedComposite are dispatched like the type they embed.
+
+Add refuses to make a cycle, but Children can also be set directly, so the
+traversals check for one as well: WalkTyped returns ErrCycle and Fold and
+Accept panic with it rather than recurse forever.
+*/
+
+// TypedComponent is a node of a typed tree
+type TypedComponent[T any] interface {
+	Component
+	Payload() T
+	// Parts returns the children of a branch and nil for a leaf
+	Parts() []TypedComponent[T]
+}
+
+// TypedLeaf is a node with a payload and no children
+type TypedLeaf[T any] struct {
+	Name string
+	Data T
+}
+
+func (l *TypedLeaf[T]) Payload() T                 { return l.Data }
+func (l *TypedLeaf[T]) Parts() []TypedComponent[T] { return nil }
+func (l *TypedLeaf[T]) typedLeaf() *TypedLeaf[T]   { return l }
+
+func (l *TypedLeaf[T]) Display(indent string) {
+	fmt.Println(indent + "- " + l.Name)
+}
+
+// TypedComposite is a node with a payload and children
+type TypedComposite[T any] struct {
+	Name     string
+	Data     T
+	Children []TypedComponent[T]
+}
+
+func (c *TypedComposite[T]) Payload() T                         { return c.Data }
+func (c *TypedComposite[T]) Parts() []TypedComponent[T]         { return c.Children }
+func (c *TypedComposite[T]) typedComposite() *TypedComposite[T] { return c }
+
+func (c *TypedComposite[T]) Display(indent string) {
+	fmt.Println(indent + "+ " + c.Name)
+	for _, child := range c.Children {
+		child.Display(indent + "  ")
+	}
+}
+
+// Add appends children, refusing nil and anything that already contains c
+func (c *TypedComposite[T]) Add(children ...TypedComponent[T]) error {
+	for _, child := range children {
+		if child == nil {
+			return errors.New("composite: nil child")
+		}
+		if err := WalkTyped(child, func(n TypedComponent[T], _ int) error {
+			if b, ok := n.(typedBranch[T]); ok && b.typedComposite() == c {
+				return fmt.Errorf("%w: %s under itself", ErrCycle, c.Name)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	c.Children = append(c.Children, children...)
+	return nil
+}
+
+// typedBranch and typedLeafNode find the embedded base of a node, so a
+// Visitor sees a custom type as the leaf or branch it is built from
+type typedBranch[T any] interface {
+	typedComposite() *TypedComposite[T]
+}
+
+type typedLeafNode[T any] interface {
+	typedLeaf() *TypedLeaf[T]
+}
+
+// typedPath holds the branches between the root and the node being visited
+type typedPath[T any] map[*TypedComposite[T]]bool
+
+// enter adds c to the path, or fails if c is already on it. leave undoes it.
+func (p typedPath[T]) enter(c TypedComponent[T]) (leave func(), err error) {
+	b, ok := c.(typedBranch[T])
+	if !ok {
+		return func() {}, nil
+	}
+	branch := b.typedComposite()
+	if p[branch] {
+		return nil, fmt.Errorf("%w: %s under itself", ErrCycle, branch.Name)
+	}
+	p[branch] = true
+	return func() { delete(p, branch) }, nil
+}
+
+// SkipChildren can be returned by a WalkTyped callback to skip the children
+// of the current node without stopping the walk
+var SkipChildren = errors.New("composite: skip children")
+
+// WalkTyped calls fn for root and everything under it, parents before
+// children, with the depth of each node (0 for root). Any error other than
+// SkipChildren stops the walk and is returned, as is ErrCycle if a branch
+// turns out to be inside itself.
+func WalkTyped[T any](root TypedComponent[T], fn func(c TypedComponent[T], depth int) error) error {
+	path := typedPath[T]{}
+	var walk func(c TypedComponent[T], depth int) error
+	walk = func(c TypedComponent[T], depth int) error {
+		leave, err := path.enter(c)
+		if err != nil {
+			return err
+		}
+		defer leave()
+		if err := fn(c, depth); err != nil {
+			if errors.Is(err, SkipChildren) {
+				return nil
+			}
+			return err
+		}
+		for _, child := range c.Parts() {
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, 0)
+}
+
+// Fold combines a tree bottom-up: fn receives a node and the results of its
+// children, in order, and returns the result for the node. It panics with
+// ErrCycle if a branch is inside itself.
+func Fold[T, R any](root TypedComponent[T], fn func(c TypedComponent[T], children []R) R) R {
+	path := typedPath[T]{}
+	var fold func(c TypedComponent[T]) R
+	fold = func(c TypedComponent[T]) R {
+		leave, err := path.enter(c)
+		if err != nil {
+			panic(err)
+		}
+		defer leave()
+		parts := c.Parts()
+		results := make([]R, len(parts))
+		for i, child := range parts {
+			results[i] = fold(child)
+		}
+		return fn(c, results)
+	}
+	return fold(root)
+}
+
+// Visitor is an operation over a typed tree with one case per kind of node.
+// VisitComposite receives the results already computed for the children.
+type Visitor[T, R any] interface {
+	VisitLeaf(l *TypedLeaf[T]) R
+	VisitComposite(c *TypedComposite[T], children []R) R
+}
+
+// VisitorFuncs turns two functions into a Visitor
+type VisitorFuncs[T, R any] struct {
+	Leaf      func(l *TypedLeaf[T]) R
+	Composite func(c *TypedComposite[T], children []R) R
+}
+
+func (v VisitorFuncs[T, R]) VisitLeaf(l *TypedLeaf[T]) R { return v.Leaf(l) }
+
+func (v VisitorFuncs[T, R]) VisitComposite(c *TypedComposite[T], children []R) R {
+	return v.Composite(c, children)
+}
+
+// Accept runs v over the tree under root. Nodes that are neither a
+// TypedLeaf nor a TypedComposite, nor embed one, are visited as leaves
+// wrapping their payload.
+func Accept[T, R any](root TypedComponent[T], v Visitor[T, R]) R {
+	return Fold(root, func(c TypedComponent[T], children []R) R {
+		switch n := c.(type) {
+		case typedBranch[T]:
+			return v.VisitComposite(n.typedComposite(), children)
+		case typedLeafNode[T]:
+			return v.VisitLeaf(n.typedLeaf())
+		}
+		return v.VisitLeaf(&TypedLeaf[T]{Data: c.Payload()})
+	})
+}
+
+// Employee is the payload of the org chart example
+type Employee struct {
+	Title  string
+	Salary int
+}
+
+// PartSpec is the payload of the bill of materials example: Cost is the
+// unit cost of the part itself and Quantity how many the parent needs
+type PartSpec struct {
+	Cost     float64
+	Quantity int
+}
+
+// Widget is the payload of the UI tree example
+type Widget struct {
+	Kind    string
+	Visible bool
+}
+
+// costVisitor rolls up the cost of an assembly: each part costs its own
+// price plus its sub-parts, times the quantity its parent needs
+type costVisitor struct{}
+
+func (costVisitor) VisitLeaf(l *TypedLeaf[PartSpec]) float64 {
+	return l.Data.Cost * float64(l.Data.Quantity)
+}
+
+func (costVisitor) VisitComposite(c *TypedComposite[PartSpec], children []float64) float64 {
+	total := c.Data.Cost
+	for _, r := range children {
+		total += r
+	}
+	return total * float64(c.Data.Quantity)
+}
+
+// Usage
+func ExecuteTypedComposite() {
+	// Org chart: a branch is a manager, a leaf an individual contributor
+	cto := &TypedComposite[Employee]{Name: "Ada", Data: Employee{"CTO", 250}}
+	platform := &TypedComposite[Employee]{Name: "Grace", Data: Employee{"Platform lead", 180}}
+	if err := errors.Join(
+		platform.Add(
+			&TypedLeaf[Employee]{Name: "Linus", Data: Employee{"SRE", 140}},
+			&TypedLeaf[Employee]{Name: "Ken", Data: Employee{"SRE", 135}},
+		),
+		cto.Add(platform, &TypedLeaf[Employee]{Name: "Barbara", Data: Employee{"Architect", 190}}),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	payroll := Fold(TypedComponent[Employee](cto), func(c TypedComponent[Employee], children []int) int {
+		total := c.Payload().Salary
+		for _, r := range children {
+			total += r
+		}
+		return total
+	})
+	headcount := Accept(TypedComponent[Employee](cto), VisitorFuncs[Employee, int]{
+		Leaf: func(*TypedLeaf[Employee]) int { return 1 },
+		Composite: func(_ *TypedComposite[Employee], children []int) int {
+			n := 1
+			for _, r := range children {
+				n += r
+			}
+			return n
+		},
+	})
+	fmt.Printf("org chart: %d people, payroll %dk\n", headcount, payroll)
+
+	// Bill of materials: a bike needs two wheels, each with 32 spokes
+	wheel := &TypedComposite[PartSpec]{Name: "wheel", Data: PartSpec{Cost: 20, Quantity: 2}}
+	bike := &TypedComposite[PartSpec]{Name: "bike", Data: PartSpec{Cost: 120, Quantity: 1}}
+	if err := errors.Join(
+		wheel.Add(
+			&TypedLeaf[PartSpec]{Name: "spoke", Data: PartSpec{Cost: 0.25, Quantity: 32}},
+			&TypedLeaf[PartSpec]{Name: "tyre", Data: PartSpec{Cost: 15, Quantity: 1}},
+		),
+		bike.Add(wheel, &TypedLeaf[PartSpec]{Name: "saddle", Data: PartSpec{Cost: 25, Quantity: 1}}),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("bill of materials: bike costs %.2f\n", Accept[PartSpec, float64](bike, costVisitor{}))
+
+	// UI tree: print the visible widgets, skipping hidden panels entirely
+	window := &TypedComposite[Widget]{Name: "main", Data: Widget{"window", true}}
+	toolbar := &TypedComposite[Widget]{Name: "toolbar", Data: Widget{"panel", true}}
+	debug := &TypedComposite[Widget]{Name: "debug", Data: Widget{"panel", false}}
+	if err := errors.Join(
+		toolbar.Add(&TypedLeaf[Widget]{Name: "save", Data: Widget{"button", true}}),
+		debug.Add(&TypedLeaf[Widget]{Name: "trace", Data: Widget{"button", true}}),
+		window.Add(toolbar, debug, &TypedLeaf[Widget]{Name: "status", Data: Widget{"label", true}}),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	WalkTyped(TypedComponent[Widget](window), func(c TypedComponent[Widget], depth int) error {
+		w := c.Payload()
+		if !w.Visible {
+			return SkipChildren
+		}
+		fmt.Printf("%s%s\n", strings.Repeat("  ", depth), w.Kind)
+		return nil
+	})
+
+	if err := toolbar.Add(window); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,179 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// team embeds TypedComposite and person embeds TypedLeaf, so a Visitor sees
+// them as the branch and leaf they are built from
+type team struct{ TypedComposite[int] }
+type person struct{ TypedLeaf[int] }
+
+// bare is a node that embeds neither
+type bare int
+
+func (b bare) Display(string)               {}
+func (b bare) Payload() int                 { return int(b) }
+func (b bare) Parts() []TypedComponent[int] { return nil }
+
+// typedTree is root(1) holding a(2), team b(3) holding person c(4) and a
+// bare 5, and d(6)
+func typedTree(t *testing.T) *TypedComposite[int] {
+	t.Helper()
+	root := &TypedComposite[int]{Name: "root", Data: 1}
+	b := &team{TypedComposite[int]{Name: "b", Data: 3}}
+	if err := errors.Join(
+		b.Add(&person{TypedLeaf[int]{Name: "c", Data: 4}}, bare(5)),
+		root.Add(&TypedLeaf[int]{Name: "a", Data: 2}, b, &TypedLeaf[int]{Name: "d", Data: 6}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestFold(t *testing.T) {
+	root := typedTree(t)
+	// Children's results arrive in order, below their parent
+	got := Fold(TypedComponent[int](root), func(c TypedComponent[int], children []string) string {
+		if len(children) == 0 {
+			return fmt.Sprint(c.Payload())
+		}
+		return fmt.Sprintf("%d(%s)", c.Payload(), strings.Join(children, " "))
+	})
+	if want := "1(2 3(4 5) 6)"; got != want {
+		t.Errorf("Fold = %s; want %s", got, want)
+	}
+	leaf := Fold(TypedComponent[int](&TypedLeaf[int]{Data: 7}), func(c TypedComponent[int], children []int) int {
+		return c.Payload() + len(children)
+	})
+	if leaf != 7 {
+		t.Errorf("Fold over a leaf = %d; want 7", leaf)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	root := typedTree(t)
+	got := Accept(TypedComponent[int](root), VisitorFuncs[int, string]{
+		Leaf: func(l *TypedLeaf[int]) string { return fmt.Sprintf("leaf %q %d", l.Name, l.Data) },
+		Composite: func(c *TypedComposite[int], children []string) string {
+			return fmt.Sprintf("branch %q [%s]", c.Name, strings.Join(children, ", "))
+		},
+	})
+	want := `branch "root" [leaf "a" 2, branch "b" [leaf "c" 4, leaf "" 5], leaf "d" 6]`
+	if got != want {
+		t.Errorf("Accept =\n%s\nwant\n%s", got, want)
+	}
+
+	bike := &TypedComposite[PartSpec]{Name: "bike", Data: PartSpec{Cost: 100, Quantity: 1}}
+	wheel := &TypedComposite[PartSpec]{Name: "wheel", Data: PartSpec{Cost: 10, Quantity: 2}}
+	if err := errors.Join(
+		wheel.Add(&TypedLeaf[PartSpec]{Name: "spoke", Data: PartSpec{Cost: 0.5, Quantity: 4}}),
+		bike.Add(wheel),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if got := Accept[PartSpec, float64](bike, costVisitor{}); got != 124 {
+		t.Errorf("cost = %v; want 100 + 2*(10 + 4*0.5) = 124", got)
+	}
+}
+
+func TestWalkTyped(t *testing.T) {
+	root := typedTree(t)
+	var visited []string
+	err := WalkTyped(TypedComponent[int](root), func(c TypedComponent[int], depth int) error {
+		visited = append(visited, fmt.Sprintf("%d@%d", c.Payload(), depth))
+		if c.Payload() == 3 {
+			return SkipChildren
+		}
+		return nil
+	})
+	if got := strings.Join(visited, " "); err != nil || got != "1@0 2@1 3@1 6@1" {
+		t.Errorf("WalkTyped = %v, visited %s; want 1@0 2@1 3@1 6@1", err, got)
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = WalkTyped(TypedComponent[int](root), func(c TypedComponent[int], _ int) error {
+		visited = append(visited, fmt.Sprint(c.Payload()))
+		if c.Payload() == 4 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(visited) != 4 {
+		t.Errorf("WalkTyped = %v after %v; want stop after 4 nodes", err, visited)
+	}
+}
+
+func TestTypedAddRejectsCycles(t *testing.T) {
+	root := typedTree(t)
+	b := root.Children[1].(*team)
+	tests := []struct {
+		name   string
+		parent *TypedComposite[int]
+		child  TypedComponent[int]
+	}{
+		{"itself", root, root},
+		{"its parent", &b.TypedComposite, root},
+		{"its embedding type", &b.TypedComposite, b},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(tt.parent.Children)
+			if err := tt.parent.Add(tt.child); !errors.Is(err, ErrCycle) {
+				t.Errorf("Add = %v; want ErrCycle", err)
+			}
+			if len(tt.parent.Children) != before {
+				t.Error("a refused child was added")
+			}
+		})
+	}
+	if err := root.Add(nil); err == nil {
+		t.Error("Add(nil) succeeded")
+	}
+
+	// The same node under two parents is not a cycle
+	shared := &TypedLeaf[int]{Name: "shared"}
+	other := &TypedComposite[int]{Name: "other"}
+	if err := errors.Join(b.Add(shared), other.Add(shared), root.Add(other)); err != nil {
+		t.Errorf("sharing a node: %v", err)
+	}
+}
+
+// A cycle made through Children rather than Add is reported by every
+// traversal instead of recursing forever
+func TestTypedCycleThroughChildren(t *testing.T) {
+	root := typedTree(t)
+	b := root.Children[1].(*team)
+	b.Children = append(b.Children, root)
+
+	if err := WalkTyped(TypedComponent[int](root), func(TypedComponent[int], int) error { return nil }); !errors.Is(err, ErrCycle) {
+		t.Errorf("WalkTyped = %v; want ErrCycle", err)
+	}
+	if err := (&TypedComposite[int]{Name: "new"}).Add(root); !errors.Is(err, ErrCycle) {
+		t.Errorf("Add of a tree holding a cycle = %v; want ErrCycle", err)
+	}
+
+	count := func(c TypedComponent[int], children []int) int { return 1 + len(children) }
+	visitor := VisitorFuncs[int, int]{
+		Leaf:      func(*TypedLeaf[int]) int { return 1 },
+		Composite: func(_ *TypedComposite[int], children []int) int { return len(children) },
+	}
+	for name, run := range map[string]func(){
+		"Fold":   func() { Fold(TypedComponent[int](root), count) },
+		"Accept": func() { Accept(TypedComponent[int](root), visitor) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrCycle) {
+					t.Errorf("%s panicked with %v; want ErrCycle", name, err)
+				}
+			}()
+			run()
+		})
+	}
+}
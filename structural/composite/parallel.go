@@ -0,0 +1,274 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Parallel traversal
+
+Walk and MapReduce visit a tree on a bounded number of goroutines. Sub-folders,
+and long runs of leaves, are handed to an idle worker when there is one and
+processed inline when there is not, so the pool never blocks and never grows
+past its limit.
+MapReduce folds results in tree order (a folder, then its children in order),
+so with an associative reduce the answer is the same for any number of
+workers. Both stop early when the context is cancelled.
+*/
+
+// pool hands work to at most size extra goroutines
+type pool struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func newPool(workers int) *pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// The calling goroutine counts as one worker
+	return &pool{sem: make(chan struct{}, workers-1)}
+}
+
+// tryGo runs fn on a new goroutine if a worker is free and reports whether it did
+func (p *pool) tryGo(fn func()) bool {
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return false
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+		fn()
+	}()
+	return true
+}
+
+// leafRun is how many consecutive leaves are handed to a worker at once. A
+// shorter run costs less inline than a goroutine does.
+const leafRun = 32
+
+// runs splits children into the units handed to workers: each sub-folder on
+// its own and leaves in runs of up to leafRun. share is false for runs too
+// short to be worth a goroutine.
+func runs(children []Component, fn func(i, j int, share bool)) {
+	for i := 0; i < len(children); {
+		if _, sub := children[i].(*Composite); sub {
+			fn(i, i+1, true)
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(children) && j-i < leafRun {
+			if _, sub := children[j].(*Composite); sub {
+				break
+			}
+			j++
+		}
+		fn(i, j, j-i == leafRun)
+		i = j
+	}
+}
+
+// stopper turns context cancellation and the first error into one cheap
+// flag. The context callback may run at any time, so err is only touched
+// under mu.
+type stopper struct {
+	stopped atomic.Bool
+	mu      sync.Mutex
+	err     error
+}
+
+func watch(ctx context.Context) (*stopper, func() bool) {
+	s := &stopper{}
+	if err := ctx.Err(); err != nil {
+		s.stop(err)
+	}
+	release := context.AfterFunc(ctx, func() { s.stop(ctx.Err()) })
+	return s, release
+}
+
+func (s *stopper) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+		s.stopped.Store(true)
+	}
+}
+
+// result returns the reason the traversal stopped, if it did. The context
+// callback runs on its own goroutine and may not have run yet, so the
+// context is checked again: a cut-short result is never reported as whole.
+func (s *stopper) result(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		s.stop(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Walk calls fn for every component under and including root, using up to
+// workers goroutines (0 means GOMAXPROCS). fn must be safe for concurrent
+// use. The first error returned by fn, or the context's error, stops the
+// walk and is returned.
+func Walk(ctx context.Context, root Component, workers int, fn func(c Component) error) error {
+	s, release := watch(ctx)
+	defer release()
+	p := newPool(workers)
+
+	var visit func(c Component)
+	visit = func(c Component) {
+		if s.stopped.Load() {
+			return
+		}
+		if err := fn(c); err != nil {
+			s.stop(err)
+			return
+		}
+		folder, ok := c.(*Composite)
+		if !ok {
+			return
+		}
+		runs(folder.Children, func(i, j int, share bool) {
+			run := func() {
+				for _, child := range folder.Children[i:j] {
+					visit(child)
+				}
+			}
+			if !share || !p.tryGo(run) {
+				run()
+			}
+		})
+	}
+	visit(root)
+	p.wg.Wait()
+	return s.result(ctx)
+}
+
+// MapReduce maps every component under and including root and folds the
+// results with reduce, using up to workers goroutines (0 means GOMAXPROCS).
+// mapFn must be safe for concurrent use and reduce must be associative;
+// zero is the identity of reduce. If the context is cancelled the partial
+// result is discarded and the context's error returned.
+func MapReduce[T any](ctx context.Context, root Component, workers int, mapFn func(c Component) T, reduce func(a, b T) T, zero T) (T, error) {
+	s, release := watch(ctx)
+	defer release()
+	p := newPool(workers)
+
+	var visit func(c Component) T
+	visit = func(c Component) T {
+		if s.stopped.Load() {
+			return zero
+		}
+		acc := mapFn(c)
+		folder, ok := c.(*Composite)
+		if !ok || len(folder.Children) == 0 {
+			return acc
+		}
+
+		results := make([]T, len(folder.Children))
+		var wg sync.WaitGroup
+		runs(folder.Children, func(i, j int, share bool) {
+			run := func() {
+				for k, child := range folder.Children[i:j] {
+					results[i+k] = visit(child)
+				}
+			}
+			if share {
+				wg.Add(1)
+				if p.tryGo(func() { defer wg.Done(); run() }) {
+					return
+				}
+				wg.Done()
+			}
+			run()
+		})
+		wg.Wait()
+		for _, r := range results {
+			acc = reduce(acc, r)
+		}
+		return acc
+	}
+
+	result := visit(root)
+	p.wg.Wait()
+	if err := s.result(ctx); err != nil {
+		return zero, err
+	}
+	return result, nil
+}
+
+// buildWideTree makes a tree with fanout^depth leaves for the example
+func buildWideTree(name string, depth, fanout int) (Component, error) {
+	if depth == 0 {
+		return &Leaf{Name: name, Size: int64(len(name))}, nil
+	}
+	folder := &Composite{Name: name}
+	for i := range fanout {
+		child, err := buildWideTree(fmt.Sprintf("%s-%d", name, i), depth-1, fanout)
+		if err != nil {
+			return nil, err
+		}
+		if err := folder.Add(child); err != nil {
+			return nil, err
+		}
+	}
+	return folder, nil
+}
+
+// Usage
+func ExecuteParallelTraversal() {
+	root, err := buildWideTree("n", 3, 8) // 512 leaves
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// Hash every name; the answer is the same for any number of workers
+	checksum := func(c Component) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(NameOf(c)))
+		return h.Sum64() % 1000
+	}
+	sum := func(a, b uint64) uint64 { return a + b }
+
+	ctx := context.Background()
+	seq, err := MapReduce(ctx, root, 1, checksum, sum, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	par, err := MapReduce(ctx, root, 4, checksum, sum, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("checksum on 1 worker %d, on 4 workers %d, equal: %t\n", seq, par, seq == par)
+
+	var leaves atomic.Int64
+	if err := Walk(ctx, root, 4, func(c Component) error {
+		if _, ok := c.(*Leaf); ok {
+			leaves.Add(1)
+		}
+		return nil
+	}); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("leaves:", leaves.Load())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = MapReduce(cancelled, root, 0, func(c Component) int { return 1 }, func(a, b int) int { return a + b }, 0)
+	fmt.Println("with a cancelled context:", err)
+}
@@ -0,0 +1,234 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func wideTree(tb testing.TB, depth, fanout int) Component {
+	tb.Helper()
+	root, err := buildWideTree("n", depth, fanout)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return root
+}
+
+// checksum is a CPU-bound map: hash every name a few times
+func checksum(c Component) uint64 {
+	h := fnv.New64a()
+	for range 20 {
+		h.Write([]byte(NameOf(c)))
+	}
+	return h.Sum64() % 1000
+}
+
+func sum(a, b uint64) uint64 { return a + b }
+
+func TestMapReduceSameForAnyWorkers(t *testing.T) {
+	root := wideTree(t, 4, 6)
+	// Concatenation is associative but not commutative, so this also
+	// checks the results are folded in tree order
+	names := func(c Component) string { return NameOf(c) + " " }
+	concat := func(a, b string) string { return a + b }
+	want, err := MapReduce(context.Background(), root, 1, names, concat, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 2, 8, 64} {
+		got, err := MapReduce(context.Background(), root, workers, names, concat, "")
+		if err != nil || got != want {
+			t.Errorf("%d workers: result differs from 1 worker (err %v)", workers, err)
+		}
+	}
+}
+
+func TestWalkVisitsEveryNode(t *testing.T) {
+	root := wideTree(t, 3, 7)
+	var n atomic.Int64
+	if err := Walk(context.Background(), root, 4, func(Component) error { n.Add(1); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(1 + 7 + 49 + 343); n.Load() != want {
+		t.Errorf("visited %d; want %d", n.Load(), want)
+	}
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	root := wideTree(t, 3, 7)
+	boom := errors.New("boom")
+	var n atomic.Int64
+	err := Walk(context.Background(), root, 4, func(c Component) error {
+		if n.Add(1) == 10 {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Walk = %v; want boom", err)
+	}
+	if n.Load() >= 400 {
+		t.Errorf("visited %d nodes after the error", n.Load())
+	}
+}
+
+// flatTree is one folder holding n leaves
+func flatTree(tb testing.TB, n int) *Composite {
+	tb.Helper()
+	root := &Composite{Name: "flat"}
+	for i := range n {
+		if err := root.Add(&Leaf{Name: fmt.Sprint(i)}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return root
+}
+
+// The leaves of a single folder are shared out too: two of them must be
+// visited at the same time
+func TestWalkFlatFolderInParallel(t *testing.T) {
+	root := flatTree(t, 4*leafRun)
+	together := make(chan struct{})
+	var arrived atomic.Int32
+	meet := func(c Component) error {
+		if _, ok := c.(*Leaf); !ok {
+			return nil
+		}
+		if arrived.Add(1) == 2 {
+			close(together)
+		}
+		select {
+		case <-together:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("leaves were visited one at a time")
+		}
+	}
+	if err := Walk(context.Background(), root, 2, meet); err != nil {
+		t.Error("Walk:", err)
+	}
+
+	together, arrived = make(chan struct{}), atomic.Int32{}
+	join := func(a, b error) error { return errors.Join(a, b) }
+	errs, err := MapReduce(context.Background(), root, 2, meet, join, nil)
+	if err != nil || errs != nil {
+		t.Error("MapReduce:", errs, err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	root := wideTree(t, 3, 7)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MapReduce(ctx, root, 4, checksum, sum, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("MapReduce = %v; want context.Canceled", err)
+	}
+	if err := Walk(ctx, root, 4, func(Component) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk = %v; want context.Canceled", err)
+	}
+
+	// Cancelled part way through: the partial result is not returned
+	ctx, cancel = context.WithCancel(context.Background())
+	var n atomic.Int64
+	_, err := MapReduce(ctx, root, 4, func(c Component) int {
+		if n.Add(1) == 50 {
+			cancel()
+		}
+		return 1
+	}, func(a, b int) int { return a + b }, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("MapReduce cancelled midway = %v; want context.Canceled", err)
+	}
+}
+
+// The benchmarks use about 270k nodes
+// walkRecursive is the plain recursion the parallel versions are measured
+// against
+func walkRecursive(c Component, fn func(c Component)) {
+	fn(c)
+	if folder, ok := c.(*Composite); ok {
+		for _, child := range folder.Children {
+			walkRecursive(child, fn)
+		}
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	root := wideTree(b, 5, 12)
+	b.Run("recursive", func(b *testing.B) {
+		for range b.N {
+			var total uint64
+			walkRecursive(root, func(c Component) { total += checksum(c) })
+		}
+	})
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				var total atomic.Uint64
+				if err := Walk(context.Background(), root, workers, func(c Component) error {
+					total.Add(checksum(c))
+					return nil
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMapReduce(b *testing.B) {
+	root := wideTree(b, 5, 12)
+	b.Run("recursive", func(b *testing.B) {
+		var fold func(c Component) uint64
+		fold = func(c Component) uint64 {
+			acc := checksum(c)
+			if folder, ok := c.(*Composite); ok {
+				for _, child := range folder.Children {
+					acc = sum(acc, fold(child))
+				}
+			}
+			return acc
+		}
+		for range b.N {
+			fold(root)
+		}
+	})
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				if _, err := MapReduce(context.Background(), root, workers, checksum, sum, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// A single folder of leaves, which only the leaf runs can share out
+func BenchmarkWalkFlat(b *testing.B) {
+	root := flatTree(b, 100_000)
+	b.Run("recursive", func(b *testing.B) {
+		for range b.N {
+			var total uint64
+			walkRecursive(root, func(c Component) { total += checksum(c) })
+		}
+	})
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				var total atomic.Uint64
+				if err := Walk(context.Background(), root, workers, func(c Component) error {
+					total.Add(checksum(c))
+					return nil
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Path queries
+
+A Query selects nodes by path instead of hand-written recursion. It is
+compiled once and can be run against any number of trees.
+
+Steps are separated by "/". A step is a glob as understood by path.Match,
+"**" for any number of levels (including none), "." for the current node or
+".." for its parent. A leading "//" searches the whole tree and "a//b" is
+short for "a/**" followed by "/b". Predicates in brackets test attributes:
+[@k] (present), [@k='v'], [@k!='v'] and <, <=, >, >= which compare numbers
+when both sides are numbers. As in XPath, a comparison is false when the
+node lacks the attribute, so [@k!='v'] only matches nodes that have k.
+@name, @kind and @size are always available; sizes are computed once per
+Select.
+*/
+
+// Query is a compiled path expression, for example:
+//
+//	root/**/File*          File* anywhere under the root called "root"
+//	//SubFolder/*          every child of any node called SubFolder
+//	//*[@env='prod']       every node whose env attribute is prod
+//	root/services/*[@kind=file][@size>=100]
+type Query struct {
+	expr  string
+	steps []queryStep
+}
+
+type queryStep struct {
+	pattern string // glob, "**", "." or ".."
+	preds   []predicate
+}
+
+type predicate struct {
+	key   string
+	op    string // "" means the attribute only has to be present
+	value string
+}
+
+// QueryError reports a malformed expression and the offset of the problem
+type QueryError struct {
+	Expr   string
+	Offset int
+	Msg    string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("composite: query %q at offset %d: %s", e.Expr, e.Offset, e.Msg)
+}
+
+// MustCompile is like Compile but panics on a malformed expression
+func MustCompile(expr string) *Query {
+	q, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Compile parses expr into a reusable Query
+func Compile(expr string) (*Query, error) {
+	q := &Query{expr: expr}
+	fail := func(offset int, format string, args ...any) (*Query, error) {
+		return nil, &QueryError{Expr: expr, Offset: offset, Msg: fmt.Sprintf(format, args...)}
+	}
+	if strings.TrimSpace(expr) == "" {
+		return fail(0, "empty expression")
+	}
+
+	i := 0
+	if strings.HasPrefix(expr, "//") {
+		q.steps = append(q.steps, queryStep{pattern: "**"})
+		i = 2
+	} else if strings.HasPrefix(expr, "/") {
+		i = 1
+	}
+
+	for i <= len(expr) {
+		start := i
+		var step queryStep
+		// The name pattern runs up to "/", "[" or the end; brackets inside a
+		// glob character class belong to the pattern
+		for i < len(expr) && expr[i] != '/' && !(expr[i] == '[' && i+1 < len(expr) && expr[i+1] == '@') {
+			if expr[i] == '[' {
+				end := strings.IndexByte(expr[i:], ']')
+				if end < 0 {
+					return fail(i, "unterminated character class")
+				}
+				i += end
+			}
+			i++
+		}
+		step.pattern = expr[start:i]
+		if step.pattern == "" {
+			if i >= len(expr) {
+				return fail(i, "expression ends with '/'")
+			}
+			if expr[i] == '/' {
+				// "a//b": an empty step between two slashes
+				q.steps = append(q.steps, queryStep{pattern: "**"})
+				i++
+				continue
+			}
+			return fail(i, "predicate without a name pattern; use *[...]")
+		}
+		if _, err := path.Match(step.pattern, ""); err != nil {
+			return fail(start, "bad pattern %q", step.pattern)
+		}
+
+		for i < len(expr) && expr[i] == '[' {
+			p, n, err := parsePredicate(expr[i:])
+			if err != "" {
+				return fail(i+n, "%s", err)
+			}
+			step.preds = append(step.preds, p)
+			i += n
+		}
+		if (step.pattern == "**" || step.pattern == "." || step.pattern == "..") && len(step.preds) > 0 {
+			return fail(start, "%q cannot have predicates", step.pattern)
+		}
+		q.steps = append(q.steps, step)
+
+		if i == len(expr) {
+			break
+		}
+		if expr[i] != '/' {
+			return fail(i, "unexpected %q", expr[i])
+		}
+		i++
+		if i == len(expr) {
+			return fail(i, "expression ends with '/'")
+		}
+	}
+	return q, nil
+}
+
+// parsePredicate reads "[@key]" or "[@key op value]" from the start of s and
+// returns how many bytes it used; on failure it returns a message and the
+// offset of the problem
+func parsePredicate(s string) (predicate, int, string) {
+	var p predicate
+	i := 1
+	if i >= len(s) || s[i] != '@' {
+		return p, i, "predicate must start with '@'"
+	}
+	i++
+	start := i
+	for i < len(s) && (isIdentByte(s[i])) {
+		i++
+	}
+	p.key = s[start:i]
+	if p.key == "" {
+		return p, i, "missing attribute name"
+	}
+	if i < len(s) && s[i] == ']' {
+		return p, i + 1, ""
+	}
+
+	for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(s[i:], op) {
+			p.op = op
+			i += len(op)
+			break
+		}
+	}
+	if p.op == "" {
+		return p, i, "expected ']' or a comparison"
+	}
+
+	if i < len(s) && (s[i] == '\'' || s[i] == '"') {
+		quote := s[i]
+		end := strings.IndexByte(s[i+1:], quote)
+		if end < 0 {
+			return p, i, "unterminated string"
+		}
+		p.value = s[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		start := i
+		for i < len(s) && s[i] != ']' {
+			i++
+		}
+		p.value = strings.TrimSpace(s[start:i])
+	}
+	if i >= len(s) || s[i] != ']' {
+		return p, i, "expected ']'"
+	}
+	return p, i + 1, ""
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '-' || b == '.' || b == ':' ||
+		('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Select returns the matching nodes of the tree under root, in document
+// order and without duplicates. The first step is matched against root.
+func (q *Query) Select(root Component) []Component {
+	// One pass numbers the nodes in document order and totals their sizes,
+	// as SizeOf would
+	order := map[Component]int{}
+	sizes := map[Component]int64{}
+	var number func(c Component) int64
+	number = func(c Component) int64 {
+		order[c] = len(order)
+		var size int64
+		switch c := c.(type) {
+		case *Leaf:
+			size = c.Size
+		case *Composite:
+			for _, child := range c.Children {
+				size += number(child)
+			}
+		}
+		sizes[c] = size
+		return size
+	}
+	number(root)
+
+	// nil stands for the document above root, whose only child is root
+	current := []Component{nil}
+	children := func(c Component) []Component {
+		if c == nil {
+			return []Component{root}
+		}
+		if f, ok := c.(*Composite); ok {
+			return f.Children
+		}
+		return nil
+	}
+
+	for _, step := range q.steps {
+		var next []Component
+		seen := map[Component]bool{}
+		add := func(c Component) {
+			if !seen[c] {
+				seen[c] = true
+				next = append(next, c)
+			}
+		}
+		for _, c := range current {
+			switch step.pattern {
+			case "**":
+				var descend func(c Component)
+				descend = func(c Component) {
+					add(c)
+					for _, child := range children(c) {
+						descend(child)
+					}
+				}
+				descend(c)
+			case ".":
+				add(c)
+			case "..":
+				if c == root {
+					add(nil)
+				} else if n, ok := c.(Node); ok && n.Parent() != nil {
+					add(n.Parent())
+				}
+			default:
+				for _, child := range children(c) {
+					if step.matches(child, sizes) {
+						add(child)
+					}
+				}
+			}
+		}
+		current = next
+	}
+
+	result := slices.DeleteFunc(current, func(c Component) bool { return c == nil })
+	slices.SortFunc(result, func(a, b Component) int { return order[a] - order[b] })
+	return result
+}
+
+// First returns the first match in document order
+func (q *Query) First(root Component) (Component, bool) {
+	matches := q.Select(root)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0], true
+}
+
+// matches tests c against the step; sizes holds the size of every node
+func (s queryStep) matches(c Component, sizes map[Component]int64) bool {
+	if ok, _ := path.Match(s.pattern, NameOf(c)); !ok {
+		return false
+	}
+	for _, p := range s.preds {
+		if !p.matches(c, sizes) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p predicate) matches(c Component, sizes map[Component]int64) bool {
+	v, ok := attribute(c, p.key, sizes)
+	if !ok {
+		return false
+	}
+	switch p.op {
+	case "":
+		return true
+	case "=":
+		return v == p.value
+	case "!=":
+		return v != p.value
+	}
+	a, errA := strconv.ParseFloat(v, 64)
+	b, errB := strconv.ParseFloat(p.value, 64)
+	cmp := strings.Compare(v, p.value)
+	if errA == nil && errB == nil {
+		cmp = 0
+		if a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	}
+	switch p.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// attributed is implemented by Leaf and Composite and anything embedding them
+type attributed interface {
+	attributes() map[string]string
+}
+
+func (l *Leaf) attributes() map[string]string      { return l.Attrs }
+func (c *Composite) attributes() map[string]string { return c.Attrs }
+
+// attribute looks up a query attribute, including the built-in ones
+func attribute(c Component, key string, sizes map[Component]int64) (string, bool) {
+	switch key {
+	case "name":
+		return NameOf(c), true
+	case "kind":
+		switch c.(type) {
+		case *Composite:
+			return "folder", true
+		case *Leaf:
+			return "file", true
+		case NodeMarshaler:
+			if d, err := DefaultRegistry.Encode(c); err == nil {
+				return d.Kind, true
+			}
+		}
+		return "", false
+	case "size":
+		return strconv.FormatInt(sizes[c], 10), true
+	}
+	if a, ok := c.(attributed); ok {
+		v, ok := a.attributes()[key]
+		return v, ok
+	}
+	return "", false
+}
+
+// Usage
+func ExecuteQueries() {
+	root := &Composite{Name: "root"}
+	sub := &Composite{Name: "SubFolder"}
+	deep := &Composite{Name: "deep"}
+	if err := errors.Join(
+		root.Add(&Leaf{Name: "File1", Size: 50, Attrs: map[string]string{"env": "dev"}}),
+		root.Add(&Leaf{Name: "readme.md", Size: 10}),
+		root.Add(sub),
+		sub.Add(&Leaf{Name: "File2", Size: 500, Attrs: map[string]string{"env": "prod"}}),
+		sub.Add(deep),
+		deep.Add(&Leaf{Name: "File3", Size: 150, Attrs: map[string]string{"env": "prod"}}),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	queries := []*Query{
+		MustCompile("root/**/File*"),
+		MustCompile("//SubFolder/*"),
+		MustCompile("//*[@env='prod'][@size>200]"),
+		MustCompile("root//*[@kind=folder]"),
+		MustCompile("//File3/../.."),
+	}
+	for _, q := range queries {
+		var paths []string
+		for _, c := range q.Select(root) {
+			paths = append(paths, PathOf(c.(Node)))
+		}
+		fmt.Printf("%-30s %s\n", q, strings.Join(paths, ", "))
+	}
+
+	if _, err := Compile("root/*[@env='prod'"); err != nil {
+		fmt.Println(err)
+	}
+}
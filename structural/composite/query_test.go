@@ -0,0 +1,118 @@
+package composite
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// queryTree is root/{File1, readme.md, SubFolder/{File2, deep/{File3}}}
+func queryTree(t testing.TB) *Composite {
+	t.Helper()
+	root := &Composite{Name: "root", Attrs: map[string]string{"env": "all"}}
+	sub := &Composite{Name: "SubFolder"}
+	deep := &Composite{Name: "deep"}
+	if err := errors.Join(
+		root.Add(&Leaf{Name: "File1", Size: 50, Attrs: map[string]string{"env": "dev"}}),
+		root.Add(&Leaf{Name: "readme.md", Size: 10}),
+		root.Add(sub),
+		sub.Add(&Leaf{Name: "File2", Size: 500, Attrs: map[string]string{"env": "prod"}}),
+		sub.Add(deep),
+		deep.Add(&Leaf{Name: "File3", Size: 150, Attrs: map[string]string{"env": "prod", "tier": "9"}}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestSelect(t *testing.T) {
+	root := queryTree(t)
+	tests := []struct {
+		expr string
+		want string // the names of the matches in document order
+	}{
+		{"root", "root"},
+		{"other", ""},
+		{"root/*", "File1 readme.md SubFolder"},
+		{"root/**/File*", "File1 File2 File3"},
+		{"//SubFolder/*", "File2 deep"},
+		{"root//deep", "deep"},
+		{"//File3/../..", "SubFolder"},
+		{"root/..", ""},
+		{"root/./SubFolder", "SubFolder"},
+		{"//*[@env='prod']", "File2 File3"},
+		{"//*[@env]", "root File1 File2 File3"},
+		{"//*[@env!='prod']", "root File1"},
+		{"//*[@tier!='1']", "File3"},
+		{"//*[@kind=folder]", "root SubFolder deep"},
+		{"//*[@kind='file'][@size>=150]", "File2 File3"},
+		{"//*[@size>200]", "root SubFolder File2"},
+		{"//*[@size=150]", "deep File3"},
+		{"//*[@tier>10]", ""},
+		{"//*[@tier<10]", "File3"},
+		{"//*[@name<'G']", "File1 File2 File3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			var names []string
+			for _, c := range MustCompile(tt.expr).Select(root) {
+				names = append(names, NameOf(c))
+			}
+			if got := strings.Join(names, " "); got != tt.want {
+				t.Errorf("Select = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirst(t *testing.T) {
+	root := queryTree(t)
+	if c, ok := MustCompile("//File*").First(root); !ok || NameOf(c) != "File1" {
+		t.Errorf("First = %v, %t", c, ok)
+	}
+	if _, ok := MustCompile("//nothing").First(root); ok {
+		t.Error("First found a match for //nothing")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]int{
+		"root/*[@env='prod'": 18,
+		"root/[":             5,
+		"root/*[@]":          8,
+		"root/*[@env~'x']":   11,
+		"root/*[@env='x":     12,
+	}
+	for expr, offset := range tests {
+		_, err := Compile(expr)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("Compile(%q) = %v; want a *QueryError", expr, err)
+			continue
+		}
+		if qe.Offset != offset {
+			t.Errorf("Compile(%q): offset %d (%v); want %d", expr, qe.Offset, err, offset)
+		}
+	}
+}
+
+// BenchmarkSelectSize runs a @size predicate over a deep tree, where sizing
+// every candidate separately would be quadratic
+func BenchmarkSelectSize(b *testing.B) {
+	root := &Composite{Name: "root"}
+	folder := root
+	for range 2000 {
+		next := &Composite{Name: "d"}
+		if err := errors.Join(folder.Add(&Leaf{Name: "f", Size: 1}), folder.Add(next)); err != nil {
+			b.Fatal(err)
+		}
+		folder = next
+	}
+	q := MustCompile("//*[@size>1000]")
+	b.ResetTimer()
+	for range b.N {
+		if got := len(q.Select(root)); got != 1000 {
+			b.Fatalf("%d matches", got)
+		}
+	}
+}
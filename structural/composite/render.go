@@ -0,0 +1,229 @@
+package composite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Rendering
+
+Display prints with fixed indentation straight to stdout. Render writes to
+any io.Writer in one of several styles and can limit depth, sort and filter
+children, and collapse folders. Collapsed folders, and folders cut off by
+the depth limit, are shown with the number of children they hide.
+*/
+
+// RenderStyle selects the output format of Render
+type RenderStyle int
+
+const (
+	// StyleTree draws box-drawing branches like the tree command
+	StyleTree RenderStyle = iota
+	// StyleIndent mirrors Display: "+" for folders, "-" for leaves
+	StyleIndent
+	// StyleDOT writes a Graphviz digraph
+	StyleDOT
+)
+
+// RenderOptions configures Render; the zero value renders everything in
+// StyleTree in the original order
+type RenderOptions struct {
+	Style RenderStyle
+	// MaxDepth stops descending below this depth; 0 means no limit
+	MaxDepth int
+	// Less sorts the children of every folder; nil keeps their order
+	Less func(a, b Component) bool
+	// Filter hides a component and everything under it when it returns false
+	Filter func(c Component) bool
+	// PruneEmpty hides folders that end up with no visible children
+	PruneEmpty bool
+	// Collapse shows a folder without its children when it returns true
+	Collapse func(c *Composite) bool
+	// Indent is the per-level indentation of StyleIndent; "  " by default
+	Indent string
+}
+
+// FoldersFirst is a Less function that sorts folders before leaves, then by name
+func FoldersFirst(a, b Component) bool {
+	_, af := a.(*Composite)
+	_, bf := b.(*Composite)
+	if af != bf {
+		return af
+	}
+	return NameOf(a) < NameOf(b)
+}
+
+// renderNode is the part of the tree that will be shown
+type renderNode struct {
+	name     string
+	folder   bool
+	children []*renderNode
+	hidden   int
+}
+
+// Render writes root to w in the style chosen by opts
+func Render(w io.Writer, root Component, opts RenderOptions) error {
+	view := prepare(root, 0, opts)
+	if view == nil {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	switch opts.Style {
+	case StyleTree:
+		fmt.Fprintln(bw, label(view, "/"))
+		writeTree(bw, view.children, "")
+	case StyleIndent:
+		indent := opts.Indent
+		if indent == "" {
+			indent = "  "
+		}
+		writeIndented(bw, view, "", indent)
+	case StyleDOT:
+		writeDOT(bw, view)
+	default:
+		return fmt.Errorf("composite: unknown render style %d", opts.Style)
+	}
+	return bw.Flush()
+}
+
+func prepare(c Component, depth int, opts RenderOptions) *renderNode {
+	if opts.Filter != nil && !opts.Filter(c) {
+		return nil
+	}
+	n := &renderNode{name: NameOf(c)}
+	folder, ok := c.(*Composite)
+	if !ok {
+		return n
+	}
+	n.folder = true
+
+	if (opts.MaxDepth > 0 && depth >= opts.MaxDepth) || (opts.Collapse != nil && opts.Collapse(folder)) {
+		n.hidden = len(folder.Children)
+		return n
+	}
+	children := folder.Children
+	if opts.Less != nil {
+		children = slices.Clone(children)
+		slices.SortStableFunc(children, func(a, b Component) int {
+			switch {
+			case opts.Less(a, b):
+				return -1
+			case opts.Less(b, a):
+				return 1
+			}
+			return 0
+		})
+	}
+	for _, child := range children {
+		if cn := prepare(child, depth+1, opts); cn != nil {
+			n.children = append(n.children, cn)
+		}
+	}
+	if opts.PruneEmpty && depth > 0 && len(n.children) == 0 {
+		return nil
+	}
+	return n
+}
+
+// label is the text shown for a node; folderMark is appended to folder names
+func label(n *renderNode, folderMark string) string {
+	s := n.name
+	if n.folder {
+		s += folderMark
+	}
+	if n.hidden > 0 {
+		s += " [+" + strconv.Itoa(n.hidden) + "]"
+	}
+	return s
+}
+
+func writeTree(w io.Writer, children []*renderNode, prefix string) {
+	for i, c := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintln(w, prefix+branch+label(c, "/"))
+		writeTree(w, c.children, prefix+next)
+	}
+}
+
+func writeIndented(w io.Writer, n *renderNode, prefix, indent string) {
+	mark := "- "
+	if n.folder {
+		mark = "+ "
+	}
+	fmt.Fprintln(w, prefix+mark+label(n, ""))
+	for _, c := range n.children {
+		writeIndented(w, c, prefix+indent, indent)
+	}
+}
+
+func writeDOT(w io.Writer, root *renderNode) {
+	fmt.Fprintln(w, "digraph tree {")
+	fmt.Fprintln(w, "  node [fontname=\"monospace\"];")
+	id := 0
+	var walk func(n *renderNode) int
+	walk = func(n *renderNode) int {
+		me := id
+		id++
+		shape := "note"
+		if n.folder {
+			shape = "folder"
+		}
+		fmt.Fprintf(w, "  n%d [label=%s shape=%s];\n", me, strconv.Quote(label(n, "")), shape)
+		for _, c := range n.children {
+			child := walk(c)
+			fmt.Fprintf(w, "  n%d -> n%d;\n", me, child)
+		}
+		return me
+	}
+	walk(root)
+	fmt.Fprintln(w, "}")
+}
+
+// Usage
+func ExecuteRendering() {
+	root := &Composite{Name: "project"}
+	cmd := &Composite{Name: "cmd"}
+	docs := &Composite{Name: "docs"}
+	vendor := &Composite{Name: "vendor"}
+	if err := errors.Join(
+		cmd.Add(&Leaf{Name: "main.go"}),
+		docs.Add(&Leaf{Name: "intro.md"}),
+		docs.Add(&Leaf{Name: "usage.md"}),
+		vendor.Add(&Leaf{Name: "lib.go"}),
+		root.Add(&Leaf{Name: "go.mod"}),
+		root.Add(vendor),
+		root.Add(cmd),
+		root.Add(docs),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	views := []RenderOptions{
+		{
+			Less:     FoldersFirst,
+			Collapse: func(c *Composite) bool { return c.Name == "vendor" },
+		},
+		{
+			Style:      StyleIndent,
+			Filter:     func(c Component) bool { _, dir := c.(*Composite); return dir || strings.HasSuffix(NameOf(c), ".go") },
+			PruneEmpty: true,
+		},
+		{Style: StyleDOT, MaxDepth: 1},
+	}
+	for _, opts := range views {
+		if err := Render(os.Stdout, root, opts); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package composite
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites it with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// renderTree is project/{go.mod, vendor/lib.go, cmd/app/main.go, docs/{intro.md, usage.md}, "quoted \"name\""}
+func renderTree(t *testing.T) *Composite {
+	t.Helper()
+	root := &Composite{Name: "project"}
+	cmd := &Composite{Name: "cmd"}
+	app := &Composite{Name: "app"}
+	docs := &Composite{Name: "docs"}
+	vendor := &Composite{Name: "vendor"}
+	if err := errors.Join(
+		app.Add(&Leaf{Name: "main.go"}),
+		cmd.Add(app),
+		docs.Add(&Leaf{Name: "usage.md"}),
+		docs.Add(&Leaf{Name: "intro.md"}),
+		vendor.Add(&Leaf{Name: "lib.go"}),
+		root.Add(&Leaf{Name: "go.mod"}),
+		root.Add(vendor),
+		root.Add(cmd),
+		root.Add(docs),
+		root.Add(&Leaf{Name: `quoted "name"`}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestRenderGolden(t *testing.T) {
+	goOnly := func(c Component) bool {
+		_, dir := c.(*Composite)
+		return dir || strings.HasSuffix(NameOf(c), ".go")
+	}
+	tests := []struct {
+		file string
+		opts RenderOptions
+	}{
+		{"render_tree.txt", RenderOptions{}},
+		{"render_sorted_collapsed.txt", RenderOptions{Less: FoldersFirst, Collapse: func(c *Composite) bool { return c.Name == "vendor" }}},
+		{"render_depth.txt", RenderOptions{MaxDepth: 1}},
+		{"render_indent_pruned.txt", RenderOptions{Style: StyleIndent, Indent: "    ", Filter: goOnly, PruneEmpty: true}},
+		{"render_indent_unpruned.txt", RenderOptions{Style: StyleIndent, Filter: goOnly}},
+		{"render.dot", RenderOptions{Style: StyleDOT, MaxDepth: 2}},
+	}
+	root := renderTree(t)
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Render(&b, root, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.file, b.Bytes())
+		})
+	}
+}
+
+func TestRenderEdgeCases(t *testing.T) {
+	root := renderTree(t)
+	var b bytes.Buffer
+	if err := Render(&b, root, RenderOptions{Style: RenderStyle(99)}); err == nil {
+		t.Error("Render accepted an unknown style")
+	}
+	b.Reset()
+	if err := Render(&b, root, RenderOptions{Filter: func(Component) bool { return false }}); err != nil || b.Len() != 0 {
+		t.Errorf("filtered-out root: wrote %q, %v; want nothing", b.String(), err)
+	}
+	// The root is kept by PruneEmpty even when nothing under it is shown
+	b.Reset()
+	if err := Render(&b, root, RenderOptions{Style: StyleIndent, Filter: func(c Component) bool { _, dir := c.(*Composite); return dir }, PruneEmpty: true}); err != nil || b.String() != "+ project\n" {
+		t.Errorf("pruned tree: wrote %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := Render(&b, &Leaf{Name: "alone"}, RenderOptions{}); err != nil || b.String() != "alone\n" {
+		t.Errorf("single leaf: wrote %q, %v", b.String(), err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestRenderWriteError(t *testing.T) {
+	if err := Render(failingWriter{}, renderTree(t), RenderOptions{}); err == nil || err.Error() != "disk full" {
+		t.Errorf("Render = %v; want the writer's error", err)
+	}
+}
@@ -0,0 +1,792 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/yaml"
+)
+
+/*
+Serialization
+
+A tree is saved through NodeData, a neutral description of one node: its
+kind, name, file details, attributes, whether a folder keeps its children's
+names unique, and children in order. Marshal and
+Unmarshal convert NodeData to and from JSON, YAML and XML. Leaf ("file")
+and Composite ("folder") are built in; other component types take part by
+implementing NodeMarshaler and registering a decoder for their kind.
+Malformed input fails with a *DecodeError that says where.
+*/
+
+// Format selects the encoding used by Marshal and Unmarshal
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatXML  Format = "xml"
+)
+
+// NodeData is the serialized form of one component and its children
+type NodeData struct {
+	Kind     string
+	Name     string
+	Size     int64
+	ModTime  time.Time
+	Attrs    map[string]string
+	Children []NodeData
+	// UniqueNames carries Composite.UniqueNames
+	UniqueNames bool
+
+	line, column int
+}
+
+// NodeMarshaler is implemented by custom components to describe themselves.
+// Container types encode their children with Registry.Encode.
+type NodeMarshaler interface {
+	MarshalNode(r *Registry) (NodeData, error)
+}
+
+// DecodeFunc builds a component from its NodeData. Container types decode
+// their children with Registry.Decode.
+type DecodeFunc func(r *Registry, d NodeData) (Component, error)
+
+// DecodeError reports malformed input and where it was found
+type DecodeError struct {
+	Format Format
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("composite: %s:%d:%d: %v", e.Format, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("composite: %s:%d: %v", e.Format, e.Line, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Registry maps kinds to decoders
+type Registry struct {
+	decoders map[string]DecodeFunc
+}
+
+// NewRegistry returns a registry that knows "file" and "folder"
+func NewRegistry() *Registry {
+	r := &Registry{decoders: map[string]DecodeFunc{}}
+	r.Register("file", decodeLeaf)
+	r.Register("folder", decodeComposite)
+	return r
+}
+
+// DefaultRegistry is used by the package-level Marshal and Unmarshal
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(kind string, decode DecodeFunc) {
+	r.decoders[kind] = decode
+}
+
+// Encode describes c and everything under it. It refuses nodes the
+// decoders would reject, so whatever it writes can be read back.
+func (r *Registry) Encode(c Component) (NodeData, error) {
+	var d NodeData
+	switch c := c.(type) {
+	case NodeMarshaler:
+		var err error
+		if d, err = c.MarshalNode(r); err != nil {
+			return NodeData{}, err
+		}
+	case *Leaf:
+		d = NodeData{Kind: "file", Name: c.Name, Size: c.Size, ModTime: c.ModTime, Attrs: maps.Clone(c.Attrs)}
+	case *Composite:
+		d = NodeData{Kind: "folder", Name: c.Name, ModTime: c.ModTime, Attrs: maps.Clone(c.Attrs), UniqueNames: c.UniqueNames}
+		for _, child := range c.Children {
+			cd, err := r.Encode(child)
+			if err != nil {
+				return NodeData{}, err
+			}
+			d.Children = append(d.Children, cd)
+		}
+	default:
+		return NodeData{}, fmt.Errorf("composite: cannot encode %T; implement NodeMarshaler", c)
+	}
+	if err := checkNode(d); err != nil {
+		return NodeData{}, fmt.Errorf("composite: cannot encode %T: %w", c, errors.Unwrap(err))
+	}
+	return d, nil
+}
+
+// Decode builds the component described by d
+func (r *Registry) Decode(d NodeData) (Component, error) {
+	decode, ok := r.decoders[d.Kind]
+	if !ok {
+		return nil, d.errorf("unknown kind %q", d.Kind)
+	}
+	c, err := decode(r, d)
+	if err != nil {
+		var de *DecodeError
+		if errors.As(err, &de) {
+			return nil, err
+		}
+		return nil, d.errorf("%s %q: %w", d.Kind, d.Name, err)
+	}
+	return c, nil
+}
+
+// errorf makes a DecodeError at d's position; Unmarshal fills in the format
+func (d NodeData) errorf(format string, args ...any) error {
+	return &DecodeError{Line: d.line, Column: d.column, Err: fmt.Errorf(format, args...)}
+}
+
+func decodeLeaf(r *Registry, d NodeData) (Component, error) {
+	if len(d.Children) > 0 {
+		return nil, d.Children[0].errorf("file %q cannot have children", d.Name)
+	}
+	if d.UniqueNames {
+		return nil, d.errorf("file %q cannot have unique names", d.Name)
+	}
+	return &Leaf{Name: d.Name, Size: d.Size, ModTime: d.ModTime, Attrs: d.Attrs}, nil
+}
+
+func decodeComposite(r *Registry, d NodeData) (Component, error) {
+	folder := &Composite{Name: d.Name, ModTime: d.ModTime, Attrs: d.Attrs, UniqueNames: d.UniqueNames}
+	for _, cd := range d.Children {
+		child, err := r.Decode(cd)
+		if err != nil {
+			return nil, err
+		}
+		if err := folder.Add(child); err != nil {
+			return nil, cd.errorf("%w", err)
+		}
+	}
+	return folder, nil
+}
+
+// Marshal encodes c with the default registry
+func Marshal(c Component, f Format) ([]byte, error) {
+	return DefaultRegistry.Marshal(c, f)
+}
+
+// Unmarshal decodes a tree with the default registry
+func Unmarshal(data []byte, f Format) (Component, error) {
+	return DefaultRegistry.Unmarshal(data, f)
+}
+
+func (r *Registry) Marshal(c Component, f Format) ([]byte, error) {
+	d, err := r.Encode(c)
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case FormatJSON:
+		return json.MarshalIndent(toJSONNode(d), "", "  ")
+	case FormatYAML:
+		var b bytes.Buffer
+		writeYAMLNode(&b, d, 0, false)
+		return b.Bytes(), nil
+	case FormatXML:
+		out, err := xml.MarshalIndent(toXMLNode(d), "", "  ")
+		return append(out, '\n'), err
+	}
+	return nil, fmt.Errorf("composite: unknown format %q", f)
+}
+
+func (r *Registry) Unmarshal(data []byte, f Format) (Component, error) {
+	var d NodeData
+	var err error
+	switch f {
+	case FormatJSON:
+		d, err = parseJSON(data)
+	case FormatYAML:
+		d, err = parseYAML(data)
+	case FormatXML:
+		d, err = parseXML(data)
+	default:
+		return nil, fmt.Errorf("composite: unknown format %q", f)
+	}
+	if err == nil {
+		var c Component
+		if c, err = r.Decode(d); err == nil {
+			return c, nil
+		}
+	}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		de.Format = f
+	}
+	return nil, err
+}
+
+// checkNode validates what every node needs regardless of format
+func checkNode(d NodeData) error {
+	if d.Kind == "" {
+		return d.errorf("missing kind")
+	}
+	if d.Name == "" {
+		return d.errorf("%s without a name", d.Kind)
+	}
+	return nil
+}
+
+// =================================
+// JSON
+// =================================
+
+type jsonNode struct {
+	Kind     string            `json:"kind"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size,omitempty"`
+	ModTime  string            `json:"modtime,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Unique   bool              `json:"unique_names,omitempty"`
+	Children []jsonNode        `json:"children,omitempty"`
+}
+
+func toJSONNode(d NodeData) jsonNode {
+	n := jsonNode{Kind: d.Kind, Name: d.Name, Size: d.Size, ModTime: formatTime(d.ModTime), Attrs: d.Attrs, Unique: d.UniqueNames}
+	for _, c := range d.Children {
+		n.Children = append(n.Children, toJSONNode(c))
+	}
+	return n
+}
+
+// jsonParser walks the token stream so every node knows its offset
+type jsonParser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+func parseJSON(data []byte) (NodeData, error) {
+	p := &jsonParser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	// Sizes past 2^53 do not survive a float64
+	p.dec.UseNumber()
+	d, err := p.node()
+	if err != nil {
+		return NodeData{}, err
+	}
+	if _, err := p.dec.Token(); err != io.EOF {
+		return NodeData{}, p.errorf("unexpected data after the root node")
+	}
+	return d, nil
+}
+
+func (p *jsonParser) errorf(format string, args ...any) error {
+	line, col := lineColumn(p.data, p.dec.InputOffset())
+	return &DecodeError{Line: line, Column: col, Err: fmt.Errorf(format, args...)}
+}
+
+func (p *jsonParser) token() (json.Token, error) {
+	tok, err := p.dec.Token()
+	if err != nil {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			line, col := lineColumn(p.data, se.Offset)
+			return nil, &DecodeError{Line: line, Column: col, Err: errors.New(se.Error())}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, p.errorf("%v", err)
+	}
+	return tok, nil
+}
+
+func (p *jsonParser) delim(want json.Delim) error {
+	tok, err := p.token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return p.errorf("expected %q, found %v", want, tok)
+	}
+	return nil
+}
+
+func (p *jsonParser) str(key string) (string, error) {
+	tok, err := p.token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", p.errorf("%s must be a string, found %v", key, tok)
+	}
+	return s, nil
+}
+
+func (p *jsonParser) node() (NodeData, error) {
+	if err := p.delim('{'); err != nil {
+		return NodeData{}, err
+	}
+	var d NodeData
+	d.line, d.column = lineColumn(p.data, p.dec.InputOffset()-1)
+	seen := map[string]bool{}
+	for p.dec.More() {
+		key, err := p.str("key")
+		if err != nil {
+			return NodeData{}, err
+		}
+		if seen[key] {
+			return NodeData{}, p.errorf("duplicate key %q", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "kind":
+			d.Kind, err = p.str(key)
+		case "name":
+			d.Name, err = p.str(key)
+		case "size":
+			var tok json.Token
+			if tok, err = p.token(); err == nil {
+				n, ok := tok.(json.Number)
+				if d.Size, err = strconv.ParseInt(string(n), 10, 64); !ok || err != nil || d.Size < 0 {
+					err = p.errorf("size must be a non-negative integer, found %v", tok)
+				}
+			}
+		case "modtime":
+			var s string
+			if s, err = p.str(key); err == nil {
+				if d.ModTime, err = parseTime(s); err != nil {
+					err = p.errorf("%v", err)
+				}
+			}
+		case "attrs":
+			d.Attrs, err = p.attrs()
+		case "unique_names":
+			var tok json.Token
+			if tok, err = p.token(); err == nil {
+				var ok bool
+				if d.UniqueNames, ok = tok.(bool); !ok {
+					err = p.errorf("unique_names must be true or false, found %v", tok)
+				}
+			}
+		case "children":
+			err = p.delim('[')
+			for err == nil && p.dec.More() {
+				var child NodeData
+				if child, err = p.node(); err == nil {
+					d.Children = append(d.Children, child)
+				}
+			}
+			if err == nil {
+				err = p.delim(']')
+			}
+		default:
+			err = p.errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return NodeData{}, err
+		}
+	}
+	if err := p.delim('}'); err != nil {
+		return NodeData{}, err
+	}
+	return d, checkNode(d)
+}
+
+func (p *jsonParser) attrs() (map[string]string, error) {
+	if err := p.delim('{'); err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{}
+	for p.dec.More() {
+		key, err := p.str("attribute name")
+		if err != nil {
+			return nil, err
+		}
+		if attrs[key], err = p.str("attribute " + key); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, p.delim('}')
+}
+
+// lineColumn turns a byte offset into a 1-based line and column
+func lineColumn(data []byte, offset int64) (int, int) {
+	offset = max(0, min(offset, int64(len(data))))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, int(offset) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("modtime %q is not RFC 3339", s)
+	}
+	return t, nil
+}
+
+// parseBool accepts exactly the two spellings Marshal writes
+func parseBool(s string) (bool, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("unique_names %q is not true or false", s)
+}
+
+// =================================
+// XML
+// =================================
+
+type xmlNode struct {
+	XMLName  xml.Name  `xml:"node"`
+	Kind     string    `xml:"kind,attr"`
+	Name     string    `xml:"name,attr"`
+	Size     int64     `xml:"size,attr,omitempty"`
+	ModTime  string    `xml:"modtime,attr,omitempty"`
+	Unique   bool      `xml:"unique_names,attr,omitempty"`
+	Attrs    []xmlAttr `xml:"attr"`
+	Children []xmlNode `xml:"node"`
+}
+
+type xmlAttr struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func toXMLNode(d NodeData) xmlNode {
+	n := xmlNode{Kind: d.Kind, Name: d.Name, Size: d.Size, ModTime: formatTime(d.ModTime), Unique: d.UniqueNames}
+	for _, k := range slices.Sorted(maps.Keys(d.Attrs)) {
+		n.Attrs = append(n.Attrs, xmlAttr{Key: k, Value: d.Attrs[k]})
+	}
+	for _, c := range d.Children {
+		n.Children = append(n.Children, toXMLNode(c))
+	}
+	return n
+}
+
+func parseXML(data []byte) (NodeData, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := xmlToken(dec)
+		if err != nil {
+			return NodeData{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return parseXMLNode(dec, t)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return NodeData{}, xmlErrorf(dec, "text outside the root node")
+			}
+		}
+	}
+}
+
+func xmlToken(dec *xml.Decoder) (xml.Token, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		var se *xml.SyntaxError
+		if errors.As(err, &se) {
+			return nil, &DecodeError{Line: se.Line, Err: errors.New(se.Msg)}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, xmlErrorf(dec, "%v", err)
+	}
+	return tok, nil
+}
+
+func xmlErrorf(dec *xml.Decoder, format string, args ...any) error {
+	line, col := dec.InputPos()
+	return &DecodeError{Line: line, Column: col, Err: fmt.Errorf(format, args...)}
+}
+
+func parseXMLNode(dec *xml.Decoder, start xml.StartElement) (NodeData, error) {
+	var d NodeData
+	d.line, d.column = dec.InputPos()
+	if start.Name.Local != "node" {
+		return NodeData{}, d.errorf("expected <node>, found <%s>", start.Name.Local)
+	}
+	for _, a := range start.Attr {
+		var err error
+		switch a.Name.Local {
+		case "kind":
+			d.Kind = a.Value
+		case "name":
+			d.Name = a.Value
+		case "size":
+			if d.Size, err = strconv.ParseInt(a.Value, 10, 64); err != nil || d.Size < 0 {
+				return NodeData{}, d.errorf("size %q is not a non-negative integer", a.Value)
+			}
+		case "modtime":
+			if d.ModTime, err = parseTime(a.Value); err != nil {
+				return NodeData{}, d.errorf("%v", err)
+			}
+		case "unique_names":
+			if d.UniqueNames, err = parseBool(a.Value); err != nil {
+				return NodeData{}, d.errorf("%v", err)
+			}
+		default:
+			return NodeData{}, d.errorf("unknown attribute %q", a.Name.Local)
+		}
+	}
+
+	for {
+		tok, err := xmlToken(dec)
+		if err != nil {
+			return NodeData{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "node":
+				child, err := parseXMLNode(dec, t)
+				if err != nil {
+					return NodeData{}, err
+				}
+				d.Children = append(d.Children, child)
+			case "attr":
+				if err := parseXMLAttr(dec, t, &d); err != nil {
+					return NodeData{}, err
+				}
+			default:
+				return NodeData{}, xmlErrorf(dec, "unexpected <%s>", t.Name.Local)
+			}
+		case xml.EndElement:
+			return d, checkNode(d)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return NodeData{}, xmlErrorf(dec, "unexpected text %q", bytes.TrimSpace(t))
+			}
+		}
+	}
+}
+
+func parseXMLAttr(dec *xml.Decoder, start xml.StartElement, d *NodeData) error {
+	var a xmlAttr
+	if err := dec.DecodeElement(&a, &start); err != nil {
+		return xmlErrorf(dec, "%v", err)
+	}
+	if a.Key == "" {
+		return xmlErrorf(dec, "<attr> without a key")
+	}
+	if d.Attrs == nil {
+		d.Attrs = map[string]string{}
+	}
+	d.Attrs[a.Key] = a.Value
+	return nil
+}
+
+// =================================
+// YAML
+// Written here, read with internal/yaml
+// =================================
+
+func writeYAMLNode(b *bytes.Buffer, d NodeData, indent int, item bool) {
+	pad := strings.Repeat(" ", indent)
+	first := true
+	line := func(format string, args ...any) {
+		switch {
+		case first && item:
+			b.WriteString(strings.Repeat(" ", indent-2) + "- ")
+		default:
+			b.WriteString(pad)
+		}
+		first = false
+		fmt.Fprintf(b, format+"\n", args...)
+	}
+
+	line("kind: %s", yaml.Quote(d.Kind))
+	line("name: %s", yaml.Quote(d.Name))
+	if d.Size != 0 {
+		line("size: %d", d.Size)
+	}
+	if !d.ModTime.IsZero() {
+		line("modtime: %s", formatTime(d.ModTime))
+	}
+	if d.UniqueNames {
+		line("unique_names: true")
+	}
+	if len(d.Attrs) > 0 {
+		line("attrs:")
+		for _, k := range slices.Sorted(maps.Keys(d.Attrs)) {
+			fmt.Fprintf(b, "%s  %s: %s\n", pad, yaml.Quote(k), yaml.Quote(d.Attrs[k]))
+		}
+	}
+	if len(d.Children) > 0 {
+		line("children:")
+		for _, c := range d.Children {
+			writeYAMLNode(b, c, indent+4, true)
+		}
+	}
+}
+
+// parseYAML reads a tree from the shared YAML reader's nodes
+func parseYAML(data []byte) (NodeData, error) {
+	root, err := yaml.Parse(data)
+	var syn *yaml.SyntaxError
+	if errors.As(err, &syn) {
+		return NodeData{}, &DecodeError{Line: syn.Line, Column: syn.Column, Err: errors.New(syn.Msg)}
+	}
+	if err != nil {
+		return NodeData{}, err
+	}
+	if root == nil {
+		return NodeData{}, &DecodeError{Line: 1, Err: errors.New("empty document")}
+	}
+	if root.Kind != yaml.MappingNode {
+		return NodeData{}, yamlErrorf(root, "the root must be a mapping")
+	}
+	return yamlNode(root)
+}
+
+func yamlErrorf(n *yaml.Node, format string, args ...any) error {
+	return &DecodeError{Line: n.Line, Column: n.Column, Err: fmt.Errorf(format, args...)}
+}
+
+// yamlString returns the text of a scalar
+func yamlString(n *yaml.Node, key string) (string, error) {
+	if n.Kind != yaml.ScalarNode {
+		return "", yamlErrorf(n, "%s must be a string", key)
+	}
+	return n.Value, nil
+}
+
+// isNull reports a key written with no value
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && !n.Quoted && n.Value == ""
+}
+
+// yamlNode converts the mapping for one node
+func yamlNode(m *yaml.Node) (NodeData, error) {
+	d := NodeData{line: m.Line, column: m.Column}
+	for _, pair := range m.Pairs {
+		v := pair.Value
+		var err error
+		switch pair.Key {
+		case "kind":
+			d.Kind, err = yamlString(v, pair.Key)
+		case "name":
+			d.Name, err = yamlString(v, pair.Key)
+		case "size":
+			var s string
+			if s, err = yamlString(v, pair.Key); err == nil {
+				if d.Size, err = strconv.ParseInt(s, 10, 64); err != nil || d.Size < 0 {
+					err = yamlErrorf(v, "size %q is not a non-negative integer", s)
+				}
+			}
+		case "modtime":
+			var s string
+			if s, err = yamlString(v, pair.Key); err == nil {
+				if d.ModTime, err = parseTime(s); err != nil {
+					err = yamlErrorf(v, "%v", err)
+				}
+			}
+		case "unique_names":
+			var s string
+			if s, err = yamlString(v, pair.Key); err == nil {
+				if d.UniqueNames, err = parseBool(s); err != nil {
+					err = yamlErrorf(v, "%v", err)
+				}
+			}
+		case "attrs":
+			if isNull(v) {
+				continue
+			}
+			if v.Kind != yaml.MappingNode {
+				return NodeData{}, yamlErrorf(v, "attrs must be a mapping")
+			}
+			d.Attrs = map[string]string{}
+			for _, attr := range v.Pairs {
+				if d.Attrs[attr.Key], err = yamlString(attr.Value, "attribute "+attr.Key); err != nil {
+					break
+				}
+			}
+		case "children":
+			if isNull(v) {
+				continue
+			}
+			if v.Kind != yaml.SequenceNode {
+				return NodeData{}, yamlErrorf(v, "children must be a list")
+			}
+			for _, item := range v.Items {
+				if item.Kind != yaml.MappingNode {
+					return NodeData{}, yamlErrorf(item, "a child must be a mapping")
+				}
+				var child NodeData
+				if child, err = yamlNode(item); err != nil {
+					break
+				}
+				d.Children = append(d.Children, child)
+			}
+		default:
+			err = &DecodeError{Line: pair.Line, Column: pair.Column, Err: fmt.Errorf("unknown key %q", pair.Key)}
+		}
+		if err != nil {
+			return NodeData{}, err
+		}
+	}
+	return d, checkNode(d)
+}
+
+// Usage
+func ExecuteSerialization() {
+	root := &Composite{Name: "Root", Attrs: map[string]string{"owner": "ops"}}
+	sub := &Composite{Name: "SubFolder"}
+	if err := errors.Join(
+		root.Add(&Leaf{Name: "File1", Size: 120}),
+		sub.Add(&Leaf{Name: "File: 3", Attrs: map[string]string{"env": "prod"}}),
+		root.Add(sub),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, f := range []Format{FormatJSON, FormatYAML, FormatXML} {
+		data, err := Marshal(root, f)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		back, err := Unmarshal(data, f)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		again, err := Marshal(back, f)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%s: %d bytes, round trip identical: %t\n", f, len(data), bytes.Equal(data, again))
+	}
+
+	if yamlData, err := Marshal(root, FormatYAML); err == nil {
+		fmt.Print(string(yamlData))
+	}
+
+	_, err := Unmarshal([]byte("{\n  \"kind\": \"folder\",\n  \"name\": \"x\",\n  \"children\": [{\"kind\": \"file\" \"name\": \"y\"}]\n}"), FormatJSON)
+	fmt.Println(err)
+	_, err = Unmarshal([]byte("kind: folder\nname: x\nchildren:\n  - kind: pipe\n    name: y\n"), FormatYAML)
+	fmt.Println(err)
+	_, err = Unmarshal([]byte("<node kind=\"folder\" name=\"x\">\n  <node kind=\"file\" name=\"y\">\n</node>"), FormatXML)
+	fmt.Println(err)
+}
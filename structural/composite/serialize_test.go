@@ -0,0 +1,205 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shortcut is a custom component: a link to another path in the tree
+type shortcut struct {
+	Leaf
+	Target string
+}
+
+func (s *shortcut) MarshalNode(r *Registry) (NodeData, error) {
+	return NodeData{Kind: "shortcut", Name: s.Name, Attrs: map[string]string{"target": s.Target}}, nil
+}
+
+func decodeShortcut(r *Registry, d NodeData) (Component, error) {
+	if d.Attrs["target"] == "" {
+		return nil, errors.New("shortcut without a target")
+	}
+	return &shortcut{Leaf: Leaf{Name: d.Name}, Target: d.Attrs["target"]}, nil
+}
+
+var formats = []Format{FormatJSON, FormatYAML, FormatXML}
+
+// awkwardTree holds names and values that need quoting or escaping in
+// every format. Control characters are left out: XML 1.0 cannot hold them.
+func awkwardTree(t *testing.T) *Composite {
+	t.Helper()
+	root := &Composite{Name: "Root", ModTime: time.Date(2024, 5, 6, 7, 8, 9, 123, time.UTC), Attrs: map[string]string{"owner": "ops"}}
+	sub := &Composite{Name: "- not a list", UniqueNames: true}
+	names := []string{
+		"File: 3", "true", "123", "0x10", "# hash", "it's", `say "hi"`, `back\slash`,
+		"tab\there", "line\nbreak", "trailing ", "ünïcødé ✓", "null", "~", "'quoted'",
+	}
+	var errs []error
+	for i, name := range names {
+		errs = append(errs, sub.Add(&Leaf{Name: name, Size: int64(i), Attrs: map[string]string{name: name}}))
+	}
+	errs = append(errs,
+		root.Add(&Leaf{Name: "huge", Size: math.MaxInt64}),
+		root.Add(sub),
+		root.Add(&Composite{Name: "empty"}),
+		root.Add(&shortcut{Leaf: Leaf{Name: "latest"}, Target: "- not a list/File: 3"}),
+	)
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := NewRegistry()
+	r.Register("shortcut", decodeShortcut)
+	root := awkwardTree(t)
+	want, err := r.Encode(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range formats {
+		t.Run(string(f), func(t *testing.T) {
+			data, err := r.Marshal(root, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := r.Unmarshal(data, f)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, data)
+			}
+			got, err := r.Encode(back)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stripPositions(got), want) {
+				t.Errorf("round trip changed the tree:\n got %+v\nwant %+v\n%s", got, want, data)
+			}
+			if s, ok := back.(*Composite).Children[3].(*shortcut); !ok || s.Target != "- not a list/File: 3" {
+				t.Errorf("custom kind decoded as %#v", back.(*Composite).Children[3])
+			}
+			if sub := back.(*Composite).Children[1].(*Composite); !sub.UniqueNames {
+				t.Error("UniqueNames was lost")
+			}
+		})
+	}
+}
+
+// stripPositions clears what decoding records about the input
+func stripPositions(d NodeData) NodeData {
+	d.line, d.column = 0, 0
+	for i := range d.Children {
+		d.Children[i] = stripPositions(d.Children[i])
+	}
+	return d
+}
+
+func TestJSONSizePrecision(t *testing.T) {
+	const size = 1<<53 + 1
+	c, err := Unmarshal([]byte(fmt.Sprintf(`{"kind": "file", "name": "big", "size": %d}`, size)), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.(*Leaf).Size; got != size {
+		t.Errorf("size = %d; want %d", got, size)
+	}
+	for _, bad := range []string{"1.5", "-1", "1e3", "99999999999999999999", `"1"`} {
+		if _, err := Unmarshal([]byte(`{"kind": "file", "name": "f", "size": `+bad+`}`), FormatJSON); err == nil {
+			t.Errorf("size %s accepted", bad)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		// want is the position and message DecodeError must report
+		line, column int
+		msg          string
+	}{
+		{"json syntax", FormatJSON, "{\n  \"kind\": \"folder\",\n  \"name\": \"x\",\n  \"children\": [{\"kind\": \"file\" \"name\": \"y\"}]\n}", 4, 33, "invalid character"},
+		{"json unknown key", FormatJSON, "{\"kind\": \"file\", \"name\": \"x\", \"colour\": \"red\"}", 1, 39, `unknown key "colour"`},
+		{"json duplicate key", FormatJSON, "{\"kind\": \"file\",\n \"kind\": \"file\"}", 2, 8, `duplicate key "kind"`},
+		{"json unknown kind", FormatJSON, "{\"kind\": \"folder\", \"name\": \"x\", \"children\": [\n  {\"kind\": \"pipe\", \"name\": \"y\"}]}", 2, 3, `unknown kind "pipe"`},
+		{"yaml unknown kind", FormatYAML, "kind: folder\nname: x\nchildren:\n  - kind: pipe\n    name: y\n", 4, 5, `unknown kind "pipe"`},
+		{"yaml missing name", FormatYAML, "kind: folder\nname: x\nchildren:\n  - kind: file\n", 4, 5, "file without a name"},
+		{"yaml unknown key", FormatYAML, "kind: file\nname: x\ncolour: red\n", 3, 1, `unknown key "colour"`},
+		{"yaml bad size", FormatYAML, "kind: file\nname: x\nsize: -3\n", 3, 7, "non-negative integer"},
+		{"yaml tab", FormatYAML, "kind: folder\nname: x\nchildren:\n\t- kind: file\n", 4, 1, "tabs"},
+		{"yaml bad escape", FormatYAML, "kind: file\nname: \"\\q\"\n", 2, 7, `unknown escape \q`},
+		{"yaml file with children", FormatYAML, "kind: file\nname: x\nchildren:\n  - kind: file\n    name: y\n", 4, 5, "cannot have children"},
+		{"yaml root list", FormatYAML, "- kind: file\n  name: x\n", 1, 1, "root must be a mapping"},
+		{"yaml empty", FormatYAML, "# nothing\n", 1, 0, "empty document"},
+		{"json unique_names type", FormatJSON, "{\"kind\": \"folder\", \"name\": \"x\", \"unique_names\": \"yes\"}", 1, 54, "true or false"},
+		{"yaml duplicate in unique folder", FormatYAML, "kind: folder\nname: x\nunique_names: true\nchildren:\n  - kind: file\n    name: y\n  - kind: file\n    name: y\n", 7, 5, "duplicate name"},
+		{"yaml unique file", FormatYAML, "kind: file\nname: x\nunique_names: true\n", 1, 1, "cannot have unique names"},
+		{"xml bad unique_names", FormatXML, "<node kind=\"folder\" name=\"x\" unique_names=\"1\"></node>", 1, 47, "not true or false"},
+		{"xml unclosed", FormatXML, "<node kind=\"folder\" name=\"x\">\n  <node kind=\"file\" name=\"y\">\n</node>", 3, 0, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unmarshal([]byte(tt.input), tt.format)
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("error = %v; want a *DecodeError", err)
+			}
+			if de.Format != tt.format || de.Line != tt.line || de.Column != tt.column || !strings.Contains(de.Err.Error(), tt.msg) {
+				t.Errorf("error = %v; want %s:%d:%d: ...%s...", err, tt.format, tt.line, tt.column, tt.msg)
+			}
+		})
+	}
+}
+
+// Encoding refuses what decoding would, rather than write a file that cannot
+// be read back
+func TestMarshalRejectsUnnamed(t *testing.T) {
+	r := NewRegistry()
+	r.Register("shortcut", decodeShortcut)
+	trees := map[string]Component{
+		"unnamed root":   &Composite{},
+		"unnamed child":  &Composite{Name: "r", Children: []Component{&Leaf{Name: "a"}, &Leaf{}}},
+		"unnamed custom": &Composite{Name: "r", Children: []Component{&shortcut{Target: "a"}}},
+	}
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			for _, f := range formats {
+				if data, err := r.Marshal(tree, f); err == nil || !strings.Contains(err.Error(), "without a name") {
+					t.Errorf("%s: Marshal = %q, %v; want a missing name error", f, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestYAMLQuoting(t *testing.T) {
+	data, err := Marshal(&Leaf{Name: "x", Attrs: map[string]string{
+		"plain":   "prod",
+		"bool":    "yes",
+		"number":  "1e3",
+		"control": "\x1b",
+		"quote":   `a"b`,
+	}}, FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"plain: prod\n", `bool: "yes"`, `number: "1e3"`, `control: "\u001B"`, `quote: "a\"b"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("YAML lacks %s:\n%s", want, data)
+		}
+	}
+	// YAML escapes that Go's strconv.Unquote does not know
+	c, err := Unmarshal([]byte("kind: file\nname: \"a\\eb\\/c\\_d\"\n"), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.(*Leaf).Name; got != "a\x1bb/c\u00a0d" {
+		t.Errorf("name = %q", got)
+	}
+}
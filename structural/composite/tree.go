@@ -0,0 +1,297 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+/*
+Tree operations
+
+Leaves and Composites know their parent, so a tree can be edited after it is
+built: children can be removed, found by path and moved between folders.
+Every edit keeps the tree a tree: no node has two parents, no folder ends up
+inside itself, and folders with UniqueNames never hold two children with the
+same name.
+*/
+
+var (
+	ErrCycle         = errors.New("composite: would create a cycle")
+	ErrDuplicateName = errors.New("composite: duplicate name")
+	ErrHasParent     = errors.New("composite: component already has a parent")
+	ErrNotChild      = errors.New("composite: not a child")
+	ErrNotFound      = errors.New("composite: not found")
+)
+
+// Node is a Component that knows its name and parent. Leaf and Composite
+// implement it; custom components get it by embedding either of them.
+type Node interface {
+	Component
+	NodeName() string
+	Parent() *Composite
+	setParent(p *Composite)
+}
+
+func (l *Leaf) NodeName() string            { return l.Name }
+func (l *Leaf) Parent() *Composite          { return l.parent }
+func (l *Leaf) setParent(p *Composite)      { l.parent = p }
+func (c *Composite) NodeName() string       { return c.Name }
+func (c *Composite) Parent() *Composite     { return c.parent }
+func (c *Composite) setParent(p *Composite) { c.parent = p }
+
+// NameOf returns the name of c, or "" for components that are not a Node
+func NameOf(c Component) string {
+	if n, ok := c.(Node); ok {
+		return n.NodeName()
+	}
+	return ""
+}
+
+// canAdopt checks the invariants for making child a child of c
+func (c *Composite) canAdopt(child Component) error {
+	if child == nil {
+		return errors.New("composite: nil child")
+	}
+	if folder, ok := child.(*Composite); ok {
+		for p := c; p != nil; p = p.parent {
+			if p == folder {
+				return fmt.Errorf("%w: %s under %s", ErrCycle, folder.Name, PathOf(c))
+			}
+		}
+	}
+	if c.UniqueNames {
+		name := NameOf(child)
+		for _, existing := range c.Children {
+			if existing != child && NameOf(existing) == name {
+				return fmt.Errorf("%w: %s already has %q", ErrDuplicateName, PathOf(c), name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Composite) adopt(child Component) {
+	c.Children = append(c.Children, child)
+	if n, ok := child.(Node); ok {
+		n.setParent(c)
+	}
+}
+
+// Insert puts child at position i among c's children, checking the same
+// invariants as Add; i is clamped to the valid range
+func (c *Composite) Insert(i int, child Component) error {
+	if err := c.canAdopt(child); err != nil {
+		return err
+	}
+	if n, ok := child.(Node); ok && n.Parent() != nil {
+		return fmt.Errorf("%w: %s is already in %s", ErrHasParent, n.NodeName(), PathOf(n.Parent()))
+	}
+	c.adopt(child)
+	i = max(0, min(i, len(c.Children)-1))
+	copy(c.Children[i+1:], c.Children[i:])
+	c.Children[i] = child
+	return nil
+}
+
+// Remove detaches child from c
+func (c *Composite) Remove(child Component) error {
+	i := slices.Index(c.Children, child)
+	if i < 0 {
+		return fmt.Errorf("%w: %s of %s", ErrNotChild, NameOf(child), PathOf(c))
+	}
+	c.Children = slices.Delete(c.Children, i, i+1)
+	if n, ok := child.(Node); ok {
+		n.setParent(nil)
+	}
+	return nil
+}
+
+// Child returns the first direct child called name
+func (c *Composite) Child(name string) (Component, bool) {
+	for _, child := range c.Children {
+		if NameOf(child) == name {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// Link sets the parent of every component in a tree built with Children
+// literals, which Find(".."), PathOf and Move rely on. It checks the same
+// invariants as Add and links nothing if the tree breaks one.
+func Link(root *Composite) error {
+	if root == nil {
+		return errors.New("composite: nil root")
+	}
+	type edge struct {
+		parent *Composite
+		child  Node
+	}
+	var edges []edge
+	seen := map[Component]bool{}
+	var check func(c *Composite, above []*Composite) error
+	check = func(c *Composite, above []*Composite) error {
+		seen[c] = true
+		above = append(above, c)
+		names := map[string]bool{}
+		for _, child := range c.Children {
+			if child == nil {
+				return fmt.Errorf("composite: nil child in %s", c.Name)
+			}
+			if folder, ok := child.(*Composite); ok && slices.Contains(above, folder) {
+				return fmt.Errorf("%w: %s under %s", ErrCycle, folder.Name, c.Name)
+			}
+			n, isNode := child.(Node)
+			if seen[child] || isNode && n.Parent() != nil && n.Parent() != c {
+				return fmt.Errorf("%w: %s is in more than one folder", ErrHasParent, NameOf(child))
+			}
+			seen[child] = true
+			name := NameOf(child)
+			if c.UniqueNames && names[name] {
+				return fmt.Errorf("%w: %s already has %q", ErrDuplicateName, c.Name, name)
+			}
+			names[name] = true
+			if isNode {
+				edges = append(edges, edge{c, n})
+			}
+			if folder, ok := child.(*Composite); ok {
+				if err := check(folder, above); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(root, nil); err != nil {
+		return err
+	}
+	for _, e := range edges {
+		e.child.setParent(e.parent)
+	}
+	return nil
+}
+
+// Find resolves a slash-separated path relative to c. "" and "." are c
+// itself and ".." steps back up the path walked so far, or to c's parent
+// once the walk is back at c.
+func (c *Composite) Find(path string) (Component, error) {
+	walked := []Component{c}
+	for _, part := range strings.Split(path, "/") {
+		cur := walked[len(walked)-1]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(walked) > 1 {
+				walked = walked[:len(walked)-1]
+				continue
+			}
+			n, ok := cur.(Node)
+			if !ok || n.Parent() == nil {
+				return nil, fmt.Errorf("%w: %q steps above the root", ErrNotFound, path)
+			}
+			walked[0] = n.Parent()
+			continue
+		}
+		folder, ok := cur.(*Composite)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, %s is not a folder", ErrNotFound, path, NameOf(cur))
+		}
+		child, ok := folder.Child(part)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q in %s", ErrNotFound, path, PathOf(folder))
+		}
+		walked = append(walked, child)
+	}
+	return walked[len(walked)-1], nil
+}
+
+// Move detaches n from its parent and adds it to dst. Nothing changes if
+// the move would break an invariant.
+func Move(n Node, dst *Composite) error {
+	if n == nil || dst == nil {
+		return errors.New("composite: nil node or destination")
+	}
+	if err := dst.canAdopt(n); err != nil {
+		return err
+	}
+	if old := n.Parent(); old != nil {
+		if err := old.Remove(n); err != nil {
+			return err
+		}
+	}
+	dst.adopt(n)
+	return nil
+}
+
+// Root returns the top of the tree n belongs to
+func Root(n Node) Node {
+	for n.Parent() != nil {
+		n = n.Parent()
+	}
+	return n
+}
+
+// Depth returns how many folders are above n; a root has depth 0
+func Depth(n Node) int {
+	d := 0
+	for p := n.Parent(); p != nil; p = p.parent {
+		d++
+	}
+	return d
+}
+
+// PathOf returns the names from the root down to n joined by "/"
+func PathOf(n Node) string {
+	var parts []string
+	for ; n != nil; n = n.Parent() {
+		parts = append(parts, n.NodeName())
+		if n.Parent() == nil {
+			break
+		}
+	}
+	slices.Reverse(parts)
+	return strings.Join(parts, "/")
+}
+
+// Usage
+func ExecuteTreeOperations() {
+	root := &Composite{Name: "config", UniqueNames: true}
+	services := &Composite{Name: "services", UniqueNames: true}
+	archive := &Composite{Name: "archive"}
+	if err := errors.Join(
+		root.Add(services),
+		root.Add(archive),
+		services.Add(&Leaf{Name: "api.yaml"}),
+		services.Add(&Leaf{Name: "worker.yaml"}),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := services.Add(&Leaf{Name: "api.yaml"}); err != nil {
+		fmt.Println(err)
+	}
+	if err := Move(root, services); err != nil {
+		fmt.Println(err)
+	}
+
+	found, err := root.Find("services/worker.yaml")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	worker := found.(Node)
+	fmt.Printf("found %s at depth %d\n", PathOf(worker), Depth(worker))
+
+	if err := Move(worker, archive); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Printf("moved to %s\n", PathOf(worker))
+	if _, err := root.Find("services/worker.yaml"); err != nil {
+		fmt.Println(err)
+	}
+	root.Display("")
+}
@@ -0,0 +1,203 @@
+package composite
+
+import (
+	"errors"
+	"testing"
+)
+
+// literalTree builds config/{services/{api.yaml, worker.yaml}, archive} from
+// Children literals, so no parent is set
+func literalTree() (root, services, archive *Composite, worker *Leaf) {
+	worker = &Leaf{Name: "worker.yaml"}
+	services = &Composite{Name: "services", UniqueNames: true, Children: []Component{&Leaf{Name: "api.yaml"}, worker}}
+	archive = &Composite{Name: "archive"}
+	root = &Composite{Name: "config", Children: []Component{services, archive}}
+	return root, services, archive, worker
+}
+
+func TestAddInvariants(t *testing.T) {
+	root := &Composite{Name: "root", UniqueNames: true}
+	sub := &Composite{Name: "sub"}
+	file := &Leaf{Name: "file"}
+	if err := errors.Join(root.Add(sub), sub.Add(file)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		parent *Composite
+		child  Component
+		want   error
+	}{
+		{"has parent", root, file, ErrHasParent},
+		{"self", sub, sub, ErrCycle},
+		{"ancestor", sub, root, ErrCycle},
+		{"duplicate name", root, &Leaf{Name: "sub"}, ErrDuplicateName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.parent.Add(tt.child); !errors.Is(err, tt.want) {
+				t.Errorf("Add: error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+	if err := root.Add(nil); err == nil {
+		t.Error("Add(nil) succeeded")
+	}
+	if len(root.Children) != 1 || len(sub.Children) != 1 {
+		t.Errorf("failed adds changed the tree: root has %d, sub has %d children", len(root.Children), len(sub.Children))
+	}
+}
+
+func TestInsertPosition(t *testing.T) {
+	c := &Composite{Name: "c"}
+	for _, name := range []string{"b", "d"} {
+		if err := c.Add(&Leaf{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inserts := []struct {
+		at   int
+		name string
+	}{{1, "c"}, {-5, "a"}, {99, "e"}}
+	for _, in := range inserts {
+		if err := c.Insert(in.at, &Leaf{Name: in.name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got string
+	for _, child := range c.Children {
+		got += NameOf(child)
+	}
+	if got != "abcde" {
+		t.Errorf("children = %s; want abcde", got)
+	}
+}
+
+func TestLink(t *testing.T) {
+	root, services, _, worker := literalTree()
+	if PathOf(worker) != "worker.yaml" {
+		t.Fatalf("an unlinked leaf already has a path: %s", PathOf(worker))
+	}
+	if err := Link(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := PathOf(worker); got != "config/services/worker.yaml" {
+		t.Errorf("PathOf = %q", got)
+	}
+	if worker.Parent() != services || services.Parent() != root || root.Parent() != nil {
+		t.Error("Link set the wrong parents")
+	}
+	// Linking twice is harmless
+	if err := Link(root); err != nil {
+		t.Errorf("second Link: %v", err)
+	}
+}
+
+func TestLinkRejectsBrokenTrees(t *testing.T) {
+	shared := &Leaf{Name: "shared"}
+	loop := &Composite{Name: "loop"}
+	loop.Children = []Component{&Composite{Name: "inner", Children: []Component{loop}}}
+	adopted := &Leaf{Name: "adopted"}
+	if err := (&Composite{Name: "other"}).Add(adopted); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		root *Composite
+		want error
+	}{
+		{"shared child", &Composite{Name: "r", Children: []Component{
+			&Composite{Name: "a", Children: []Component{shared}},
+			&Composite{Name: "b", Children: []Component{shared}},
+		}}, ErrHasParent},
+		{"cycle", loop, ErrCycle},
+		{"duplicate name", &Composite{Name: "r", UniqueNames: true, Children: []Component{&Leaf{Name: "x"}, &Leaf{Name: "x"}}}, ErrDuplicateName},
+		{"already adopted", &Composite{Name: "r", Children: []Component{adopted}}, ErrHasParent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Link(tt.root); !errors.Is(err, tt.want) {
+				t.Errorf("Link: error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+	// A failed Link sets no parent at all
+	if shared.Parent() != nil {
+		t.Errorf("failed Link left shared under %s", shared.Parent().Name)
+	}
+	if err := Link(&Composite{Name: "r", Children: []Component{nil}}); err == nil {
+		t.Error("Link accepted a nil child")
+	}
+	if err := Link(nil); err == nil {
+		t.Error("Link(nil) succeeded")
+	}
+}
+
+func TestFind(t *testing.T) {
+	// Without Link, ".." still steps back along the walked path
+	root, services, archive, worker := literalTree()
+	tests := []struct {
+		path string
+		want Component
+	}{
+		{"", root},
+		{".", root},
+		{"services/worker.yaml", worker},
+		{"services/../archive", archive},
+		{"services/worker.yaml/../..", root},
+		{"./services//worker.yaml/", worker},
+	}
+	for _, tt := range tests {
+		got, err := root.Find(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("Find(%q) = %v, %v; want %s", tt.path, got, err, NameOf(tt.want))
+		}
+	}
+
+	for _, path := range []string{"..", "services/../..", "missing", "services/api.yaml/deeper"} {
+		if _, err := root.Find(path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Find(%q): error = %v; want ErrNotFound", path, err)
+		}
+	}
+
+	// Once linked, ".." from a subtree reaches above where the walk began
+	if err := Link(root); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := services.Find("../archive"); err != nil || got != archive {
+		t.Errorf("services.Find(../archive) = %v, %v", got, err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	root, services, archive, worker := literalTree()
+	if err := Link(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := Move(worker, archive); err != nil {
+		t.Fatal(err)
+	}
+	if PathOf(worker) != "config/archive/worker.yaml" || len(services.Children) != 1 {
+		t.Errorf("after Move: path %s, services has %d children", PathOf(worker), len(services.Children))
+	}
+	if Depth(worker) != 2 || Root(worker) != Node(root) {
+		t.Errorf("Depth = %d, Root = %s", Depth(worker), Root(worker).NodeName())
+	}
+
+	if err := Move(root, services); !errors.Is(err, ErrCycle) {
+		t.Errorf("Move under itself: error = %v; want ErrCycle", err)
+	}
+	if err := Move(&Leaf{Name: "api.yaml"}, services); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("Move onto a taken name: error = %v; want ErrDuplicateName", err)
+	}
+	if err := Move(worker, nil); err == nil {
+		t.Error("Move to nil succeeded")
+	}
+	if err := Move(nil, archive); err == nil {
+		t.Error("Move of nil succeeded")
+	}
+	if worker.Parent() != archive {
+		t.Error("a failed Move changed the tree")
+	}
+}
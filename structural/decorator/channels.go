@@ -0,0 +1,293 @@
+package decorator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/mailer"
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+/*
+Delivery channels
+
+EmailNotifier and friends print. SMTPNotifier, WebhookNotifier and
+SlackNotifier deliver for real and report what went wrong. Failures that
+will not go away by trying again (a mailbox that does not exist, a 400 from
+a webhook) are marked Permanent, so RetryDecorator gives up on them at once
+and CircuitBreakerDecorator does not count them against the channel.
+
+ChannelDecorator does what SMSDecorator and SlackDecorator do, sending
+through the wrapped Notifier and then through one more channel, but with a
+real channel instead of a print.
+*/
+
+// SMTPNotifier mails each message to To through the server at Addr. Refused
+// mailboxes are reported after the others have been sent to, as a permanent
+// error so a retry does not mail the rest twice.
+type SMTPNotifier struct {
+	Addr    string
+	From    string
+	To      []string
+	Subject string
+	// Auth is used when the server offers AUTH; nil sends without it
+	Auth smtp.Auth
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, message string) error {
+	return n.SendContent(ctx, Content{Subject: n.Subject, Text: message})
+}
+
+// SendContent mails c, as multipart/alternative when it has an HTML body.
+// An empty subject falls back to Subject.
+func (n *SMTPNotifier) SendContent(ctx context.Context, c Content) error {
+	subject := c.Subject
+	if subject == "" {
+		subject = n.Subject
+	}
+	err := mailer.Send(ctx, n.Addr, n.Auth, mailer.Message{
+		From: n.From, To: n.To, Subject: subject, Text: c.Text, HTML: c.HTML,
+	})
+	return smtpError(err)
+}
+
+// smtpError marks what another try would not fix as permanent: 5xx
+// replies, and any refused mailbox once the message went to the others, as
+// a retry would mail them again. Only when no mailbox took the message is
+// a 4xx refusal worth retrying.
+func smtpError(err error) error {
+	var me *mailer.Error
+	if errors.As(err, &me) && me.Recipient != "" && !errors.Is(err, mailer.ErrNoRecipients) {
+		return Permanent(err)
+	}
+	return markReplies(err)
+}
+
+// markReplies marks 5xx replies as permanent, one by one when several
+// mailboxes were refused
+func markReplies(err error) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		marked := make([]error, len(errs))
+		for i, e := range errs {
+			marked[i] = markReplies(e)
+		}
+		return errors.Join(marked...)
+	}
+	var me *mailer.Error
+	if errors.As(err, &me) && me.Permanent() {
+		return Permanent(err)
+	}
+	return err
+}
+
+// HTTPStatusError is a webhook response outside 2xx
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("http status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// WebhookNotifier posts each message as JSON to URL
+type WebhookNotifier struct {
+	URL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Header is added to every request, for example an Authorization token
+	Header http.Header
+	// Payload builds the JSON body; by default {"message": ..., "sent_at": ...}
+	Payload func(message string) any
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, message string) error {
+	var payload any = map[string]any{"message": message, "sent_at": time.Now().UTC().Format(time.RFC3339)}
+	if n.Payload != nil {
+		payload = n.Payload(message)
+	}
+	if err := postJSON(ctx, n.Client, n.URL, n.Header, payload); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
+
+// SlackNotifier posts to a Slack incoming webhook, or anything that accepts
+// the same payload
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+	// Channel, Username and IconEmoji override the webhook's defaults
+	Channel   string
+	Username  string
+	IconEmoji string
+}
+
+// SlackPayload is the body of an incoming-webhook request
+type SlackPayload struct {
+	Text      string       `json:"text"`
+	Blocks    []SlackBlock `json:"blocks,omitempty"`
+	Channel   string       `json:"channel,omitempty"`
+	Username  string       `json:"username,omitempty"`
+	IconEmoji string       `json:"icon_emoji,omitempty"`
+}
+
+func (n *SlackNotifier) Send(ctx context.Context, message string) error {
+	return n.SendContent(ctx, Content{Text: message})
+}
+
+// SendContent posts c.Blocks with c.Text as the notification fallback
+func (n *SlackNotifier) SendContent(ctx context.Context, c Content) error {
+	payload := SlackPayload{Text: c.Text, Blocks: c.Blocks, Channel: n.Channel, Username: n.Username, IconEmoji: n.IconEmoji}
+	if err := postJSON(ctx, n.Client, n.WebhookURL, nil, payload); err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	return nil
+}
+
+// postJSON posts v and turns any non-2xx response into an HTTPStatusError,
+// permanent for client errors other than 408 and 429
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	serr := &HTTPStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(text))}
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(serr)
+	}
+	return serr
+}
+
+// ChannelDecorator sends through the wrapped Notifier and then through
+// Channel. If the wrapped Notifier fails, Channel is not tried.
+type ChannelDecorator struct {
+	NotifierDecorator
+	Channel Notifier
+}
+
+// NewChannelDecorator adds channel after n
+func NewChannelDecorator(n Notifier, channel Notifier) *ChannelDecorator {
+	return &ChannelDecorator{NotifierDecorator{wrapped: n}, channel}
+}
+
+func (d *ChannelDecorator) Send(ctx context.Context, message string) error {
+	if err := d.NotifierDecorator.Send(ctx, message); err != nil {
+		return err
+	}
+	return d.Channel.Send(ctx, message)
+}
+
+// SendContent is Send for Content; each Notifier that cannot take Content
+// gets c.Text
+func (d *ChannelDecorator) SendContent(ctx context.Context, c Content) error {
+	if err := sendContent(ctx, d.wrapped, c); err != nil {
+		return err
+	}
+	return sendContent(ctx, d.Channel, c)
+}
+
+// Unwrap returns both Notifiers this decorator sends through
+func (d *ChannelDecorator) Unwrap() []Notifier {
+	return []Notifier{d.wrapped, d.Channel}
+}
+
+// Usage
+func ExecuteChannels() {
+	ctx := context.Background()
+
+	mailServer, err := smtpstub.Start()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer mailServer.Close()
+	mailServer.Reject = func(rcpt string) bool { return strings.HasPrefix(rcpt, "gone@") }
+
+	// The handlers run on the servers' goroutines
+	var mu sync.Mutex
+	var hooks, slack []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct{ Message string }
+		json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		defer mu.Unlock()
+		hooks = append(hooks, r.Header.Get("Authorization")+" "+p.Message)
+	}))
+	defer webhook.Close()
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p SlackPayload
+		if json.NewDecoder(r.Body).Decode(&p) != nil || p.Text == "" {
+			http.Error(w, "invalid_payload", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		slack = append(slack, p.Channel+" "+p.Text)
+		mu.Unlock()
+		io.WriteString(w, "ok")
+	}))
+	defer slackServer.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	email := &SMTPNotifier{Addr: mailServer.Addr(), From: "alerts@example.com", To: []string{"ops@example.com"}, Subject: "Alert"}
+	hook := &WebhookNotifier{URL: webhook.URL, Header: http.Header{"Authorization": {"Bearer t0ken"}}}
+	chat := &SlackNotifier{WebhookURL: slackServer.URL, Channel: "#ops"}
+
+	all := NewChannelDecorator(NewChannelDecorator(email, hook), chat)
+	fmt.Println("all channels:", all.Send(ctx, "deploy v1.4.2 finished"))
+	mu.Lock()
+	fmt.Printf("  smtp accepted %d, webhook got %q, slack got %q\n", len(mailServer.Messages()), hooks, slack)
+	mu.Unlock()
+
+	partly := &SMTPNotifier{Addr: mailServer.Addr(), From: "alerts@example.com", To: []string{"ops@example.com", "gone@example.com"}, Subject: "Alert"}
+	err = partly.Send(ctx, "disk almost full")
+	fmt.Printf("one mailbox refused: %v (permanent: %t)\n", err, errors.Is(err, ErrPermanent))
+
+	err = (&SlackNotifier{WebhookURL: slackServer.URL}).Send(ctx, "")
+	fmt.Printf("bad slack payload: %v (permanent: %t)\n", err, errors.Is(err, ErrPermanent))
+
+	clock := NewFakeClock(time.Now())
+	retried := NewRetryDecorator(&WebhookNotifier{URL: broken.URL}, RetryOptions{Attempts: 3, Clock: clock})
+	fmt.Println("unavailable webhook:", retried.Send(ctx, "build failed"))
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	fmt.Println("nothing listening:", (&WebhookNotifier{URL: closed.URL}).Send(ctx, "build failed") != nil)
+}
@@ -0,0 +1,208 @@
+package decorator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/mailer"
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+func startSMTP(t *testing.T) *smtpstub.Server {
+	t.Helper()
+	server, err := smtpstub.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := startSMTP(t)
+	server.Reject = func(rcpt string) bool { return strings.HasPrefix(rcpt, "gone@") }
+	ctx := context.Background()
+	n := &SMTPNotifier{Addr: server.Addr(), From: "alerts@example.com", To: []string{"ops@example.com"}, Subject: "Alert"}
+
+	if err := n.Send(ctx, "disk full"); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SendContent(ctx, Content{Subject: "Deploy", Text: "done"}); err != nil {
+		t.Fatal(err)
+	}
+	got := server.Messages()
+	if len(got) != 2 || !strings.Contains(got[0].Data, "Subject: Alert") || !strings.Contains(got[1].Data, "Subject: Deploy") {
+		t.Errorf("server got %d messages, want the default subject then the content's:\n%v", len(got), got)
+	}
+
+	// A refused mailbox is permanent, and the others still get the message
+	n.To = []string{"ops@example.com", "gone@example.com"}
+	err := n.Send(ctx, "disk full")
+	var me *mailer.Error
+	if !errors.Is(err, ErrPermanent) || !errors.As(err, &me) || me.Recipient != "gone@example.com" {
+		t.Errorf("Send = %v; want a permanent refusal of gone@example.com", err)
+	}
+	if len(server.Messages()) != 3 {
+		t.Errorf("server has %d messages; want the third, to ops", len(server.Messages()))
+	}
+
+	n.To = []string{"gone@example.com"}
+	if err := n.Send(ctx, "disk full"); !errors.Is(err, ErrPermanent) || !errors.Is(err, mailer.ErrNoRecipients) {
+		t.Errorf("every mailbox refused: Send = %v; want permanent ErrNoRecipients", err)
+	}
+}
+
+// A mailbox refused for now is worth retrying only if nobody got the
+// message; otherwise a retry would mail the others twice
+func TestSMTPNotifierTemporaryRefusal(t *testing.T) {
+	server := startSMTP(t)
+	server.Defer = func(rcpt string) bool { return strings.HasPrefix(rcpt, "busy@") }
+	ctx := context.Background()
+	n := &SMTPNotifier{Addr: server.Addr(), From: "alerts@example.com", To: []string{"busy@example.com"}}
+
+	if err := n.Send(ctx, "disk full"); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("only mailbox busy: Send = %v; want an error worth retrying", err)
+	}
+
+	n.To = []string{"ops@example.com", "busy@example.com"}
+	var calls atomic.Int32
+	counted := notifierFunc(func(ctx context.Context, message string) error {
+		calls.Add(1)
+		return n.Send(ctx, message)
+	})
+	err := NewRetryDecorator(counted, RetryOptions{Clock: NewFakeClock(testStart)}).Send(ctx, "disk full")
+	var me *mailer.Error
+	if !errors.Is(err, ErrPermanent) || !errors.As(err, &me) || me.Recipient != "busy@example.com" {
+		t.Errorf("one mailbox busy: Send = %v; want a permanent refusal of busy@example.com", err)
+	}
+	if calls.Load() != 1 || len(server.Messages()) != 1 {
+		t.Errorf("%d tries and %d messages; want ops mailed once", calls.Load(), len(server.Messages()))
+	}
+}
+
+func TestSMTPNotifierUnreachable(t *testing.T) {
+	server := startSMTP(t)
+	addr := server.Addr()
+	server.Close()
+	err := (&SMTPNotifier{Addr: addr, From: "a@example.com", To: []string{"b@example.com"}}).Send(context.Background(), "hi")
+	if err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("Send to a closed server = %v; want an error worth retrying", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got struct {
+		Auth, Type string
+		Body       map[string]any
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Auth, got.Type = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got.Body)
+	}))
+	defer server.Close()
+
+	n := &WebhookNotifier{URL: server.URL, Header: http.Header{"Authorization": {"Bearer t0ken"}}}
+	if err := n.Send(context.Background(), "deployed"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Auth != "Bearer t0ken" || got.Type != "application/json" || got.Body["message"] != "deployed" || got.Body["sent_at"] == nil {
+		t.Errorf("server got %+v", got)
+	}
+
+	n.Payload = func(message string) any { return map[string]string{"text": message} }
+	if err := n.Send(context.Background(), "custom"); err != nil || got.Body["text"] != "custom" {
+		t.Errorf("custom payload: Send = %v, server got %v", err, got.Body)
+	}
+
+	n.Payload = func(string) any { return make(chan int) }
+	if err := n.Send(context.Background(), "x"); !errors.Is(err, ErrPermanent) {
+		t.Errorf("unencodable payload: Send = %v; want a permanent error", err)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusNotFound, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "  went wrong\n", tt.status)
+			}))
+			defer server.Close()
+
+			err := (&WebhookNotifier{URL: server.URL}).Send(context.Background(), "hi")
+			var se *HTTPStatusError
+			if !errors.As(err, &se) || se.StatusCode != tt.status || se.Body != "went wrong" {
+				t.Fatalf("Send = %v; want an HTTPStatusError %d with the trimmed body", err, tt.status)
+			}
+			if errors.Is(err, ErrPermanent) != tt.permanent {
+				t.Errorf("permanent = %t; want %t", !tt.permanent, tt.permanent)
+			}
+		})
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if err := (&WebhookNotifier{URL: closed.URL}).Send(context.Background(), "hi"); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("nothing listening: Send = %v; want an error worth retrying", err)
+	}
+	if err := (&WebhookNotifier{URL: "::not a url"}).Send(context.Background(), "hi"); !errors.Is(err, ErrPermanent) {
+		t.Errorf("bad URL: Send = %v; want a permanent error", err)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var got SlackPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = SlackPayload{}
+		if json.NewDecoder(r.Body).Decode(&got) != nil || got.Text == "" {
+			http.Error(w, "invalid_payload", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	n := &SlackNotifier{WebhookURL: server.URL, Channel: "#ops", Username: "bot"}
+	blocks := []SlackBlock{{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "*done*"}}}
+	if err := n.SendContent(context.Background(), Content{Text: "done", Blocks: blocks}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "done" || got.Channel != "#ops" || got.Username != "bot" || len(got.Blocks) != 1 || got.Blocks[0].Text.Text != "*done*" {
+		t.Errorf("server got %+v", got)
+	}
+
+	err := n.Send(context.Background(), "")
+	var se *HTTPStatusError
+	if !errors.Is(err, ErrPermanent) || !errors.As(err, &se) || se.Body != "invalid_payload" {
+		t.Errorf("empty text: Send = %v; want a permanent invalid_payload", err)
+	}
+}
+
+func TestChannelDecorator(t *testing.T) {
+	var first, second atomic.Int32
+	d := NewChannelDecorator(failing(1, &first), failing(0, &second))
+	if err := d.Send(context.Background(), "hi"); !errors.Is(err, errBusy) || second.Load() != 0 {
+		t.Errorf("Send = %v with %d sends to the channel; want errBusy and none", err, second.Load())
+	}
+	if err := d.Send(context.Background(), "hi"); err != nil || second.Load() != 1 {
+		t.Errorf("Send = %v with %d sends to the channel; want one", err, second.Load())
+	}
+}
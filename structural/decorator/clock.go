@@ -0,0 +1,140 @@
+package decorator
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+Clocks
+
+Decorators that wait (backoff, timeouts, cool-downs) read time through a
+Clock instead of the time package. SystemClock is the real one. FakeClock
+only moves when told to, either by Advance or by someone sleeping on it, so
+a run that involves minutes of backoff finishes instantly and always the
+same way.
+*/
+
+// Clock is the time source of the decorators in this package
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d or until ctx is done, whichever comes first
+	Sleep(ctx context.Context, d time.Duration) error
+	// AfterFunc calls f once d has passed; stop cancels the call and
+	// reports whether it was still pending
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// orSystem returns c, or SystemClock when c is nil
+func orSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// FakeClock is a Clock for tests and examples. Sleep advances the clock by
+// the requested duration (firing any timers on the way) instead of waiting,
+// and Advance does the same for code that does not sleep itself.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	f  func()
+}
+
+// NewFakeClock returns a FakeClock set to start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		i := slices.Index(c.timers, t)
+		if i < 0 {
+			return false
+		}
+		c.timers = slices.Delete(c.timers, i, i+1)
+		return true
+	}
+}
+
+// Advance moves the clock forward by d, firing due timers in order
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Sleep(context.Background(), d)
+}
+
+// Sleep moves the clock forward by d, firing due timers in order. It stops
+// early, at the time of the timer that cancelled it, if ctx is done.
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		if err := ctx.Err(); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		next := -1
+		for i, t := range c.timers {
+			if !t.at.After(target) && (next < 0 || t.at.Before(c.timers[next].at)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		t := c.timers[next]
+		c.timers = slices.Delete(c.timers, next, next+1)
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	if target.After(c.now) {
+		c.now = target
+	}
+	c.mu.Unlock()
+	return nil
+}
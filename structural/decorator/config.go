@@ -0,0 +1,641 @@
+package decorator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/yaml"
+)
+
+/*
+Pipelines from configuration
+
+A PipelineConfig declares channels, the order they are used in and the
+decorators around each channel and around the whole pipeline. A Registry
+maps the type names used in the configuration to factories, checks every
+parameter and builds the stack. Decorators are listed outermost first, the
+way the stack reads from the caller's side. The built Pipeline can print
+the stack it is made of, with tokens, passwords and the like left out.
+YAML is read with the subset parser in internal/yaml.
+
+	mode: fanout            # or sequential (the default)
+	policy: best-effort
+	channels:
+	  - name: ops-mail
+	    type: smtp
+	    params:
+	      addr: mail.example.com:25
+	      from: alerts@example.com
+	      to: [ops@example.com]
+	    decorators:
+	      - type: retry
+	        params:
+	          attempts: 3
+	          base_delay: 200ms
+*/
+
+var ErrInvalidConfig = errors.New("decorator: invalid config")
+
+// ConfigFormat selects how ParseConfig reads its input
+type ConfigFormat int
+
+const (
+	ConfigJSON ConfigFormat = iota
+	ConfigYAML
+)
+
+// PipelineConfig describes a notification pipeline
+type PipelineConfig struct {
+	// Mode is "sequential" (each channel after the other, stopping at the
+	// first failure) or "fanout" (all channels at once)
+	Mode string `json:"mode,omitempty"`
+	// Policy and Limit configure fanout mode; see FanOutPolicy
+	Policy     string            `json:"policy,omitempty"`
+	Limit      int               `json:"limit,omitempty"`
+	Channels   []ChannelConfig   `json:"channels"`
+	Decorators []DecoratorConfig `json:"decorators,omitempty"`
+}
+
+// ChannelConfig is one channel and the decorators around it
+type ChannelConfig struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Params     map[string]any    `json:"params,omitempty"`
+	Decorators []DecoratorConfig `json:"decorators,omitempty"`
+}
+
+// DecoratorConfig is one decorator and its parameters
+type DecoratorConfig struct {
+	Type   string         `json:"type"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// ParseConfig reads a PipelineConfig; unknown fields are errors
+func ParseConfig(data []byte, format ConfigFormat) (*PipelineConfig, error) {
+	switch format {
+	case ConfigJSON:
+	case ConfigYAML:
+		node, err := yaml.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		if data, err = json.Marshal(node.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	default:
+		return nil, fmt.Errorf("decorator: unknown config format %d", format)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg PipelineConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return &cfg, nil
+}
+
+// Args gives factories typed access to parameters. Every getter records a
+// problem instead of failing, so one build reports every mistake; keys no
+// getter asked for are reported as unknown.
+type Args struct {
+	params map[string]any
+	used   map[string]bool
+	errs   []error
+}
+
+func newArgs(params map[string]any) *Args {
+	return &Args{params: params, used: map[string]bool{}}
+}
+
+func (a *Args) get(key string, required bool) (any, bool) {
+	a.used[key] = true
+	v, ok := a.params[key]
+	if !ok && required {
+		a.errs = append(a.errs, fmt.Errorf("missing parameter %q", key))
+	}
+	return v, ok
+}
+
+func (a *Args) bad(key, want string, v any) {
+	a.errs = append(a.errs, fmt.Errorf("parameter %q: want %s, got %v", key, want, v))
+}
+
+// String returns a string parameter, or def if it is not set
+func (a *Args) String(key, def string) string {
+	v, ok := a.get(key, false)
+	if !ok {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok {
+		a.bad(key, "a string", v)
+	}
+	return s
+}
+
+// RequiredString returns a string parameter that must be set
+func (a *Args) RequiredString(key string) string {
+	if _, ok := a.get(key, true); !ok {
+		return ""
+	}
+	return a.String(key, "")
+}
+
+// Float returns a number parameter, or def if it is not set
+func (a *Args) Float(key string, def float64) float64 {
+	v, ok := a.get(key, false)
+	if !ok {
+		return def
+	}
+	f, ok := v.(float64)
+	if !ok {
+		a.bad(key, "a number", v)
+	}
+	return f
+}
+
+// Int returns a whole number parameter, or def if it is not set
+func (a *Args) Int(key string, def int) int {
+	v, ok := a.get(key, false)
+	if !ok {
+		return def
+	}
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) {
+		a.bad(key, "a whole number", v)
+	}
+	return int(f)
+}
+
+// Bool returns a boolean parameter, or def if it is not set
+func (a *Args) Bool(key string, def bool) bool {
+	v, ok := a.get(key, false)
+	if !ok {
+		return def
+	}
+	b, ok := v.(bool)
+	if !ok {
+		a.bad(key, "true or false", v)
+	}
+	return b
+}
+
+// Duration returns a duration written like "1.5s", or a number of seconds,
+// or def if it is not set
+func (a *Args) Duration(key string, def time.Duration) time.Duration {
+	v, ok := a.get(key, false)
+	if !ok {
+		return def
+	}
+	switch v := v.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	a.bad(key, "a duration", v)
+	return def
+}
+
+// Strings returns a list of strings; a single string counts as a list of one
+func (a *Args) Strings(key string, required bool) []string {
+	v, ok := a.get(key, required)
+	if !ok {
+		return nil
+	}
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				a.bad(key, "a list of strings", v)
+				return nil
+			}
+			out[i] = s
+		}
+		return out
+	}
+	a.bad(key, "a list of strings", v)
+	return nil
+}
+
+// Errs returns every problem found so far, including unknown parameters
+func (a *Args) Errs() []error {
+	errs := slices.Clone(a.errs)
+	for _, key := range slices.Sorted(maps.Keys(a.params)) {
+		if !a.used[key] {
+			errs = append(errs, fmt.Errorf("unknown parameter %q", key))
+		}
+	}
+	return errs
+}
+
+// ChannelFactory builds a channel from its parameters
+type ChannelFactory func(args *Args) (Notifier, error)
+
+// DecoratorFactory wraps n in a decorator built from its parameters
+type DecoratorFactory func(n Notifier, args *Args) (Notifier, error)
+
+// Registry knows the channel and decorator types a configuration may use
+type Registry struct {
+	// Clock is handed to the decorators that need one
+	Clock      Clock
+	channels   map[string]ChannelFactory
+	decorators map[string]DecoratorFactory
+}
+
+// NewRegistry returns a Registry with the channels and decorators of this
+// package: channels "console", "smtp", "webhook" and "slack"; decorators
+// "retry", "timeout", "circuit_breaker", "rate_limit" and "template"
+func NewRegistry() *Registry {
+	r := &Registry{Clock: SystemClock, channels: map[string]ChannelFactory{}, decorators: map[string]DecoratorFactory{}}
+
+	r.RegisterChannel("console", func(a *Args) (Notifier, error) {
+		return &ConsoleNotifier{Prefix: a.String("prefix", "")}, nil
+	})
+	r.RegisterChannel("smtp", func(a *Args) (Notifier, error) {
+		return &SMTPNotifier{
+			Addr: a.RequiredString("addr"), From: a.RequiredString("from"),
+			To: a.Strings("to", true), Subject: a.String("subject", "Notification"),
+		}, nil
+	})
+	r.RegisterChannel("webhook", func(a *Args) (Notifier, error) {
+		n := &WebhookNotifier{URL: a.RequiredString("url")}
+		if token := a.String("bearer_token", ""); token != "" {
+			n.Header = http.Header{"Authorization": {"Bearer " + token}}
+		}
+		return n, nil
+	})
+	r.RegisterChannel("slack", func(a *Args) (Notifier, error) {
+		return &SlackNotifier{
+			WebhookURL: a.RequiredString("webhook_url"), Channel: a.String("channel", ""),
+			Username: a.String("username", ""), IconEmoji: a.String("icon_emoji", ""),
+		}, nil
+	})
+
+	r.RegisterDecorator("retry", func(n Notifier, a *Args) (Notifier, error) {
+		// RetryOptions reads 0 as the default; written out, it is a mistake
+		attempts := a.Int("attempts", 3)
+		if attempts < 1 {
+			return nil, errors.New("attempts must be at least 1")
+		}
+		return NewRetryDecorator(n, RetryOptions{
+			Attempts: attempts, BaseDelay: a.Duration("base_delay", 0),
+			MaxDelay: a.Duration("max_delay", 0), Multiplier: a.Float("multiplier", 0),
+			Jitter: a.Float("jitter", 0), Clock: r.Clock,
+		}), nil
+	})
+	r.RegisterDecorator("timeout", func(n Notifier, a *Args) (Notifier, error) {
+		d := a.Duration("timeout", 0)
+		if d <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+		return NewTimeoutDecorator(n, d, r.Clock), nil
+	})
+	r.RegisterDecorator("circuit_breaker", func(n Notifier, a *Args) (Notifier, error) {
+		return NewCircuitBreakerDecorator(n, BreakerOptions{
+			FailureThreshold: a.Int("failure_threshold", 0), Cooldown: a.Duration("cooldown", 0),
+			HalfOpenSuccesses: a.Int("half_open_successes", 0), Clock: r.Clock,
+		}), nil
+	})
+	r.RegisterDecorator("rate_limit", func(n Notifier, a *Args) (Notifier, error) {
+		rate, per := a.Float("rate", 0), a.Duration("per", time.Second)
+		if per <= 0 {
+			return nil, errors.New("per must be positive")
+		}
+		if rate /= per.Seconds(); rate <= 0 {
+			return nil, errors.New("rate must be positive")
+		}
+		d := NewRateLimitDecorator(n, rate, a.Int("burst", 1), r.Clock)
+		d.Reject = a.Bool("reject", false)
+		return d, nil
+	})
+	r.RegisterDecorator("template", func(n Notifier, a *Args) (Notifier, error) {
+		return NewTemplateDecorator(n, a.RequiredString("text"))
+	})
+	return r
+}
+
+// RegisterChannel adds or replaces a channel type
+func (r *Registry) RegisterChannel(name string, f ChannelFactory) {
+	r.channels[name] = f
+}
+
+// RegisterDecorator adds or replaces a decorator type
+func (r *Registry) RegisterDecorator(name string, f DecoratorFactory) {
+	r.decorators[name] = f
+}
+
+// Pipeline is a Notifier built from a PipelineConfig
+type Pipeline struct {
+	Notifier
+	stack *stackEntry
+}
+
+// Unwrap returns the outermost Notifier of the pipeline
+func (p *Pipeline) Unwrap() Notifier {
+	return p.Notifier
+}
+
+// stackEntry is one layer of a built pipeline, for String
+type stackEntry struct {
+	label string
+	inner []*stackEntry
+}
+
+// String draws the stack, outermost layer first
+func (p *Pipeline) String() string {
+	var b strings.Builder
+	var draw func(e *stackEntry, prefix string, last, root bool)
+	draw = func(e *stackEntry, prefix string, last, root bool) {
+		next := prefix
+		if root {
+			b.WriteString(e.label + "\n")
+		} else if last {
+			b.WriteString(prefix + "└── " + e.label + "\n")
+			next += "    "
+		} else {
+			b.WriteString(prefix + "├── " + e.label + "\n")
+			next += "│   "
+		}
+		for i, c := range e.inner {
+			draw(c, next, i == len(e.inner)-1, false)
+		}
+	}
+	draw(p.stack, "", true, true)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// label is a type name followed by its parameters in key order. Secret
+// parameters are masked and URLs cut down to their scheme and host.
+func label(kind string, params map[string]any) string {
+	parts := []string{kind}
+	for _, k := range slices.Sorted(maps.Keys(params)) {
+		v := params[k]
+		if secretParam(k) {
+			v = "***"
+		} else if s, ok := v.(string); ok {
+			v = redactURL(s)
+		}
+		if list, ok := v.([]any); ok {
+			s := make([]string, len(list))
+			for i, item := range list {
+				s[i] = fmt.Sprint(item)
+			}
+			v = "[" + strings.Join(s, ",") + "]"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// redactURL keeps only the scheme and host of a URL, marking what it drops:
+// user info, paths and queries can all hold tokens, as Slack's webhook URLs
+// do. Anything else is returned as it is.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	short := u.Scheme + "://" + u.Host
+	if u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		short += "/***"
+	}
+	return short
+}
+
+// secretParam reports whether a parameter name looks like it holds a
+// credential
+func secretParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"token", "password", "secret", "key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build validates cfg and assembles it. All problems are reported together,
+// each prefixed with where in the configuration it was found.
+func (r *Registry) Build(cfg *PipelineConfig) (*Pipeline, error) {
+	var errs []error
+	fail := func(where string, problems ...error) {
+		for _, err := range problems {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			}
+		}
+	}
+
+	mode := cfg.Mode
+	if mode == "" {
+		mode = "sequential"
+	}
+	var policy FanOutPolicy
+	switch mode {
+	case "sequential":
+		if cfg.Policy != "" || cfg.Limit != 0 {
+			fail("policy", errors.New("policy and limit only apply to fanout mode"))
+		}
+	case "fanout":
+		switch cfg.Policy {
+		case "", "all-must-succeed":
+			policy = AllMustSucceed
+		case "at-least-one":
+			policy = AtLeastOne
+		case "best-effort":
+			policy = BestEffort
+		default:
+			fail("policy", fmt.Errorf("unknown policy %q", cfg.Policy))
+		}
+		if cfg.Limit < 0 {
+			fail("limit", errors.New("must not be negative"))
+		}
+	default:
+		fail("mode", fmt.Errorf("unknown mode %q", cfg.Mode))
+	}
+	if len(cfg.Channels) == 0 {
+		fail("channels", errors.New("at least one channel is required"))
+	}
+
+	var channels []Channel
+	var entries []*stackEntry
+	seen := map[string]bool{}
+	for i, cc := range cfg.Channels {
+		where := fmt.Sprintf("channels[%d]", i)
+		if cc.Name == "" {
+			fail(where, errors.New("name is required"))
+		} else if seen[cc.Name] {
+			fail(where, fmt.Errorf("duplicate channel name %q", cc.Name))
+		}
+		seen[cc.Name] = true
+
+		var n Notifier
+		entry := &stackEntry{label: label(cc.Type, cc.Params)}
+		if factory, ok := r.channels[cc.Type]; !ok {
+			fail(where, fmt.Errorf("unknown channel type %q", cc.Type))
+		} else {
+			args := newArgs(cc.Params)
+			built, err := factory(args)
+			fail(where, append([]error{err}, args.Errs()...)...)
+			n = built
+		}
+		n, entry = r.decorate(n, entry, cc.Decorators, where+".decorators", fail)
+		channels = append(channels, Channel{Name: cc.Name, Notifier: n})
+		entries = append(entries, &stackEntry{label: cc.Name, inner: []*stackEntry{entry}})
+	}
+
+	var n Notifier
+	var entry *stackEntry
+	if mode == "fanout" {
+		n = &FanOutNotifier{Channels: channels, Limit: cfg.Limit, Policy: policy}
+		entry = &stackEntry{label: fmt.Sprintf("fanout policy=%v limit=%d", policy, cfg.Limit), inner: entries}
+	} else {
+		entry = &stackEntry{label: "sequential", inner: entries}
+		if len(errs) == 0 {
+			n = channels[0].Notifier
+			for _, ch := range channels[1:] {
+				n = NewChannelDecorator(n, ch.Notifier)
+			}
+		}
+	}
+	n, entry = r.decorate(n, entry, cfg.Decorators, "decorators", fail)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w:\n%w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return &Pipeline{Notifier: n, stack: entry}, nil
+}
+
+// decorate wraps n in decorators, given outermost first, and returns the
+// outermost Notifier and stack entry
+func (r *Registry) decorate(n Notifier, entry *stackEntry, decorators []DecoratorConfig, where string, fail func(string, ...error)) (Notifier, *stackEntry) {
+	for i, dc := range slices.Backward(decorators) {
+		here := fmt.Sprintf("%s[%d]", where, i)
+		entry = &stackEntry{label: label(dc.Type, dc.Params), inner: []*stackEntry{entry}}
+		factory, ok := r.decorators[dc.Type]
+		if !ok {
+			fail(here, fmt.Errorf("unknown decorator type %q", dc.Type))
+			continue
+		}
+		args := newArgs(dc.Params)
+		built, err := factory(n, args)
+		if problems := append([]error{err}, args.Errs()...); errors.Join(problems...) != nil {
+			fail(here, problems...)
+			continue
+		}
+		n = built
+	}
+	return n, entry
+}
+
+// ConsoleNotifier writes each message to Out, standard output by default
+type ConsoleNotifier struct {
+	Prefix string
+	Out    io.Writer
+}
+
+func (c *ConsoleNotifier) Send(ctx context.Context, message string) error {
+	out := c.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, err := fmt.Fprintln(out, c.Prefix+message)
+	return err
+}
+
+// SendContent writes the subject, if any, and then the text
+func (c *ConsoleNotifier) SendContent(ctx context.Context, content Content) error {
+	if content.Subject != "" {
+		if err := c.Send(ctx, content.Subject); err != nil {
+			return err
+		}
+	}
+	return c.Send(ctx, content.Text)
+}
+
+// Usage
+func ExecutePipelineConfig() {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct{ Message string }
+		json.NewDecoder(r.Body).Decode(&p)
+		fmt.Println("webhook received:", p.Message)
+	}))
+	defer hook.Close()
+
+	doc := `
+# Alerts go to the console and a webhook at the same time
+mode: fanout
+policy: best-effort
+limit: 2
+decorators:
+  - type: template
+    params:
+      text: "[prod] {{.Message}}"
+channels:
+  - name: console
+    type: console
+    params: {}
+  - name: hook
+    type: webhook
+    params:
+      url: ` + hook.URL + `
+      bearer_token: s3cret
+    decorators:
+      - type: rate_limit
+        params:
+          rate: 5
+          burst: 2
+      - type: retry
+        params:
+          attempts: 3
+          base_delay: 200ms
+`
+	cfg, err := ParseConfig([]byte(doc), ConfigYAML)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	pipeline, err := NewRegistry().Build(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(pipeline)
+	if err := pipeline.Send(context.Background(), "disk almost full"); err != nil {
+		fmt.Println(err)
+	}
+
+	broken := `{
+		"mode": "sequential",
+		"channels": [
+			{"name": "mail", "type": "smtp", "params": {"addr": "localhost:25", "to": "ops@example.com", "cc": "boss@example.com"}},
+			{"name": "mail", "type": "pager"}
+		],
+		"decorators": [{"type": "retry", "params": {"attempts": 2.5}}]
+	}`
+	cfg, err = ParseConfig([]byte(broken), ConfigJSON)
+	if err == nil {
+		_, err = NewRegistry().Build(cfg)
+	}
+	fmt.Println(err)
+}
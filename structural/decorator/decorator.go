@@ -1,6 +1,9 @@
 package decorator
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 /*
 =================================
@@ -24,14 +27,15 @@ Supports open/closed principle: open for extension, closed for modification.
 
 // Component interface
 type Notifier interface {
-	Send(message string)
+	Send(ctx context.Context, message string) error
 }
 
 // Concrete Component
 type EmailNotifier struct{}
 
-func (n *EmailNotifier) Send(message string) {
+func (n *EmailNotifier) Send(ctx context.Context, message string) error {
 	fmt.Println("Sending Email:", message)
+	return nil
 }
 
 // Base Decorator
@@ -39,8 +43,13 @@ type NotifierDecorator struct {
 	wrapped Notifier
 }
 
-func (d *NotifierDecorator) Send(message string) {
-	d.wrapped.Send(message)
+func (d *NotifierDecorator) Send(ctx context.Context, message string) error {
+	return d.wrapped.Send(ctx, message)
+}
+
+// Unwrap returns the Notifier this decorator wraps
+func (d *NotifierDecorator) Unwrap() Notifier {
+	return d.wrapped
 }
 
 // Concrete Decorators
@@ -48,18 +57,24 @@ type SMSDecorator struct {
 	NotifierDecorator
 }
 
-func (s *SMSDecorator) Send(message string) {
-	s.NotifierDecorator.Send(message)
+func (s *SMSDecorator) Send(ctx context.Context, message string) error {
+	if err := s.NotifierDecorator.Send(ctx, message); err != nil {
+		return err
+	}
 	fmt.Println("Sending SMS:", message)
+	return nil
 }
 
 type SlackDecorator struct {
 	NotifierDecorator
 }
 
-func (s *SlackDecorator) Send(message string) {
-	s.NotifierDecorator.Send(message)
+func (s *SlackDecorator) Send(ctx context.Context, message string) error {
+	if err := s.NotifierDecorator.Send(ctx, message); err != nil {
+		return err
+	}
 	fmt.Println("Sending Slack:", message)
+	return nil
 }
 
 // Usage
@@ -68,5 +83,16 @@ func ExecuteDecoratorPattern() {
 	sms := &SMSDecorator{NotifierDecorator{wrapped: email}}
 	slack := &SlackDecorator{NotifierDecorator{wrapped: sms}}
 
-	slack.Send("Hello, World!")
+	if err := slack.Send(context.Background(), "Hello, World!"); err != nil {
+		fmt.Println(err)
+	}
+
+	ExecuteResilience()
+	ExecuteChannels()
+	ExecuteFanOut()
+	ExecuteMetrics()
+	ExecutePipelineConfig()
+	ExecuteFormatting()
+	ExecuteDigest()
+	ExecuteStreams()
 }
@@ -0,0 +1,381 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Deduplication and digests
+
+An alert storm sends the same few messages hundreds of times. DedupDecorator
+drops a message that was already delivered within Window and mentions how
+many copies it dropped the next time the message goes out. BatchDecorator
+holds messages back and sends them as one digest once MaxMessages have
+arrived or MaxWait has passed since the first of them, whichever is first.
+
+A batch may still hold messages when the program stops. Shutdown walks a
+decorator chain, outermost first, and closes every decorator that holds
+messages back, so outer batches flush into inner ones before those flush.
+*/
+
+var ErrClosed = errors.New("decorator: closed")
+
+// Closer is implemented by decorators that must be flushed on shutdown
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Shutdown closes every Closer in the chain under n, outermost first, and
+// returns all of their errors
+func Shutdown(ctx context.Context, n Notifier) error {
+	var errs []error
+	var walk func(n Notifier)
+	walk = func(n Notifier) {
+		if c, ok := n.(Closer); ok {
+			errs = append(errs, c.Close(ctx))
+		}
+		switch u := n.(type) {
+		case interface{ Unwrap() []Notifier }:
+			for _, inner := range u.Unwrap() {
+				walk(inner)
+			}
+		case interface{ Unwrap() Notifier }:
+			walk(u.Unwrap())
+		}
+	}
+	walk(n)
+	return errors.Join(errs...)
+}
+
+// DedupDecorator suppresses messages already delivered within Window. The
+// number of copies dropped is kept for ten windows and reported if the
+// message is delivered again in that time. Forgotten messages are swept at
+// most once a Window, so a Send does not walk every message seen.
+type DedupDecorator struct {
+	NotifierDecorator
+	Window time.Duration
+	// Key maps a message to what counts as the same message; by default
+	// the message with runs of white space collapsed
+	Key   func(message string) string
+	Clock Clock
+
+	mu    sync.Mutex
+	seen  map[string]*dedupEntry
+	swept time.Time
+}
+
+type dedupEntry struct {
+	sent       time.Time
+	suppressed int
+}
+
+// NewDedupDecorator suppresses duplicates within window; clock may be nil
+func NewDedupDecorator(n Notifier, window time.Duration, clock Clock) *DedupDecorator {
+	return &DedupDecorator{
+		NotifierDecorator: NotifierDecorator{wrapped: n},
+		Window:            window,
+		Key:               func(m string) string { return strings.Join(strings.Fields(m), " ") },
+		Clock:             orSystem(clock),
+		seen:              map[string]*dedupEntry{},
+	}
+}
+
+// Send delivers message unless it is a duplicate, in which case it returns
+// nil without calling the wrapped Notifier
+func (d *DedupDecorator) Send(ctx context.Context, message string) error {
+	return d.do(d.Key(message), func(suppressed int) error {
+		if suppressed > 0 {
+			message = fmt.Sprintf("%s (%d duplicates suppressed)", message, suppressed)
+		}
+		return d.NotifierDecorator.Send(ctx, message)
+	})
+}
+
+// SendContent is Send for Content. Duplicates are told apart by c.Text, and
+// the count of those suppressed is added to the text, HTML and blocks.
+func (d *DedupDecorator) SendContent(ctx context.Context, c Content) error {
+	return d.do(d.Key(c.Text), func(suppressed int) error {
+		if suppressed > 0 {
+			note := fmt.Sprintf("(%d duplicates suppressed)", suppressed)
+			c.Text += " " + note
+			if c.HTML != "" {
+				c.HTML += "\n<p>" + note + "</p>"
+			}
+			if len(c.Blocks) > 0 {
+				c.Blocks = append(slices.Clip(c.Blocks), SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "_" + note + "_"}})
+			}
+		}
+		return sendContent(ctx, d.wrapped, c)
+	})
+}
+
+// do calls send with the number of copies suppressed since key last went
+// out, unless key is a duplicate
+func (d *DedupDecorator) do(key string, send func(suppressed int) error) error {
+	d.mu.Lock()
+	now := d.Clock.Now()
+	if now.Sub(d.swept) >= d.Window {
+		d.sweep(now)
+	}
+	e := d.seen[key]
+	if e != nil && now.Sub(e.sent) < d.Window {
+		e.suppressed++
+		d.mu.Unlock()
+		return nil
+	}
+	// A failed send goes back to when the message last went out, or to
+	// a Window ago if it never did
+	previous := now.Add(-d.Window)
+	suppressed := 0
+	if e != nil && !e.expired(now, d.Window) {
+		previous, suppressed = e.sent, e.suppressed
+	}
+	// Claim the key before sending so concurrent duplicates are dropped
+	claim := &dedupEntry{sent: now}
+	d.seen[key] = claim
+	d.mu.Unlock()
+
+	if err := send(suppressed); err != nil {
+		// Let the next copy through, and keep the count it should report
+		// along with the copies dropped while this one was being sent
+		d.mu.Lock()
+		if d.seen[key] == claim {
+			claim.sent = previous
+			claim.suppressed += suppressed
+		}
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// expired reports whether e can be forgotten: it is no longer suppressing
+// and has no count to report, or its count is too old to matter
+func (e *dedupEntry) expired(now time.Time, window time.Duration) bool {
+	age := now.Sub(e.sent)
+	return (age >= window && e.suppressed == 0) || age >= 10*window
+}
+
+// sweep forgets expired entries; d.mu must be held
+func (d *DedupDecorator) sweep(now time.Time) {
+	for k, e := range d.seen {
+		if e.expired(now, d.Window) {
+			delete(d.seen, k)
+		}
+	}
+	d.swept = now
+}
+
+// BatchOptions configures a BatchDecorator
+type BatchOptions struct {
+	// MaxMessages sends the digest as soon as this many are waiting
+	MaxMessages int
+	// MaxWait sends the digest this long after its first message
+	MaxWait time.Duration
+	// Format turns a batch into the digest text; by default a count and
+	// a list, with repeats folded into one line
+	Format func(messages []string) string
+	// OnError receives the errors of digests sent by the MaxWait timer,
+	// which have no caller to return them to
+	OnError func(err error)
+	Clock   Clock
+}
+
+// BatchDecorator collects messages and sends them as one digest. It has no
+// SendContent: Content reaching it is batched as its Text.
+type BatchDecorator struct {
+	NotifierDecorator
+	BatchOptions
+
+	mu      sync.Mutex
+	pending []string
+	ctx     context.Context // of the first pending message, for the timer
+	stop    func() bool
+	gen     int
+	closed  bool
+	sendMu  sync.Mutex     // keeps digests in order
+	sending sync.WaitGroup // digests taken but not yet sent
+}
+
+// NewBatchDecorator batches messages for n; a zero MaxMessages or MaxWait
+// disables that trigger
+func NewBatchDecorator(n Notifier, opts BatchOptions) *BatchDecorator {
+	if opts.Format == nil {
+		opts.Format = FormatDigest
+	}
+	opts.Clock = orSystem(opts.Clock)
+	return &BatchDecorator{NotifierDecorator: NotifierDecorator{wrapped: n}, BatchOptions: opts}
+}
+
+// FormatDigest is the default digest format
+func FormatDigest(messages []string) string {
+	if len(messages) == 1 {
+		return messages[0]
+	}
+	var order []string
+	counts := map[string]int{}
+	for _, m := range messages {
+		if counts[m] == 0 {
+			order = append(order, m)
+		}
+		counts[m]++
+	}
+	lines := []string{fmt.Sprintf("%d notifications:", len(messages))}
+	for _, m := range order {
+		if counts[m] > 1 {
+			m = fmt.Sprintf("%s (x%d)", m, counts[m])
+		}
+		lines = append(lines, "- "+m)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Send queues message. It returns the digest's error only when this message
+// completes a batch; otherwise it returns nil at once.
+func (b *BatchDecorator) Send(ctx context.Context, message string) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.pending = append(b.pending, message)
+	if len(b.pending) == 1 {
+		b.ctx = context.WithoutCancel(ctx)
+		if b.MaxWait > 0 {
+			gen := b.gen
+			b.stop = b.Clock.AfterFunc(b.MaxWait, func() { b.timerFlush(gen) })
+		}
+	}
+	if b.MaxMessages > 0 && len(b.pending) >= b.MaxMessages {
+		batch := b.take()
+		b.mu.Unlock()
+		return b.send(ctx, batch)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// Flush sends whatever is waiting now
+func (b *BatchDecorator) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	return b.send(ctx, batch)
+}
+
+// Close flushes and refuses further messages with ErrClosed. It returns
+// once every digest has gone out, including one the MaxWait timer is still
+// sending, or when ctx is done.
+func (b *BatchDecorator) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	batch := b.take()
+	b.mu.Unlock()
+	err := b.send(ctx, batch)
+
+	done := make(chan struct{})
+	go func() {
+		b.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Join(err, ctx.Err())
+	}
+}
+
+// Pending returns how many messages are waiting
+func (b *BatchDecorator) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// take empties the batch and cancels its timer; b.mu must be held. A
+// batch it returns must be passed to send.
+func (b *BatchDecorator) take() []string {
+	batch := b.pending
+	if len(batch) > 0 {
+		b.sending.Add(1)
+	}
+	b.pending = nil
+	b.gen++
+	if b.stop != nil {
+		b.stop()
+		b.stop = nil
+	}
+	return batch
+}
+
+func (b *BatchDecorator) timerFlush(gen int) {
+	b.mu.Lock()
+	if gen != b.gen {
+		// The batch this timer was for has already gone out
+		b.mu.Unlock()
+		return
+	}
+	ctx := b.ctx
+	batch := b.take()
+	b.mu.Unlock()
+	if err := b.send(ctx, batch); err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
+
+func (b *BatchDecorator) send(ctx context.Context, batch []string) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	defer b.sending.Done()
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	return b.NotifierDecorator.Send(ctx, b.Format(slices.Clip(batch)))
+}
+
+// Usage
+func ExecuteDigest() {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	console := &ConsoleNotifier{Prefix: "pager: "}
+
+	batch := NewBatchDecorator(console, BatchOptions{MaxMessages: 4, MaxWait: 30 * time.Second, Clock: clock})
+	oncall := NewDedupDecorator(batch, time.Minute, clock)
+
+	storm := []string{
+		"db-1 replication lag 45s", "db-1 replication lag 45s", "api 5xx rate 12%",
+		"db-1 replication lag 45s", "api  5xx rate 12%", "queue depth 10k",
+		"disk /var 91%", "cache hit rate 40%", "api 5xx rate 12%",
+	}
+	for i, msg := range storm {
+		clock.Advance(time.Second)
+		if err := oncall.Send(ctx, msg); err != nil {
+			fmt.Println(err)
+		}
+		if i == 6 {
+			fmt.Printf("-- %d alerts in, %d waiting\n", i+1, batch.Pending())
+		}
+	}
+
+	fmt.Println("-- 30s later")
+	clock.Advance(30 * time.Second)
+
+	fmt.Println("-- 2 minutes later the lag alert fires again")
+	clock.Advance(2 * time.Minute)
+	oncall.Send(ctx, "db-1 replication lag 45s")
+	oncall.Send(ctx, "db-1 replication lag 45s")
+
+	fmt.Println("-- shutdown")
+	if err := Shutdown(ctx, oncall); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("after shutdown:", oncall.Send(ctx, "late alert"))
+}
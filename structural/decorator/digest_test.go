@@ -0,0 +1,276 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// messages records what it was sent and fails while Fail is set
+type messages struct {
+	mu   sync.Mutex
+	got  []string
+	Fail error
+}
+
+func (m *messages) Send(_ context.Context, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail != nil {
+		return m.Fail
+	}
+	m.got = append(m.got, message)
+	return nil
+}
+
+func (m *messages) take() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	got := m.got
+	m.got = nil
+	return got
+}
+
+func TestDedup(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var out messages
+	d := NewDedupDecorator(&out, time.Minute, clock)
+	ctx := context.Background()
+
+	for _, m := range []string{"db down", "db  down", "api slow", "db down"} {
+		if err := d.Send(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	clock.Advance(time.Minute)
+	d.Send(ctx, "db down")
+	d.Send(ctx, "api slow")
+	want := []string{"db down", "api slow", "db down (2 duplicates suppressed)", "api slow"}
+	if got := out.take(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sent %q; want %q", got, want)
+	}
+
+	// The count is kept for ten windows and no longer
+	d.Send(ctx, "db down")
+	clock.Advance(10 * time.Minute)
+	d.Send(ctx, "db down")
+	if got := out.take(); len(got) != 1 || got[0] != "db down" {
+		t.Errorf("sent %q; want the message without a stale count", got)
+	}
+}
+
+// A failed send lets the next copy through and keeps the count it should
+// report, even across a sweep
+func TestDedupFailedSend(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var out messages
+	d := NewDedupDecorator(&out, time.Minute, clock)
+	ctx := context.Background()
+
+	d.Send(ctx, "db down")
+	d.Send(ctx, "db down")
+	d.Send(ctx, "db down")
+	clock.Advance(time.Minute)
+	out.Fail = errBusy
+	if err := d.Send(ctx, "db down"); !errors.Is(err, errBusy) {
+		t.Fatalf("Send = %v; want errBusy", err)
+	}
+	out.Fail = nil
+	clock.Advance(2 * time.Minute)
+	d.Send(ctx, "other") // sweeps
+	if err := d.Send(ctx, "db down"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"db down", "other", "db down (2 duplicates suppressed)"}
+	if got := out.take(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sent %q; want %q", got, want)
+	}
+
+	// A first send that fails is not a duplicate of anything
+	out.Fail = errBusy
+	d.Send(ctx, "new")
+	out.Fail = nil
+	if err := d.Send(ctx, "new"); err != nil || len(out.take()) != 1 {
+		t.Errorf("retry of a failed first send: Send = %v; want it delivered", err)
+	}
+}
+
+func TestDedupSweep(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	d := NewDedupDecorator(&messages{}, time.Minute, clock)
+	ctx := context.Background()
+	for i := range 100 {
+		d.Send(ctx, fmt.Sprint("alert ", i))
+	}
+	d.Send(ctx, "alert 0") // suppressed, so kept for ten windows
+	clock.Advance(time.Minute)
+	d.Send(ctx, "late")
+	if len(d.seen) != 2 {
+		t.Errorf("%d entries after a window; want alert 0 and late", len(d.seen))
+	}
+	// The next sweep is a whole window away
+	clock.Advance(59 * time.Second)
+	d.Send(ctx, "later")
+	if len(d.seen) != 3 {
+		t.Errorf("%d entries; want no sweep within the window", len(d.seen))
+	}
+	clock.Advance(10 * time.Minute)
+	d.Send(ctx, "last")
+	if len(d.seen) != 1 {
+		t.Errorf("%d entries after ten windows; want 1", len(d.seen))
+	}
+}
+
+func TestBatch(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var out messages
+	b := NewBatchDecorator(&out, BatchOptions{MaxMessages: 3, MaxWait: 30 * time.Second, Clock: clock})
+	ctx := context.Background()
+
+	for _, m := range []string{"a", "b", "a"} {
+		if err := b.Send(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := out.take(); len(got) != 1 || got[0] != "3 notifications:\n- a (x2)\n- b" {
+		t.Errorf("full batch sent %q", got)
+	}
+	// The timer of the batch that went out must not fire for the next one
+	clock.Advance(20 * time.Second)
+	b.Send(ctx, "c")
+	clock.Advance(10 * time.Second)
+	if b.Pending() != 1 || len(out.take()) != 0 {
+		t.Fatal("an old timer flushed the new batch")
+	}
+	clock.Advance(20 * time.Second)
+	if got := out.take(); len(got) != 1 || got[0] != "c" || b.Pending() != 0 {
+		t.Errorf("after MaxWait sent %q with %d pending", got, b.Pending())
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	out := &messages{Fail: errBusy}
+	var timerErrs []error
+	b := NewBatchDecorator(out, BatchOptions{MaxMessages: 2, MaxWait: time.Second, Clock: clock,
+		OnError: func(err error) { timerErrs = append(timerErrs, err) }})
+	ctx := context.Background()
+
+	b.Send(ctx, "a")
+	if err := b.Send(ctx, "b"); !errors.Is(err, errBusy) {
+		t.Errorf("Send completing a batch = %v; want errBusy", err)
+	}
+	b.Send(ctx, "c")
+	clock.Advance(time.Second)
+	if len(timerErrs) != 1 || !errors.Is(timerErrs[0], errBusy) {
+		t.Errorf("OnError got %v; want errBusy from the timer", timerErrs)
+	}
+
+	out.Fail = nil
+	b.Send(ctx, "d")
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.take(); len(got) != 1 || got[0] != "d" {
+		t.Errorf("Close sent %q; want d", got)
+	}
+	if err := b.Send(ctx, "e"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send after Close = %v; want ErrClosed", err)
+	}
+}
+
+// gate blocks every send until it is opened, telling started when one begins
+type gate struct {
+	messages
+	started, open chan struct{}
+}
+
+func (g *gate) Send(ctx context.Context, message string) error {
+	g.started <- struct{}{}
+	<-g.open
+	return g.messages.Send(ctx, message)
+}
+
+// Close must wait for a digest the MaxWait timer took just before it
+func TestBatchCloseDuringTimerFlush(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	out := &gate{started: make(chan struct{}), open: make(chan struct{})}
+	b := NewBatchDecorator(out, BatchOptions{MaxWait: time.Second, Clock: clock})
+	ctx := context.Background()
+
+	b.Send(ctx, "a")
+	go clock.Advance(time.Second)
+	<-out.started
+
+	closed := make(chan error, 1)
+	go func() { closed <- b.Close(ctx) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close = %v while the timer's digest was still being sent", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(out.open)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if got := out.take(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("sent %q; want a", got)
+	}
+
+	// A caller that cannot wait gets its context's error instead
+	out.open = make(chan struct{})
+	defer close(out.open)
+	b = NewBatchDecorator(out, BatchOptions{MaxWait: time.Second, Clock: clock})
+	b.Send(ctx, "b")
+	go clock.Advance(time.Second)
+	<-out.started
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.Close(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close = %v; want context.Canceled", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var out messages
+	inner := NewBatchDecorator(&out, BatchOptions{})
+	outer := NewBatchDecorator(NewDedupDecorator(inner, time.Minute, nil), BatchOptions{})
+	fan := &FanOutNotifier{Channels: []Channel{{"batched", outer}, {"direct", NewChannelDecorator(&out, &out)}}}
+	p := &Pipeline{Notifier: NewRetryDecorator(fan, RetryOptions{})}
+	ctx := context.Background()
+
+	inner.Send(ctx, "waiting inside")
+	outer.Send(ctx, "waiting outside")
+	if err := Shutdown(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	// The outer batch flushed into the inner one before the inner flushed
+	if got := out.take(); len(got) != 1 || got[0] != "2 notifications:\n- waiting inside\n- waiting outside" {
+		t.Errorf("sent %q", got)
+	}
+	if inner.Send(ctx, "x") != ErrClosed || outer.Send(ctx, "x") != ErrClosed {
+		t.Error("Shutdown left a batch open")
+	}
+}
+
+// BenchmarkDedupManyKeys sends distinct messages; a sweep on every Send
+// would make this quadratic
+func BenchmarkDedupManyKeys(b *testing.B) {
+	clock := NewFakeClock(testStart)
+	d := NewDedupDecorator(&messages{}, time.Hour, clock)
+	keys := make([]string, 20000)
+	for i := range keys {
+		keys[i] = fmt.Sprint("alert ", i)
+	}
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := range b.N {
+		d.Send(ctx, keys[i%len(keys)])
+		clock.Advance(time.Millisecond)
+	}
+}
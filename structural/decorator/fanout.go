@@ -0,0 +1,245 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Fan-out
+
+Stacked decorators send one channel after another: a slow channel holds up
+the rest and a failing one stops them. FanOutNotifier sends to every channel
+at once, at most Limit at a time, waits for all of them and then applies a
+policy to decide whether the send as a whole failed. Each channel can still
+be decorated on its own, for example with a retry or a timeout.
+
+Retries belong on the channels. A RetryDecorator around the fan-out sends
+to every channel again, including those that already succeeded, so a
+FanOutError counts as permanent only when every channel that failed did so
+permanently; one channel worth retrying makes the whole send worth it.
+*/
+
+// FanOutPolicy decides when a fan-out send counts as failed
+type FanOutPolicy int
+
+const (
+	// AllMustSucceed fails if any channel fails
+	AllMustSucceed FanOutPolicy = iota
+	// AtLeastOne fails only if every channel fails
+	AtLeastOne
+	// BestEffort never fails; failures only go to OnFailure
+	BestEffort
+)
+
+func (p FanOutPolicy) String() string {
+	switch p {
+	case AllMustSucceed:
+		return "all-must-succeed"
+	case AtLeastOne:
+		return "at-least-one"
+	case BestEffort:
+		return "best-effort"
+	}
+	return fmt.Sprintf("FanOutPolicy(%d)", int(p))
+}
+
+// Channel is a named destination of a FanOutNotifier
+type Channel struct {
+	Name     string
+	Notifier Notifier
+}
+
+// ChannelError is the failure of one channel
+type ChannelError struct {
+	Channel string
+	Err     error
+}
+
+func (e *ChannelError) Error() string {
+	return e.Channel + ": " + e.Err.Error()
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+// FanOutError lists the channels that failed. errors.Is and errors.As see
+// the failures worth retrying, or all of them if none is, so the error is
+// permanent only when every failure is.
+type FanOutError struct {
+	Policy   FanOutPolicy
+	Channels int
+	Failed   []*ChannelError
+}
+
+func (e *FanOutError) Error() string {
+	lines := []string{fmt.Sprintf("decorator: %d of %d channels failed (%v)", len(e.Failed), e.Channels, e.Policy)}
+	for _, f := range e.Failed {
+		lines = append(lines, "  "+f.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *FanOutError) Unwrap() []error {
+	var all, retryable []error
+	for _, f := range e.Failed {
+		all = append(all, f)
+		if !errors.Is(f, ErrPermanent) {
+			retryable = append(retryable, f)
+		}
+	}
+	if len(retryable) > 0 {
+		return retryable
+	}
+	return all
+}
+
+// FanOutNotifier sends every message to all of its channels concurrently
+type FanOutNotifier struct {
+	Channels []Channel
+	// Limit is the most channels sent to at once; 0 means no limit
+	Limit  int
+	Policy FanOutPolicy
+	// OnFailure, if set, is called for every failed channel whatever the
+	// policy, once all channels have finished
+	OnFailure func(err *ChannelError)
+}
+
+func (f *FanOutNotifier) Send(ctx context.Context, message string) error {
+	return f.do(ctx, func(n Notifier) error { return n.Send(ctx, message) })
+}
+
+// SendContent is Send for Content; channels that cannot take Content get
+// c.Text
+func (f *FanOutNotifier) SendContent(ctx context.Context, c Content) error {
+	return f.do(ctx, func(n Notifier) error { return sendContent(ctx, n, c) })
+}
+
+// Unwrap returns the channels' Notifiers
+func (f *FanOutNotifier) Unwrap() []Notifier {
+	ns := make([]Notifier, len(f.Channels))
+	for i, ch := range f.Channels {
+		ns[i] = ch.Notifier
+	}
+	return ns
+}
+
+// do runs send for every channel and applies the policy
+func (f *FanOutNotifier) do(ctx context.Context, send func(n Notifier) error) error {
+	limit := f.Limit
+	if limit <= 0 || limit > len(f.Channels) {
+		limit = len(f.Channels)
+	}
+	sem := make(chan struct{}, limit)
+	errs := make([]error, len(f.Channels))
+	var wg sync.WaitGroup
+	for i, ch := range f.Channels {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// A free slot and a cancelled context can be ready together; nothing
+		// starts once the context is cancelled. A slot taken here is not
+		// given back, as every later channel is skipped too.
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = send(ch.Notifier)
+		}()
+	}
+	wg.Wait()
+
+	var failed []*ChannelError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		ce := &ChannelError{Channel: f.Channels[i].Name, Err: err}
+		failed = append(failed, ce)
+		if f.OnFailure != nil {
+			f.OnFailure(ce)
+		}
+	}
+	switch {
+	case len(failed) == 0,
+		f.Policy == BestEffort,
+		f.Policy == AtLeastOne && len(failed) < len(f.Channels):
+		return nil
+	}
+	return &FanOutError{Policy: f.Policy, Channels: len(f.Channels), Failed: failed}
+}
+
+// probeNotifier takes Latency per send, fails if Fail is set and records
+// how many sends ran at the same time
+type probeNotifier struct {
+	Latency  time.Duration
+	Fail     error
+	inFlight *atomic.Int32
+	maxSeen  *atomic.Int32
+}
+
+func (p *probeNotifier) Send(ctx context.Context, message string) error {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		m := p.maxSeen.Load()
+		if n <= m || p.maxSeen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	select {
+	case <-time.After(p.Latency):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.Fail
+}
+
+// Usage
+func ExecuteFanOut() {
+	ctx := context.Background()
+	var inFlight, maxSeen atomic.Int32
+	probe := func(latency time.Duration, fail error) Notifier {
+		return &probeNotifier{Latency: latency, Fail: fail, inFlight: &inFlight, maxSeen: &maxSeen}
+	}
+	channels := []Channel{
+		{"email", probe(20*time.Millisecond, nil)},
+		{"sms", probe(10*time.Millisecond, errors.New("gateway returned 503"))},
+		{"slack", probe(20*time.Millisecond, nil)},
+		{"pager", probe(30*time.Millisecond, nil)},
+	}
+
+	fan := &FanOutNotifier{Channels: channels, Limit: 2}
+	fmt.Println(fan.Send(ctx, "deploy finished"))
+	fmt.Println("most channels in flight:", maxSeen.Load())
+
+	fan.Policy = AtLeastOne
+	fmt.Println("at-least-one:", fan.Send(ctx, "deploy finished"))
+
+	fan.Policy = BestEffort
+	fan.OnFailure = func(err *ChannelError) { fmt.Println("  best-effort failure:", err) }
+	fmt.Println("best-effort:", fan.Send(ctx, "deploy finished"))
+
+	down := &FanOutNotifier{Policy: AtLeastOne, Channels: []Channel{
+		{"email", probe(0, errors.New("connection refused"))},
+		{"slack", probe(0, Permanent(errors.New("invalid_payload")))},
+	}}
+	err := down.Send(ctx, "deploy finished")
+	fmt.Printf("%v\npermanent: %t\n", err, errors.Is(err, ErrPermanent))
+}
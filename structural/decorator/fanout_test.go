@@ -0,0 +1,169 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("connection refused")
+
+// channels returns one channel per result, named after its position; nil
+// succeeds
+func channels(results ...error) []Channel {
+	chs := make([]Channel, len(results))
+	for i, err := range results {
+		chs[i] = Channel{fmt.Sprint("ch", i), notifierFunc(func(context.Context, string) error { return err })}
+	}
+	return chs
+}
+
+func TestFanOutLimit(t *testing.T) {
+	for _, tt := range []struct{ limit, want int32 }{{2, 2}, {0, 6}, {10, 6}} {
+		t.Run(fmt.Sprint("limit=", tt.limit), func(t *testing.T) {
+			var inFlight, maxSeen atomic.Int32
+			chs := make([]Channel, 6)
+			for i := range chs {
+				chs[i] = Channel{fmt.Sprint(i), &probeNotifier{Latency: 20 * time.Millisecond, inFlight: &inFlight, maxSeen: &maxSeen}}
+			}
+			f := &FanOutNotifier{Channels: chs, Limit: int(tt.limit)}
+			if err := f.Send(context.Background(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if maxSeen.Load() != tt.want {
+				t.Errorf("%d channels in flight at once; want %d", maxSeen.Load(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFanOutPolicies(t *testing.T) {
+	tests := []struct {
+		policy  FanOutPolicy
+		results []error
+		failed  int // -1 for no error
+	}{
+		{AllMustSucceed, []error{nil, nil}, -1},
+		{AllMustSucceed, []error{nil, errDown, nil}, 1},
+		{AllMustSucceed, []error{errDown, errDown}, 2},
+		{AtLeastOne, []error{nil, errDown, errDown}, -1},
+		{AtLeastOne, []error{errDown, errDown}, 2},
+		{BestEffort, []error{errDown, errDown}, -1},
+		{AllMustSucceed, nil, -1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.policy, tt.results), func(t *testing.T) {
+			err := (&FanOutNotifier{Channels: channels(tt.results...), Policy: tt.policy}).Send(context.Background(), "hi")
+			var fe *FanOutError
+			switch {
+			case tt.failed < 0 && err != nil:
+				t.Errorf("Send = %v; want nil", err)
+			case tt.failed >= 0 && (!errors.As(err, &fe) || len(fe.Failed) != tt.failed || fe.Channels != len(tt.results) || fe.Policy != tt.policy):
+				t.Errorf("Send = %v; want %d of %d channels failed", err, tt.failed, len(tt.results))
+			case tt.failed >= 0 && !errors.Is(err, errDown):
+				t.Errorf("Send = %v; errors.Is does not see the channel's error", err)
+			}
+		})
+	}
+}
+
+func TestFanOutOnFailure(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	f := &FanOutNotifier{
+		Channels: channels(nil, errDown, nil, errBusy),
+		Policy:   BestEffort,
+		OnFailure: func(err *ChannelError) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, err.Error())
+		},
+	}
+	if err := f.Send(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	want := []string{"ch1: " + errDown.Error(), "ch3: " + errBusy.Error()}
+	if !slices.Equal(got, want) {
+		t.Errorf("OnFailure saw %q; want %q", got, want)
+	}
+}
+
+// The fan-out is permanent only when every failed channel is, since a
+// retry around it would try them all again
+func TestFanOutPermanent(t *testing.T) {
+	permanent := Permanent(&HTTPStatusError{StatusCode: 400})
+	tests := []struct {
+		name      string
+		results   []error
+		permanent bool
+	}{
+		{"none permanent", []error{errDown, errBusy}, false},
+		{"some permanent", []error{errDown, permanent}, false},
+		{"all permanent", []error{permanent, permanent}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&FanOutNotifier{Channels: channels(tt.results...)}).Send(context.Background(), "hi")
+			if errors.Is(err, ErrPermanent) != tt.permanent {
+				t.Errorf("Send = %v; permanent %t, want %t", err, !tt.permanent, tt.permanent)
+			}
+			var fe *FanOutError
+			if !errors.As(err, &fe) || len(fe.Failed) != len(tt.results) {
+				t.Errorf("Failed does not list every channel: %v", err)
+			}
+		})
+	}
+
+	var calls atomic.Int32
+	fan := &FanOutNotifier{Channels: []Channel{
+		{"flaky", failing(1, &calls)},
+		{"broken", notifierFunc(func(context.Context, string) error { return permanent })},
+	}}
+	r := NewRetryDecorator(fan, RetryOptions{Clock: NewFakeClock(testStart)})
+	if err := r.Send(context.Background(), "hi"); !errors.Is(err, ErrPermanent) || calls.Load() != 2 {
+		t.Errorf("retried fan-out = %v after %d sends to flaky; want a retry, then a permanent failure", err, calls.Load())
+	}
+}
+
+// Cancelling the context while a channel waits for a slot skips it and
+// every channel after it
+func TestFanOutCancelWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int32
+	counted := notifierFunc(func(context.Context, string) error {
+		calls.Add(1)
+		return nil
+	})
+	first := notifierFunc(func(ctx context.Context, message string) error {
+		cancel()
+		return counted.Send(ctx, message)
+	})
+	chs := []Channel{{"first", first}, {"a", counted}, {"b", counted}, {"c", counted}}
+
+	err := (&FanOutNotifier{Channels: chs, Limit: 1}).Send(ctx, "hi")
+	var fe *FanOutError
+	if !errors.As(err, &fe) || len(fe.Failed) != 3 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send = %v; want the 3 waiting channels failed with context.Canceled", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d channels were sent to; want only the first", calls.Load())
+	}
+}
+
+func TestFanOutPanic(t *testing.T) {
+	chs := append(channels(nil), Channel{"bad", notifierFunc(func(context.Context, string) error { panic("boom") })})
+	chs = append(chs, channels(nil)...)
+	err := (&FanOutNotifier{Channels: chs}).Send(context.Background(), "hi")
+	var fe *FanOutError
+	if !errors.As(err, &fe) || len(fe.Failed) != 1 || fe.Failed[0].Channel != "bad" || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("Send = %v; want only bad failed, with its panic", err)
+	}
+}
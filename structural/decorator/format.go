@@ -0,0 +1,358 @@
+package decorator
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sorrawichYooboon/go-gof-design-patterns/internal/smtpstub"
+)
+
+/*
+Per-channel formatting
+
+A plain message string looks wrong everywhere: too long for SMS, no subject
+for email, flat text in Slack. FormattingDecorator takes a typed Event
+instead and renders it with the templates for its channel: a subject and an
+HTML body for email, at most 160 characters for SMS, markdown blocks for
+Slack. Channels that can use rich Content (SMTPNotifier, SlackNotifier,
+ConsoleNotifier) implement ContentNotifier; the others get Content.Text.
+Retry, timeout, circuit breaker, rate limit, metrics, channel, fan-out and
+dedup decorators pass Content through, so they can sit between the two.
+BatchDecorator does not: a digest is plain text made of many messages, so
+it keeps only their Text.
+
+Templates are files named <kind>.<part>[.<locale>].tmpl, for example
+deploy.subject.de.tmpl. Parts are subject, html, text, sms and slack; html
+is parsed with html/template so event data is escaped. A locale falls back
+to its language and then to the file without a locale: de-AT, de, none.
+*/
+
+var ErrNoTemplate = errors.New("decorator: no template")
+
+// SMSLimit is the most characters FormattingDecorator sends by SMS
+const SMSLimit = 160
+
+// Content is a message formatted for one channel
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+	Blocks  []SlackBlock
+}
+
+// SlackBlock is a Block Kit block: a markdown section or a divider
+type SlackBlock struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+}
+
+// SlackText is the text object of a section block
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ContentNotifier is a Notifier that can deliver more than plain text
+type ContentNotifier interface {
+	Notifier
+	SendContent(ctx context.Context, c Content) error
+}
+
+// sendContent delivers c through n, as text if n cannot take Content
+func sendContent(ctx context.Context, n Notifier, c Content) error {
+	if cn, ok := n.(ContentNotifier); ok {
+		return cn.SendContent(ctx, c)
+	}
+	return n.Send(ctx, c.Text)
+}
+
+// Event is a typed notification. Kind selects the templates and Data is
+// whatever the templates need, usually a struct of the caller's.
+type Event struct {
+	Kind     string
+	Locale   string
+	Severity string
+	Time     time.Time
+	Data     any
+}
+
+// executor is what text/template and html/template templates have in common
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// TemplateSet holds the templates loaded by LoadTemplates
+type TemplateSet struct {
+	templates map[string]executor // "kind.part" or "kind.part.locale"
+}
+
+var templateParts = map[string]bool{"subject": true, "html": true, "text": true, "sms": true, "slack": true}
+
+var templateFuncs = map[string]any{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": truncate,
+}
+
+// LoadTemplates parses every .tmpl file in dir of fsys
+func LoadTemplates(fsys fs.FS, dir string) (*TemplateSet, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	set := &TemplateSet{templates: map[string]executor{}}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		fields := strings.Split(name, ".")
+		if len(fields) < 2 || len(fields) > 3 || !templateParts[fields[1]] {
+			return nil, fmt.Errorf("decorator: template %s: want <kind>.<part>[.<locale>].tmpl", file)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var t executor
+		if fields[1] == "html" {
+			t, err = htmltemplate.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+		} else {
+			t, err = template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decorator: %w", err)
+		}
+		set.templates[name] = t
+	}
+	return set, nil
+}
+
+// lookup finds the template for kind and part in the closest locale
+func (s *TemplateSet) lookup(kind, part, locale string) (executor, bool) {
+	for locale != "" {
+		if t, ok := s.templates[kind+"."+part+"."+locale]; ok {
+			return t, true
+		}
+		i := strings.LastIndexAny(locale, "-_")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	t, ok := s.templates[kind+"."+part]
+	return t, ok
+}
+
+// render executes the first of parts that has a template; found is false
+// if none does
+func (s *TemplateSet) render(e Event, parts ...string) (out string, found bool, err error) {
+	for _, part := range parts {
+		t, ok := s.lookup(e.Kind, part, e.Locale)
+		if !ok {
+			continue
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, e); err != nil {
+			return "", true, fmt.Errorf("decorator: %w", err)
+		}
+		return strings.TrimSpace(b.String()), true, nil
+	}
+	return "", false, nil
+}
+
+// Render formats e for channel: "email", "sms", "slack", or anything else
+// for plain text
+func (s *TemplateSet) Render(e Event, channel string) (Content, error) {
+	var c Content
+	missing := func(part string) error {
+		return fmt.Errorf("%w for %s.%s (locale %q)", ErrNoTemplate, e.Kind, part, e.Locale)
+	}
+	text, hasText, err := s.render(e, "text")
+	if err != nil {
+		return c, err
+	}
+
+	switch channel {
+	case "email":
+		subject, ok, err := s.render(e, "subject")
+		if err != nil {
+			return c, err
+		}
+		if !ok {
+			return c, missing("subject")
+		}
+		html, hasHTML, err := s.render(e, "html")
+		if err != nil {
+			return c, err
+		}
+		if !hasHTML && !hasText {
+			return c, missing("html")
+		}
+		return Content{Subject: strings.Join(strings.Fields(subject), " "), Text: text, HTML: html}, nil
+	case "sms":
+		sms, ok, err := s.render(e, "sms", "text")
+		if err != nil {
+			return c, err
+		}
+		if !ok {
+			return c, missing("sms")
+		}
+		return FormatText("sms", sms), nil
+	case "slack":
+		md, ok, err := s.render(e, "slack", "text")
+		if err != nil {
+			return c, err
+		}
+		if !ok {
+			return c, missing("slack")
+		}
+		return FormatText("slack", md), nil
+	}
+	if !hasText {
+		return c, missing("text")
+	}
+	return Content{Text: text}, nil
+}
+
+// FormatText shapes a plain message for channel without templates: the
+// first line becomes the email subject, SMS is squeezed onto one line and
+// truncated, and Slack markdown is split into sections at "---" lines
+func FormatText(channel, message string) Content {
+	switch channel {
+	case "email":
+		subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+		return Content{Subject: truncate(78, subject), Text: message}
+	case "sms":
+		return Content{Text: truncate(SMSLimit, strings.Join(strings.Fields(message), " "))}
+	case "slack":
+		var blocks []SlackBlock
+		for i, section := range strings.Split(message, "\n---\n") {
+			if i > 0 {
+				blocks = append(blocks, SlackBlock{Type: "divider"})
+			}
+			if section = strings.TrimSpace(section); section != "" {
+				blocks = append(blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: section}})
+			}
+		}
+		return Content{Text: strings.ReplaceAll(message, "\n---\n", "\n"), Blocks: blocks}
+	}
+	return Content{Text: message}
+}
+
+// truncate shortens s to at most n characters, ending with "…" if it cut
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// FormattingDecorator renders events for one channel. Plain messages sent
+// with Send are shaped with FormatText.
+type FormattingDecorator struct {
+	NotifierDecorator
+	// Channel is "email", "sms", "slack" or "text"
+	Channel   string
+	Templates *TemplateSet
+}
+
+// NewFormattingDecorator formats for channel with templates
+func NewFormattingDecorator(n Notifier, channel string, templates *TemplateSet) *FormattingDecorator {
+	return &FormattingDecorator{NotifierDecorator{wrapped: n}, channel, templates}
+}
+
+// Notify renders e and delivers it; a missing or failing template is a
+// permanent error
+func (d *FormattingDecorator) Notify(ctx context.Context, e Event) error {
+	c, err := d.Templates.Render(e, d.Channel)
+	if err != nil {
+		return Permanent(err)
+	}
+	return sendContent(ctx, d.wrapped, c)
+}
+
+func (d *FormattingDecorator) Send(ctx context.Context, message string) error {
+	return sendContent(ctx, d.wrapped, FormatText(d.Channel, message))
+}
+
+// DeployEvent is the Data of the "deploy" events in the example
+type DeployEvent struct {
+	Service string
+	Version string
+	Author  string
+	Changes []string
+}
+
+// exampleTemplates are the "deploy" templates of the example
+//
+//go:embed templates/*.tmpl
+var exampleTemplates embed.FS
+
+// Usage
+func ExecuteFormatting() {
+	set, err := LoadTemplates(exampleTemplates, "templates")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	mailServer, err := smtpstub.Start()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer mailServer.Close()
+
+	email := NewFormattingDecorator(NewRetryDecorator(&SMTPNotifier{Addr: mailServer.Addr(), From: "deploy@example.com", To: []string{"team@example.com"}}, RetryOptions{}), "email", set)
+	sms := NewFormattingDecorator(&ConsoleNotifier{Prefix: "sms: "}, "sms", set)
+	slack := NewFormattingDecorator(&slackPreview{}, "slack", set)
+
+	ctx := context.Background()
+	event := Event{Kind: "deploy", Locale: "de-AT", Severity: "info", Time: time.Now(), Data: DeployEvent{
+		Service: "checkout", Version: "v2.7.0", Author: "Ada <ada@example.com>",
+		Changes: []string{"faster card validation", "new PayNow provider", "fix rounding of totals in JPY", "retry idempotent webhooks", "drop legacy v1 endpoints"},
+	}}
+	for _, ch := range []*FormattingDecorator{email, sms, slack} {
+		if err := ch.Notify(ctx, event); err != nil {
+			fmt.Println(ch.Channel, "failed:", err)
+		}
+	}
+
+	for _, m := range mailServer.Messages() {
+		for _, line := range strings.Split(m.Data, "\r\n") {
+			if strings.HasPrefix(line, "Subject:") || strings.HasPrefix(line, "<p>") || strings.HasPrefix(line, "Content-Type: text/") {
+				fmt.Println("email:", line)
+			}
+		}
+	}
+
+	err = sms.Notify(ctx, Event{Kind: "rollback", Data: DeployEvent{}})
+	fmt.Printf("%v (permanent: %t)\n", err, errors.Is(err, ErrPermanent))
+}
+
+// slackPreview prints the blocks a SlackNotifier would post
+type slackPreview struct{}
+
+func (slackPreview) Send(ctx context.Context, message string) error {
+	return slackPreview{}.SendContent(ctx, Content{Text: message})
+}
+
+func (slackPreview) SendContent(ctx context.Context, c Content) error {
+	for _, b := range c.Blocks {
+		if b.Text == nil {
+			fmt.Println("slack: ---")
+			continue
+		}
+		fmt.Printf("slack: %s %q\n", b.Type, b.Text.Text)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"unicode/utf8"
+)
+
+func loadTestTemplates(t *testing.T, files map[string]string) *TemplateSet {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, text := range files {
+		fsys["tmpl/"+name] = &fstest.MapFile{Data: []byte(text)}
+	}
+	set, err := LoadTemplates(fsys, "tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestRenderLocaleFallback(t *testing.T) {
+	set := loadTestTemplates(t, map[string]string{
+		"greet.text.tmpl":       "hello",
+		"greet.text.de.tmpl":    "hallo",
+		"greet.text.de-AT.tmpl": "servus",
+		"greet.text.pt_BR.tmpl": "olá",
+	})
+	tests := map[string]string{
+		"":         "hello",
+		"de-AT":    "servus",
+		"de-CH":    "hallo",
+		"de":       "hallo",
+		"de-AT-x1": "servus",
+		"pt_BR":    "olá",
+		"pt-PT":    "hello",
+		"fr":       "hello",
+	}
+	for locale, want := range tests {
+		c, err := set.Render(Event{Kind: "greet", Locale: locale}, "text")
+		if err != nil || c.Text != want {
+			t.Errorf("locale %q: Render = %q, %v; want %q", locale, c.Text, err, want)
+		}
+	}
+}
+
+func TestRenderEmailEscapesHTML(t *testing.T) {
+	set := loadTestTemplates(t, map[string]string{
+		"deploy.subject.tmpl": "{{.Data.Service}}\n  deployed",
+		"deploy.html.tmpl":    `<p>{{.Data.Author}}</p>`,
+		"deploy.text.tmpl":    `{{.Data.Author}}`,
+	})
+	e := Event{Kind: "deploy", Data: DeployEvent{Service: "api", Author: `Ada <ada@example.com> & "co"`}}
+	c, err := set.Render(e, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "api deployed" {
+		t.Errorf("Subject = %q", c.Subject)
+	}
+	if c.HTML != "<p>Ada &lt;ada@example.com&gt; &amp; &#34;co&#34;</p>" {
+		t.Errorf("HTML = %q", c.HTML)
+	}
+	if c.Text != `Ada <ada@example.com> & "co"` {
+		t.Errorf("Text = %q; want it unescaped", c.Text)
+	}
+}
+
+func TestRenderSMSLimit(t *testing.T) {
+	set := loadTestTemplates(t, map[string]string{
+		"long.text.tmpl":  "{{.Data}}",
+		"short.sms.tmpl":  "short",
+		"short.text.tmpl": "this text is not used for SMS",
+	})
+	long := strings.Repeat("Ünïcödé  ", 40)
+	c, err := set.Render(Event{Kind: "long", Data: long}, "sms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := utf8.RuneCountInString(c.Text); n != SMSLimit || !strings.HasSuffix(c.Text, "…") || strings.Contains(c.Text, "  ") {
+		t.Errorf("SMS of %d runes: %q", n, c.Text)
+	}
+	if c, err := set.Render(Event{Kind: "short"}, "sms"); err != nil || c.Text != "short" {
+		t.Errorf("Render = %q, %v; want the sms template", c.Text, err)
+	}
+
+	exact := strings.Repeat("é", SMSLimit)
+	if got := FormatText("sms", exact).Text; got != exact {
+		t.Errorf("a message of exactly %d runes was cut to %q", SMSLimit, got)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	set := loadTestTemplates(t, map[string]string{
+		"deploy.text.tmpl": "{{.Data.Missing}}",
+		"note.text.tmpl":   "n",
+	})
+	if _, err := set.Render(Event{Kind: "nothing"}, "text"); !errors.Is(err, ErrNoTemplate) {
+		t.Errorf("unknown kind: error = %v; want ErrNoTemplate", err)
+	}
+	if _, err := set.Render(Event{Kind: "note"}, "email"); !errors.Is(err, ErrNoTemplate) {
+		t.Errorf("no subject: error = %v; want ErrNoTemplate", err)
+	}
+	if _, err := set.Render(Event{Kind: "deploy", Data: map[string]string{}}, "text"); err == nil || errors.Is(err, ErrNoTemplate) {
+		t.Errorf("missing key: error = %v; want an execution error", err)
+	}
+
+	f := NewFormattingDecorator(&contentRecorder{}, "text", set)
+	if err := f.Notify(context.Background(), Event{Kind: "nothing"}); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Notify = %v; want a permanent error", err)
+	}
+
+	if _, err := LoadTemplates(fstest.MapFS{"t/deploy.body.tmpl": {}}, "t"); err == nil {
+		t.Error("LoadTemplates accepted an unknown part")
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	email := FormatText("email", "\n  disk full on db-1\nsecond line")
+	if email.Subject != "disk full on db-1" {
+		t.Errorf("email subject = %q", email.Subject)
+	}
+	slack := FormatText("slack", "*title*\n---\n• one\n---\n")
+	var kinds []string
+	for _, b := range slack.Blocks {
+		kinds = append(kinds, b.Type)
+	}
+	if got := strings.Join(kinds, " "); got != "section divider section divider" || slack.Text != "*title*\n• one\n" {
+		t.Errorf("slack blocks %s, text %q", got, slack.Text)
+	}
+}
+
+// contentRecorder keeps the Content it was sent
+type contentRecorder struct {
+	got []Content
+}
+
+func (r *contentRecorder) Send(ctx context.Context, message string) error {
+	return r.SendContent(ctx, Content{Text: message})
+}
+
+func (r *contentRecorder) SendContent(_ context.Context, c Content) error {
+	r.got = append(r.got, c)
+	return nil
+}
+
+// The decorators between a FormattingDecorator and a rich channel must not
+// strip the subject, HTML or blocks
+func TestContentPassesThrough(t *testing.T) {
+	c := Content{Subject: "s", Text: "t", HTML: "<p>h</p>", Blocks: []SlackBlock{{Type: "divider"}}}
+	tests := map[string]func(n Notifier) Notifier{
+		"channel": func(n Notifier) Notifier { return NewChannelDecorator(n, &contentRecorder{}) },
+		"fanout":  func(n Notifier) Notifier { return &FanOutNotifier{Channels: []Channel{{"a", n}}} },
+		"dedup":   func(n Notifier) Notifier { return NewDedupDecorator(n, 0, nil) },
+		"retry":   func(n Notifier) Notifier { return NewRetryDecorator(n, RetryOptions{}) },
+	}
+	for name, wrap := range tests {
+		t.Run(name, func(t *testing.T) {
+			var rec contentRecorder
+			if err := sendContent(context.Background(), wrap(&rec), c); err != nil {
+				t.Fatal(err)
+			}
+			if len(rec.got) != 1 || rec.got[0].Subject != "s" || rec.got[0].HTML != c.HTML || len(rec.got[0].Blocks) != 1 {
+				t.Errorf("got %+v", rec.got)
+			}
+		})
+	}
+}
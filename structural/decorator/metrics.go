@@ -0,0 +1,325 @@
+package decorator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Metrics and tracing
+
+InstrumentedDecorator measures any Notifier without the Notifier knowing:
+it counts sends and failures per channel, records latency in a histogram
+and wraps every send in a trace span. Metrics serves what it has collected
+in the Prometheus text format, so it can be mounted on any HTTP mux. Spans
+go to a Tracer; SpanRecorder keeps them in memory for tests, and an adapter
+for a real tracing library only has to implement two small interfaces.
+*/
+
+// DefaultBuckets are the latency histogram bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds per-channel send statistics. It is safe for concurrent use
+// and is an http.Handler serving the Prometheus text format.
+type Metrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	channels map[string]*channelStats
+}
+
+type channelStats struct {
+	sends    uint64
+	failures uint64
+	counts   []uint64 // per bucket, not cumulative
+	sum      float64
+}
+
+// NewMetrics returns empty Metrics with the given histogram bounds in
+// seconds, or DefaultBuckets if there are none
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &Metrics{buckets: buckets, channels: map[string]*channelStats{}}
+}
+
+// Observe records one send on channel
+func (m *Metrics) Observe(channel string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.channels[channel]
+	if s == nil {
+		s = &channelStats{counts: make([]uint64, len(m.buckets))}
+		m.channels[channel] = s
+	}
+	s.sends++
+	if err != nil {
+		s.failures++
+	}
+	secs := d.Seconds()
+	s.sum += secs
+	if i, _ := slices.BinarySearch(m.buckets, secs); i < len(m.buckets) {
+		s.counts[i]++
+	}
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := slices.Sorted(maps.Keys(m.channels))
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	fmt.Fprintln(cw, "# HELP notifier_sends_total Messages handed to a channel.")
+	fmt.Fprintln(cw, "# TYPE notifier_sends_total counter")
+	for _, name := range names {
+		fmt.Fprintf(cw, "notifier_sends_total{channel=%s} %d\n", labelValue(name), m.channels[name].sends)
+	}
+	fmt.Fprintln(cw, "# HELP notifier_send_failures_total Sends that returned an error.")
+	fmt.Fprintln(cw, "# TYPE notifier_send_failures_total counter")
+	for _, name := range names {
+		fmt.Fprintf(cw, "notifier_send_failures_total{channel=%s} %d\n", labelValue(name), m.channels[name].failures)
+	}
+	fmt.Fprintln(cw, "# HELP notifier_send_duration_seconds Time taken by a send.")
+	fmt.Fprintln(cw, "# TYPE notifier_send_duration_seconds histogram")
+	for _, name := range names {
+		s, label := m.channels[name], labelValue(name)
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(cw, "notifier_send_duration_seconds_bucket{channel=%s,le=\"%s\"} %d\n", label, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(cw, "notifier_send_duration_seconds_bucket{channel=%s,le=\"+Inf\"} %d\n", label, s.sends)
+		fmt.Fprintf(cw, "notifier_send_duration_seconds_sum{channel=%s} %s\n", label, formatFloat(s.sum))
+		fmt.Fprintf(cw, "notifier_send_duration_seconds_count{channel=%s} %d\n", label, s.sends)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// countingWriter keeps the byte count and first error for WriteTo
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// labelValue quotes a label value with the escapes the text format allows
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Tracer starts spans. A span started from a context that carries another
+// span is its child.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one traced operation
+type Span interface {
+	SetAttribute(key, value string)
+	// End finishes the span, recording err if it is not nil
+	End(err error)
+}
+
+// RecordedSpan is a finished span kept by a SpanRecorder
+type RecordedSpan struct {
+	ID       int
+	ParentID int // 0 for a root span
+	Name     string
+	Attrs    map[string]string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// SpanRecorder is a Tracer that keeps finished spans in memory
+type SpanRecorder struct {
+	Clock Clock
+
+	mu     sync.Mutex
+	nextID int
+	spans  []RecordedSpan
+}
+
+type spanKey struct{}
+
+type recordingSpan struct {
+	rec  *SpanRecorder
+	span RecordedSpan
+	once sync.Once
+}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	r.mu.Lock()
+	r.nextID++
+	s := &recordingSpan{rec: r, span: RecordedSpan{ID: r.nextID, Name: name, Attrs: map[string]string{}, Start: orSystem(r.Clock).Now()}}
+	r.mu.Unlock()
+	if parent, ok := ctx.Value(spanKey{}).(*recordingSpan); ok {
+		s.span.ParentID = parent.span.ID
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the finished spans in the order they ended
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.spans)
+}
+
+func (s *recordingSpan) SetAttribute(key, value string) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.span.Attrs[key] = value
+}
+
+func (s *recordingSpan) End(err error) {
+	s.once.Do(func() {
+		r := s.rec
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		s.span.Duration = orSystem(r.Clock).Now().Sub(s.span.Start)
+		s.span.Err = err
+		span := s.span
+		span.Attrs = maps.Clone(span.Attrs)
+		r.spans = append(r.spans, span)
+	})
+}
+
+// InstrumentedDecorator records metrics and a trace span for every send.
+// Metrics and Tracer may each be nil.
+type InstrumentedDecorator struct {
+	NotifierDecorator
+	Channel string
+	Metrics *Metrics
+	Tracer  Tracer
+	Clock   Clock
+}
+
+// NewInstrumentedDecorator wraps n, reporting it as channel and timing
+// sends on clock (nil for the system clock)
+func NewInstrumentedDecorator(n Notifier, channel string, metrics *Metrics, tracer Tracer, clock Clock) *InstrumentedDecorator {
+	return &InstrumentedDecorator{NotifierDecorator{wrapped: n}, channel, metrics, tracer, orSystem(clock)}
+}
+
+func (d *InstrumentedDecorator) Send(ctx context.Context, message string) error {
+	return d.do(ctx, len(message), func(ctx context.Context) error { return d.NotifierDecorator.Send(ctx, message) })
+}
+
+func (d *InstrumentedDecorator) SendContent(ctx context.Context, c Content) error {
+	return d.do(ctx, len(c.Text), func(ctx context.Context) error { return sendContent(ctx, d.wrapped, c) })
+}
+
+func (d *InstrumentedDecorator) do(ctx context.Context, length int, send func(ctx context.Context) error) error {
+	var span Span
+	if d.Tracer != nil {
+		ctx, span = d.Tracer.Start(ctx, "notify "+d.Channel)
+		span.SetAttribute("channel", d.Channel)
+		span.SetAttribute("message.length", strconv.Itoa(length))
+	}
+	clock := orSystem(d.Clock)
+	start := clock.Now()
+	err := send(ctx)
+	if d.Metrics != nil {
+		d.Metrics.Observe(d.Channel, clock.Now().Sub(start), err)
+	}
+	if span != nil {
+		span.End(err)
+	}
+	return err
+}
+
+// sleepyNotifier takes Latency on Clock and fails every Nth send
+type sleepyNotifier struct {
+	Latency time.Duration
+	FailNth int
+	Clock   Clock
+	sends   int
+}
+
+func (s *sleepyNotifier) Send(ctx context.Context, message string) error {
+	s.sends++
+	if err := s.Clock.Sleep(ctx, s.Latency); err != nil {
+		return err
+	}
+	if s.FailNth > 0 && s.sends%s.FailNth == 0 {
+		return errors.New("503 service unavailable")
+	}
+	return nil
+}
+
+// Usage
+func ExecuteMetrics() {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	metrics := NewMetrics(0.1, 0.5, 1)
+	tracer := &SpanRecorder{Clock: clock}
+
+	instrument := func(n Notifier, channel string) Notifier {
+		return NewInstrumentedDecorator(n, channel, metrics, tracer, clock)
+	}
+	email := instrument(&sleepyNotifier{Latency: 300 * time.Millisecond, Clock: clock}, "email")
+	sms := instrument(&sleepyNotifier{Latency: 50 * time.Millisecond, FailNth: 2, Clock: clock}, "sms")
+	both := instrument(NewChannelDecorator(email, sms), "all")
+
+	for _, msg := range []string{"deploy started", "deploy finished"} {
+		if err := both.Send(ctx, msg); err != nil {
+			fmt.Println("send failed:", err)
+		}
+	}
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if strings.Contains(line, `"sms"`) || strings.HasPrefix(line, "# TYPE") {
+			fmt.Println(line)
+		}
+	}
+
+	for _, s := range tracer.Spans() {
+		fmt.Printf("span %d (parent %d) %-12s %v err=%v\n", s.ID, s.ParentID, s.Name, s.Duration, s.Err)
+	}
+}
@@ -0,0 +1,137 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics(0.5, 0.25) // sorted by NewMetrics
+	odd := "a\"b\\c\nd"
+	failed := errors.New("503")
+	m.Observe(odd, 125*time.Millisecond, nil)
+	m.Observe(odd, 250*time.Millisecond, nil) // on a bound: counted in it
+	m.Observe(odd, 500*time.Millisecond, failed)
+	m.Observe(odd, 2*time.Second, failed) // past every bound: only in +Inf
+	m.Observe("b", 0, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := `# HELP notifier_sends_total Messages handed to a channel.
+# TYPE notifier_sends_total counter
+notifier_sends_total{channel="a\"b\\c\nd"} 4
+notifier_sends_total{channel="b"} 1
+# HELP notifier_send_failures_total Sends that returned an error.
+# TYPE notifier_send_failures_total counter
+notifier_send_failures_total{channel="a\"b\\c\nd"} 2
+notifier_send_failures_total{channel="b"} 0
+# HELP notifier_send_duration_seconds Time taken by a send.
+# TYPE notifier_send_duration_seconds histogram
+notifier_send_duration_seconds_bucket{channel="a\"b\\c\nd",le="0.25"} 2
+notifier_send_duration_seconds_bucket{channel="a\"b\\c\nd",le="0.5"} 3
+notifier_send_duration_seconds_bucket{channel="a\"b\\c\nd",le="+Inf"} 4
+notifier_send_duration_seconds_sum{channel="a\"b\\c\nd"} 2.875
+notifier_send_duration_seconds_count{channel="a\"b\\c\nd"} 4
+notifier_send_duration_seconds_bucket{channel="b",le="0.25"} 1
+notifier_send_duration_seconds_bucket{channel="b",le="0.5"} 1
+notifier_send_duration_seconds_bucket{channel="b",le="+Inf"} 1
+notifier_send_duration_seconds_sum{channel="b"} 0
+notifier_send_duration_seconds_count{channel="b"} 1
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+
+	var b strings.Builder
+	if n, err := m.WriteTo(&b); err != nil || n != int64(len(want)) {
+		t.Errorf("WriteTo = %d, %v; want %d bytes", n, err, len(want))
+	}
+}
+
+func TestInstrumentedDecorator(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(testStart)
+	metrics := NewMetrics(0.1, 1)
+	tracer := &SpanRecorder{Clock: clock}
+	email := NewInstrumentedDecorator(&sleepyNotifier{Latency: 300 * time.Millisecond, Clock: clock}, "email", metrics, tracer, clock)
+	sms := NewInstrumentedDecorator(&sleepyNotifier{Latency: 50 * time.Millisecond, FailNth: 1, Clock: clock}, "sms", metrics, tracer, clock)
+	all := NewInstrumentedDecorator(NewChannelDecorator(email, sms), "all", metrics, tracer, clock)
+
+	if err := all.Send(ctx, "deploy"); err == nil {
+		t.Fatal("Send succeeded; sms always fails")
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("%d spans; want 3", len(spans))
+	}
+	// Spans are kept in the order they ended: children first
+	want := []struct {
+		id, parent int
+		name       string
+		d          time.Duration
+		failed     bool
+	}{
+		{2, 1, "notify email", 300 * time.Millisecond, false},
+		{3, 1, "notify sms", 50 * time.Millisecond, true},
+		{1, 0, "notify all", 350 * time.Millisecond, true},
+	}
+	for i, w := range want {
+		s := spans[i]
+		if s.ID != w.id || s.ParentID != w.parent || s.Name != w.name || s.Duration != w.d || (s.Err != nil) != w.failed {
+			t.Errorf("span %d = %+v; want id %d, parent %d, %s, %v, failed %t", i, s, w.id, w.parent, w.name, w.d, w.failed)
+		}
+	}
+	if attrs := map[string]string{"channel": "email", "message.length": "6"}; !maps.Equal(spans[0].Attrs, attrs) {
+		t.Errorf("attributes %v; want %v", spans[0].Attrs, attrs)
+	}
+
+	// Failures are counted, and timed, like successes
+	for name, want := range map[string][2]uint64{"email": {1, 0}, "sms": {1, 1}, "all": {1, 1}} {
+		s := metrics.channels[name]
+		if s == nil || s.sends != want[0] || s.failures != want[1] {
+			t.Errorf("%s: %+v; want %d sends, %d failures", name, s, want[0], want[1])
+		}
+	}
+	if s := metrics.channels["sms"]; s.sum != 0.05 || s.counts[0] != 1 {
+		t.Errorf("sms latency: sum %v, buckets %v; want 0.05 in the first", s.sum, s.counts)
+	}
+
+	// Without metrics or a tracer the decorator only passes the send on
+	bare := NewInstrumentedDecorator(notifierFunc(func(context.Context, string) error { return nil }), "bare", nil, nil, nil)
+	if err := bare.Send(ctx, "hi"); err != nil || bare.Clock != SystemClock {
+		t.Errorf("Send = %v with clock %v; want nil and the system clock", err, bare.Clock)
+	}
+}
+
+func TestSpanRecorder(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	r := &SpanRecorder{Clock: clock}
+	ctx, root := r.Start(context.Background(), "root")
+	_, child := r.Start(ctx, "child")
+	child.SetAttribute("k", "v")
+	clock.Advance(time.Second)
+	child.End(nil)
+	child.SetAttribute("late", "ignored")
+	child.End(errors.New("ended twice"))
+	root.End(nil)
+
+	spans := r.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans; want 2", len(spans))
+	}
+	if c := spans[0]; c.Name != "child" || c.ParentID != 1 || c.Duration != time.Second || c.Err != nil || len(c.Attrs) != 1 {
+		t.Errorf("child = %+v; want parent 1, 1s, one attribute and the first End's error", c)
+	}
+	if p := spans[1]; p.Name != "root" || p.ID != 1 || p.ParentID != 0 || !p.Start.Equal(testStart) {
+		t.Errorf("root = %+v", p)
+	}
+}
@@ -0,0 +1,88 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+Rate limiting
+
+RateLimitDecorator lets Rate messages through per second on average, with
+bursts of up to Burst, using a token bucket. A send that finds the bucket
+empty waits for its token, or fails with ErrRateLimited when Reject is set.
+*/
+
+var ErrRateLimited = errors.New("decorator: rate limited")
+
+// RateLimitDecorator limits how often the wrapped Notifier is called
+type RateLimitDecorator struct {
+	NotifierDecorator
+	// Rate is the number of sends allowed per second
+	Rate  float64
+	Burst int
+	// Reject fails sends that would have to wait instead of waiting
+	Reject bool
+	Clock  Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitDecorator allows rate sends per second with bursts of burst
+// (at least 1); clock may be nil
+func NewRateLimitDecorator(n Notifier, rate float64, burst int, clock Clock) *RateLimitDecorator {
+	burst = max(burst, 1)
+	clock = orSystem(clock)
+	return &RateLimitDecorator{
+		NotifierDecorator: NotifierDecorator{wrapped: n},
+		Rate:              rate, Burst: burst, Clock: clock,
+		tokens: float64(burst), last: clock.Now(),
+	}
+}
+
+func (r *RateLimitDecorator) Send(ctx context.Context, message string) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.NotifierDecorator.Send(ctx, message)
+}
+
+func (r *RateLimitDecorator) SendContent(ctx context.Context, c Content) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return sendContent(ctx, r.wrapped, c)
+}
+
+// wait takes a token, sleeping until one is due if the bucket is empty. A
+// waiting send reserves its token up front so later sends queue behind it.
+func (r *RateLimitDecorator) wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := r.Clock.Now()
+	r.tokens = min(float64(r.Burst), r.tokens+now.Sub(r.last).Seconds()*r.Rate)
+	r.last = now
+	if r.tokens >= 1 {
+		r.tokens--
+		r.mu.Unlock()
+		return nil
+	}
+	if r.Reject || r.Rate <= 0 {
+		r.mu.Unlock()
+		return ErrRateLimited
+	}
+	delay := time.Duration((1 - r.tokens) / r.Rate * float64(time.Second))
+	r.tokens--
+	r.mu.Unlock()
+
+	if err := r.Clock.Sleep(ctx, delay); err != nil {
+		r.mu.Lock()
+		r.tokens++
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
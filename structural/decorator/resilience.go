@@ -0,0 +1,430 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+Resilience decorators
+
+RetryDecorator, TimeoutDecorator and CircuitBreakerDecorator wrap any
+Notifier and are Notifiers themselves, so they stack in any order. The usual
+stack puts the timeout innermost (so it limits each attempt), retries
+around it, and a circuit breaker outside to stop hammering a channel that is
+down. All of them take a Clock so they can run on a FakeClock.
+*/
+
+var (
+	ErrAttemptTimeout = errors.New("decorator: attempt timed out")
+	ErrCircuitOpen    = errors.New("decorator: circuit open")
+	ErrPermanent      = errors.New("decorator: permanent failure")
+)
+
+// Permanent marks err as not worth retrying and not the channel's fault,
+// for example a malformed message
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// RetryOptions configures a RetryDecorator; zero fields take the defaults
+type RetryOptions struct {
+	// Attempts is the total number of tries, 3 by default
+	Attempts int
+	// BaseDelay is the wait before the second try, 100ms by default; each
+	// further wait is Multiplier (2 by default) times longer, up to MaxDelay
+	// (an hour by default)
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	// Jitter spreads each wait randomly by up to this fraction either way,
+	// so clients that failed together do not retry together
+	Jitter float64
+	// Retryable decides whether an error is worth another try; by default
+	// everything except Permanent errors is
+	Retryable func(err error) bool
+	Clock     Clock
+	// Rand returns numbers in [0, 1) for the jitter; math/rand by default
+	Rand func() float64
+}
+
+// RetryDecorator retries failed sends with exponential backoff
+type RetryDecorator struct {
+	NotifierDecorator
+	RetryOptions
+}
+
+// NewRetryDecorator wraps n with retries
+func NewRetryDecorator(n Notifier, opts RetryOptions) *RetryDecorator {
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 100 * time.Millisecond
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 2
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = func(err error) bool { return !errors.Is(err, ErrPermanent) }
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.Float64
+	}
+	opts.Clock = orSystem(opts.Clock)
+	return &RetryDecorator{NotifierDecorator{wrapped: n}, opts}
+}
+
+// defaultMaxDelay caps the backoff when MaxDelay is unset. Without a cap
+// enough attempts grow the wait past what a Duration can hold.
+const defaultMaxDelay = time.Hour
+
+// Delay returns the wait after the given failed attempt (1 for the first)
+func (r *RetryDecorator) Delay(attempt int) time.Duration {
+	limit := r.MaxDelay
+	if limit <= 0 {
+		limit = defaultMaxDelay
+	}
+	d := math.Min(float64(r.BaseDelay)*math.Pow(r.Multiplier, float64(attempt-1)), float64(limit))
+	if r.Jitter > 0 {
+		d *= 1 + r.Jitter*(2*r.Rand()-1)
+	}
+	if d >= math.MaxInt64 {
+		// Only a jitter far above 1 gets here
+		return math.MaxInt64
+	}
+	return time.Duration(max(d, 0))
+}
+
+func (r *RetryDecorator) Send(ctx context.Context, message string) error {
+	return r.do(ctx, func(ctx context.Context) error { return r.NotifierDecorator.Send(ctx, message) })
+}
+
+func (r *RetryDecorator) SendContent(ctx context.Context, c Content) error {
+	return r.do(ctx, func(ctx context.Context) error { return sendContent(ctx, r.wrapped, c) })
+}
+
+func (r *RetryDecorator) do(ctx context.Context, send func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := send(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.Attempts || !r.Retryable(err) || ctx.Err() != nil {
+			return fmt.Errorf("decorator: gave up after %d attempts: %w", attempt, err)
+		}
+		if serr := r.Clock.Sleep(ctx, r.Delay(attempt)); serr != nil {
+			return fmt.Errorf("decorator: gave up after %d attempts: %w", attempt, errors.Join(err, serr))
+		}
+	}
+}
+
+// TimeoutDecorator cancels a send that takes longer than Timeout. The send
+// runs on its own goroutine, so the caller gets control back on time even if
+// the wrapped Notifier ignores its context. A send given up on that is still
+// running holds back the next send through the decorator until it returns,
+// within the next send's own timeout, so a retry never overlaps the attempt
+// it replaces.
+type TimeoutDecorator struct {
+	NotifierDecorator
+	Timeout time.Duration
+	Clock   Clock
+
+	mu sync.Mutex
+	// abandoned holds the done channels of sends that timed out
+	abandoned []chan struct{}
+}
+
+// NewTimeoutDecorator wraps n with a per-send timeout; a timeout <= 0 means
+// 30s and clock may be nil
+func NewTimeoutDecorator(n Notifier, timeout time.Duration, clock Clock) *TimeoutDecorator {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &TimeoutDecorator{NotifierDecorator: NotifierDecorator{wrapped: n}, Timeout: timeout, Clock: orSystem(clock)}
+}
+
+func (t *TimeoutDecorator) Send(ctx context.Context, message string) error {
+	return t.do(ctx, func(ctx context.Context) error { return t.NotifierDecorator.Send(ctx, message) })
+}
+
+func (t *TimeoutDecorator) SendContent(ctx context.Context, c Content) error {
+	return t.do(ctx, func(ctx context.Context) error { return sendContent(ctx, t.wrapped, c) })
+}
+
+func (t *TimeoutDecorator) do(ctx context.Context, send func(ctx context.Context) error) error {
+	if t.Timeout <= 0 {
+		return fmt.Errorf("decorator: timeout %v must be positive", t.Timeout)
+	}
+	attempt, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := orSystem(t.Clock).AfterFunc(t.Timeout, func() { cancel(ErrAttemptTimeout) })
+	defer stop()
+
+	err := t.waitAbandoned(attempt)
+	if err == nil {
+		finished := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			defer close(finished)
+			done <- send(attempt)
+		}()
+		select {
+		case err = <-done:
+		case <-attempt.Done():
+			err = attempt.Err()
+			t.mu.Lock()
+			t.abandoned = append(t.abandoned, finished)
+			t.mu.Unlock()
+		}
+	}
+	if err != nil && errors.Is(context.Cause(attempt), ErrAttemptTimeout) {
+		return fmt.Errorf("%w after %v", ErrAttemptTimeout, t.Timeout)
+	}
+	return err
+}
+
+// waitAbandoned waits for the sends that timed out earlier to return
+func (t *TimeoutDecorator) waitAbandoned(ctx context.Context) error {
+	t.mu.Lock()
+	pending := slices.Clone(t.abandoned)
+	t.mu.Unlock()
+	for _, finished := range pending {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	t.mu.Lock()
+	t.abandoned = slices.DeleteFunc(t.abandoned, func(c chan struct{}) bool { return slices.Contains(pending, c) })
+	t.mu.Unlock()
+	return nil
+}
+
+// BreakerState is the state of a CircuitBreakerDecorator
+type BreakerState int
+
+const (
+	// StateClosed lets every send through
+	StateClosed BreakerState = iota
+	// StateOpen fails every send with ErrCircuitOpen until the cool-down ends
+	StateOpen
+	// StateHalfOpen lets one probe through at a time to test the channel
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerOptions configures a CircuitBreakerDecorator; zero fields take the
+// defaults
+type BreakerOptions struct {
+	// FailureThreshold consecutive failures open the circuit, 5 by default
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open, 30s by default
+	Cooldown time.Duration
+	// HalfOpenSuccesses successful probes close the circuit, 1 by default
+	HalfOpenSuccesses int
+	Clock             Clock
+	// OnStateChange, if set, is called on every transition, with the breaker
+	// locked, so it must not call back into it
+	OnStateChange func(from, to BreakerState)
+}
+
+// CircuitBreakerDecorator stops calling a Notifier that keeps failing and
+// probes it again after a cool-down. Permanent errors and cancellations by
+// the caller are not counted as failures, and neither is the result of a
+// send that started before the last change of state.
+type CircuitBreakerDecorator struct {
+	NotifierDecorator
+	BreakerOptions
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	probing   bool
+	openedAt  time.Time
+	// generation counts state changes
+	generation int
+}
+
+// NewCircuitBreakerDecorator wraps n with a circuit breaker
+func NewCircuitBreakerDecorator(n Notifier, opts BreakerOptions) *CircuitBreakerDecorator {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	if opts.HalfOpenSuccesses <= 0 {
+		opts.HalfOpenSuccesses = 1
+	}
+	opts.Clock = orSystem(opts.Clock)
+	return &CircuitBreakerDecorator{NotifierDecorator: NotifierDecorator{wrapped: n}, BreakerOptions: opts}
+}
+
+// State returns the current state
+func (b *CircuitBreakerDecorator) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkCooldown()
+	return b.state
+}
+
+func (b *CircuitBreakerDecorator) Send(ctx context.Context, message string) error {
+	return b.do(ctx, func(ctx context.Context) error { return b.NotifierDecorator.Send(ctx, message) })
+}
+
+func (b *CircuitBreakerDecorator) SendContent(ctx context.Context, c Content) error {
+	return b.do(ctx, func(ctx context.Context) error { return sendContent(ctx, b.wrapped, c) })
+}
+
+func (b *CircuitBreakerDecorator) do(ctx context.Context, send func(ctx context.Context) error) error {
+	b.mu.Lock()
+	b.checkCooldown()
+	if b.state == StateOpen || (b.state == StateHalfOpen && b.probing) {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	probe := b.state == StateHalfOpen
+	b.probing = probe
+	generation := b.generation
+	b.mu.Unlock()
+
+	err := send(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if generation != b.generation {
+		// The verdict on the channel was reached without this send
+		return err
+	}
+	switch {
+	case err == nil:
+		b.failures = 0
+		if probe {
+			b.successes++
+			if b.successes >= b.HalfOpenSuccesses {
+				b.setState(StateClosed)
+			}
+		}
+	case errors.Is(err, ErrPermanent) || ctx.Err() != nil:
+		// Not the channel's fault
+	default:
+		b.failures++
+		if probe || b.failures >= b.FailureThreshold {
+			b.openedAt = b.Clock.Now()
+			b.setState(StateOpen)
+		}
+	}
+	return err
+}
+
+// checkCooldown moves an open circuit to half-open once the cool-down is
+// over; b.mu must be held
+func (b *CircuitBreakerDecorator) checkCooldown() {
+	if b.state == StateOpen && b.Clock.Now().Sub(b.openedAt) >= b.Cooldown {
+		b.setState(StateHalfOpen)
+	}
+}
+
+// setState records a transition; b.mu must be held
+func (b *CircuitBreakerDecorator) setState(s BreakerState) {
+	if s == b.state {
+		return
+	}
+	from := b.state
+	b.state = s
+	b.generation++
+	b.failures, b.successes = 0, 0
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, s)
+	}
+}
+
+// flakyNotifier fails its first Failures sends and takes Latency per send
+type flakyNotifier struct {
+	Name     string
+	Failures int
+	Latency  time.Duration
+	Clock    Clock
+	start    time.Time
+	calls    int
+}
+
+func (f *flakyNotifier) Send(ctx context.Context, message string) error {
+	f.calls++
+	at := f.Clock.Now().Sub(f.start)
+	if f.Latency > 0 {
+		if err := f.Clock.Sleep(ctx, f.Latency); err != nil {
+			fmt.Printf("  %s attempt %d at +%v: cancelled\n", f.Name, f.calls, at)
+			return err
+		}
+	}
+	if f.calls <= f.Failures {
+		fmt.Printf("  %s attempt %d at +%v: 421 try again later\n", f.Name, f.calls, at)
+		return errors.New(f.Name + ": 421 try again later")
+	}
+	fmt.Printf("  %s attempt %d at +%v: sent %q\n", f.Name, f.calls, at, message)
+	return nil
+}
+
+// Usage
+func ExecuteResilience() {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	// Two failures, then success: waits of 100ms and 200ms (the fixed Rand
+	// puts the jitter in the middle of its range)
+	clock := NewFakeClock(start)
+	flaky := &flakyNotifier{Name: "email", Failures: 2, Clock: clock, start: start}
+	retry := NewRetryDecorator(flaky, RetryOptions{
+		Attempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second,
+		Jitter: 0.2, Clock: clock, Rand: func() float64 { return 0.5 },
+	})
+	fmt.Println("retry:", retry.Send(ctx, "deploy finished"))
+
+	// Every attempt is slower than the timeout
+	clock = NewFakeClock(start)
+	slow := &flakyNotifier{Name: "sms", Latency: 3 * time.Second, Clock: clock, start: start}
+	stack := NewRetryDecorator(NewTimeoutDecorator(slow, time.Second, clock), RetryOptions{Attempts: 2, Clock: clock})
+	fmt.Println("timeout:", stack.Send(ctx, "disk almost full"))
+
+	// A channel that is down trips the breaker, which then fails fast until
+	// the cool-down is over and a probe succeeds
+	clock = NewFakeClock(start)
+	down := &flakyNotifier{Name: "slack", Failures: 3, Clock: clock, start: start}
+	breaker := NewCircuitBreakerDecorator(down, BreakerOptions{
+		FailureThreshold: 3, Cooldown: 30 * time.Second, Clock: clock,
+		OnStateChange: func(from, to BreakerState) {
+			fmt.Printf("  breaker %v -> %v at +%v\n", from, to, clock.Now().Sub(start))
+		},
+	})
+	for range 5 {
+		if err := breaker.Send(ctx, "build failed"); errors.Is(err, ErrCircuitOpen) {
+			fmt.Println("  rejected:", err)
+		}
+	}
+	clock.Advance(30 * time.Second)
+	fmt.Println("breaker:", breaker.Send(ctx, "build fixed"), breaker.State())
+}
@@ -0,0 +1,300 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// notifierFunc adapts a function to Notifier; the tests share it
+type notifierFunc func(ctx context.Context, message string) error
+
+func (f notifierFunc) Send(ctx context.Context, message string) error { return f(ctx, message) }
+
+var errBusy = errors.New("421 try again later")
+
+// failing fails its first n sends
+func failing(n int, calls *atomic.Int32) Notifier {
+	return notifierFunc(func(context.Context, string) error {
+		if calls.Add(1) <= int32(n) {
+			return errBusy
+		}
+		return nil
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var calls atomic.Int32
+	r := NewRetryDecorator(failing(3, &calls), RetryOptions{
+		Attempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond, Clock: clock,
+	})
+	if err := r.Send(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("%d calls; want 4", calls.Load())
+	}
+	// 100ms + 200ms + 300ms (capped)
+	if got := clock.Now().Sub(testStart); got != 600*time.Millisecond {
+		t.Errorf("waited %v; want 600ms", got)
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	r := NewRetryDecorator(nil, RetryOptions{BaseDelay: time.Second, Jitter: 0.5, Rand: func() float64 { return 0 }})
+	if got := r.Delay(2); got != time.Second {
+		t.Errorf("Delay(2) with the lowest jitter = %v; want 1s", got)
+	}
+	r.Rand = func() float64 { return 0.999999 }
+	if got := r.Delay(1); got < 1499*time.Millisecond || got > 1500*time.Millisecond {
+		t.Errorf("Delay(1) with the highest jitter = %v; want about 1.5s", got)
+	}
+}
+
+// Without a MaxDelay the wait stops growing at the default cap instead of
+// overflowing into a negative Duration
+func TestRetryDelayCap(t *testing.T) {
+	r := NewRetryDecorator(nil, RetryOptions{BaseDelay: time.Second, Multiplier: 10})
+	for _, attempt := range []int{5, 20, 100, 10000} {
+		if got := r.Delay(attempt); got != defaultMaxDelay {
+			t.Errorf("Delay(%d) = %v; want %v", attempt, got, defaultMaxDelay)
+		}
+	}
+	r.MaxDelay = 10 * time.Minute
+	if got := r.Delay(100); got != r.MaxDelay {
+		t.Errorf("Delay(100) = %v; want MaxDelay", got)
+	}
+	r.Jitter, r.Rand = 1e300, func() float64 { return 0.999 }
+	if got := r.Delay(100); got != math.MaxInt64 {
+		t.Errorf("Delay with an absurd jitter = %v; want the longest Duration", got)
+	}
+	r.Rand = func() float64 { return 0 }
+	if got := r.Delay(100); got != 0 {
+		t.Errorf("Delay with an absurd jitter down = %v; want 0", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var calls atomic.Int32
+	r := NewRetryDecorator(failing(10, &calls), RetryOptions{Attempts: 3, Clock: clock})
+	if err := r.Send(context.Background(), "hi"); !errors.Is(err, errBusy) || calls.Load() != 3 {
+		t.Errorf("Send = %v after %d calls; want errBusy after 3", err, calls.Load())
+	}
+
+	calls.Store(0)
+	permanent := NewRetryDecorator(notifierFunc(func(context.Context, string) error {
+		calls.Add(1)
+		return Permanent(errors.New("bad address"))
+	}), RetryOptions{Clock: clock})
+	if err := permanent.Send(context.Background(), "hi"); !errors.Is(err, ErrPermanent) || calls.Load() != 1 {
+		t.Errorf("Send = %v after %d calls; want one permanent failure", err, calls.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls.Store(0)
+	cancelling := NewRetryDecorator(notifierFunc(func(context.Context, string) error {
+		calls.Add(1)
+		cancel()
+		return errBusy
+	}), RetryOptions{Clock: clock})
+	if err := cancelling.Send(ctx, "hi"); !errors.Is(err, errBusy) || calls.Load() != 1 {
+		t.Errorf("Send = %v after %d calls; want to stop once the context is cancelled", err, calls.Load())
+	}
+}
+
+func TestTimeoutDefault(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if got := NewTimeoutDecorator(nil, timeout, nil).Timeout; got != 30*time.Second {
+			t.Errorf("NewTimeoutDecorator(%v).Timeout = %v; want 30s", timeout, got)
+		}
+	}
+	var calls atomic.Int32
+	literal := &TimeoutDecorator{NotifierDecorator: NotifierDecorator{wrapped: failing(0, &calls)}}
+	if err := literal.Send(context.Background(), "hi"); err == nil || calls.Load() != 0 {
+		t.Errorf("zero Timeout: Send = %v after %d calls; want an error and no send", err, calls.Load())
+	}
+}
+
+func TestTimeoutFires(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	slow := notifierFunc(func(ctx context.Context, _ string) error { return clock.Sleep(ctx, 3*time.Second) })
+	td := NewTimeoutDecorator(slow, time.Second, clock)
+	if err := td.Send(context.Background(), "hi"); !errors.Is(err, ErrAttemptTimeout) {
+		t.Errorf("Send = %v; want ErrAttemptTimeout", err)
+	}
+	if got := clock.Now().Sub(testStart); got != time.Second {
+		t.Errorf("gave up at +%v; want +1s", got)
+	}
+
+	fast := NewTimeoutDecorator(failing(1, new(atomic.Int32)), time.Second, clock)
+	if err := fast.Send(context.Background(), "hi"); !errors.Is(err, errBusy) {
+		t.Errorf("Send = %v; want the notifier's own error", err)
+	}
+}
+
+// A send that ignores its context keeps running after the timeout; the next
+// send must not start until it has returned
+func TestTimeoutNoOverlap(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var inFlight, most atomic.Int32
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	stubborn := notifierFunc(func(context.Context, string) error {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if n > most.Load() {
+			most.Store(n)
+		}
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	td := NewTimeoutDecorator(stubborn, time.Second, clock)
+	ctx := context.Background()
+
+	first := make(chan error)
+	go func() { first <- td.Send(ctx, "first") }()
+	<-started
+	clock.Advance(time.Second)
+	if err := <-first; !errors.Is(err, ErrAttemptTimeout) {
+		t.Fatalf("first Send = %v; want ErrAttemptTimeout", err)
+	}
+
+	// The second send gives up in its own time if the first never returns
+	second := make(chan error)
+	go func() { second <- td.Send(ctx, "second") }()
+	waitForTimers(t, clock, 1)
+	clock.Advance(time.Second)
+	if err := <-second; !errors.Is(err, ErrAttemptTimeout) {
+		t.Fatalf("second Send = %v; want ErrAttemptTimeout while the first is stuck", err)
+	}
+
+	// Once the first returns, the next send goes through
+	third := make(chan error)
+	go func() { third <- td.Send(ctx, "third") }()
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	if err := <-third; err != nil {
+		t.Fatal(err)
+	}
+	if most.Load() != 1 {
+		t.Errorf("%d sends ran at once; want 1", most.Load())
+	}
+}
+
+// waitForTimers waits until n timers are pending on the fake clock
+func waitForTimers(t *testing.T, c *FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		pending := len(c.timers)
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers pending; want %d", pending, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var calls atomic.Int32
+	var transitions []string
+	b := NewCircuitBreakerDecorator(failing(4, &calls), BreakerOptions{
+		FailureThreshold: 3, Cooldown: 30 * time.Second, Clock: clock,
+		OnStateChange: func(from, to BreakerState) { transitions = append(transitions, from.String()+">"+to.String()) },
+	})
+	ctx := context.Background()
+	for range 3 {
+		b.Send(ctx, "hi")
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("state after 3 failures = %v; want open", b.State())
+	}
+	if err := b.Send(ctx, "hi"); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 3 {
+		t.Errorf("open breaker: Send = %v after %d calls; want ErrCircuitOpen without a call", err, calls.Load())
+	}
+
+	// A failed probe opens the circuit again for a full cool-down
+	clock.Advance(30 * time.Second)
+	if err := b.Send(ctx, "probe"); !errors.Is(err, errBusy) || b.State() != StateOpen {
+		t.Errorf("failed probe: Send = %v, state %v; want errBusy and open", err, b.State())
+	}
+	clock.Advance(29 * time.Second)
+	if b.State() != StateOpen {
+		t.Errorf("state 29s after reopening = %v; want open", b.State())
+	}
+	clock.Advance(time.Second)
+	if err := b.Send(ctx, "probe"); err != nil || b.State() != StateClosed {
+		t.Errorf("good probe: Send = %v, state %v; want closed", err, b.State())
+	}
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions %v; want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transitions %v; want %v", transitions, want)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerIgnores(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	send := func(context.Context, string) error { return Permanent(errors.New("bad message")) }
+	b := NewCircuitBreakerDecorator(notifierFunc(func(ctx context.Context, m string) error { return send(ctx, m) }),
+		BreakerOptions{FailureThreshold: 1, Clock: clock})
+	if b.Send(context.Background(), "hi"); b.State() != StateClosed {
+		t.Errorf("a permanent error opened the circuit")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	send = func(ctx context.Context, _ string) error { return ctx.Err() }
+	if b.Send(ctx, "hi"); b.State() != StateClosed {
+		t.Errorf("the caller's cancellation opened the circuit")
+	}
+}
+
+// A send that started while the circuit was closed and fails after it has
+// gone half-open must not decide the probe's outcome
+func TestCircuitBreakerStaleResult(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var slowFirst atomic.Bool
+	slowFirst.Store(true)
+	b := NewCircuitBreakerDecorator(notifierFunc(func(context.Context, string) error {
+		if slowFirst.CompareAndSwap(true, false) {
+			close(started)
+			<-release
+		}
+		return errBusy
+	}), BreakerOptions{FailureThreshold: 1, Cooldown: time.Minute, Clock: clock})
+
+	stale := make(chan error)
+	go func() { stale <- b.Send(context.Background(), "slow") }()
+	<-started
+	b.Send(context.Background(), "fails") // opens the circuit
+	clock.Advance(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("state = %v; want half-open", b.State())
+	}
+	close(release)
+	<-stale
+	if b.State() != StateHalfOpen {
+		t.Errorf("a send from before the circuit opened moved it to %v", b.State())
+	}
+}
@@ -0,0 +1,494 @@
+package decorator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+/*
+Stream decorators
+
+The classic decorators: io.Writers that wrap io.Writers and io.Readers that
+wrap io.Readers, each adding one thing. A StreamLayer pairs the writing and
+reading side of one feature: buffering, gzip, AES-GCM encryption, a SHA-256
+checksum or progress reporting. Stack applies layers to a writer and
+Unstack undoes them on a reader; any order works as long as both use the
+same one. Closing a stacked writer finishes every layer (flushing buffers,
+writing trailers) but leaves the destination open.
+
+Encryption works in chunks so neither side has to hold the whole stream.
+Every chunk's nonce carries its position and whether it is the last one, so
+reordered, dropped or truncated chunks fail to decrypt.
+*/
+
+var (
+	ErrChecksumMismatch = errors.New("decorator: checksum mismatch")
+	ErrDecrypt          = errors.New("decorator: stream cannot be decrypted")
+	ErrTruncated        = errors.New("decorator: stream truncated")
+)
+
+// StreamLayer is one feature applied to a stream on the way out and removed
+// on the way back in. Writer wraps the next writer down the stack, and
+// closing what it returns closes w as well.
+type StreamLayer struct {
+	Name   string
+	Writer func(w io.WriteCloser) (io.WriteCloser, error)
+	Reader func(r io.Reader) (io.Reader, error)
+}
+
+// Stack wraps dst in layers, layers[0] outermost: what is written goes
+// through layers[0] first. Close finishes every layer but not dst.
+func Stack(dst io.Writer, layers ...StreamLayer) (io.WriteCloser, error) {
+	var w io.WriteCloser = nopWriteCloser{dst}
+	for i := len(layers) - 1; i >= 0; i-- {
+		next, err := layers[i].Writer(w)
+		if err != nil {
+			return nil, fmt.Errorf("decorator: %s: %w", layers[i].Name, err)
+		}
+		w = next
+	}
+	return w, nil
+}
+
+// Unstack reads what Stack wrote with the same layers in the same order
+func Unstack(src io.Reader, layers ...StreamLayer) (io.Reader, error) {
+	r := src
+	for i := len(layers) - 1; i >= 0; i-- {
+		next, err := layers[i].Reader(r)
+		if err != nil {
+			return nil, fmt.Errorf("decorator: %s: %w", layers[i].Name, err)
+		}
+		r = next
+	}
+	return r, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// closeInner closes w; every layer's Close ends with it so closing the
+// outermost writer closes them all
+func closeInner(err error, w io.WriteCloser) error {
+	return errors.Join(err, w.Close())
+}
+
+// BufferLayer buffers size bytes on both sides
+func BufferLayer(size int) StreamLayer {
+	return StreamLayer{
+		Name: "buffer",
+		Writer: func(w io.WriteCloser) (io.WriteCloser, error) {
+			return &bufferedWriter{bufio.NewWriterSize(w, size), w}, nil
+		},
+		Reader: func(r io.Reader) (io.Reader, error) {
+			return bufio.NewReaderSize(r, size), nil
+		},
+	}
+}
+
+type bufferedWriter struct {
+	*bufio.Writer
+	inner io.WriteCloser
+}
+
+func (b *bufferedWriter) Close() error {
+	return closeInner(b.Flush(), b.inner)
+}
+
+// GzipLayer compresses at level, for example gzip.BestSpeed
+func GzipLayer(level int) StreamLayer {
+	return StreamLayer{
+		Name: "gzip",
+		Writer: func(w io.WriteCloser) (io.WriteCloser, error) {
+			gz, err := gzip.NewWriterLevel(w, level)
+			if err != nil {
+				return nil, err
+			}
+			return &gzipWriter{gz, w}, nil
+		},
+		Reader: func(r io.Reader) (io.Reader, error) {
+			// Reading the header needs data, so open the gzip reader on first use
+			return &lazyReader{open: func() (io.Reader, error) { return gzip.NewReader(r) }}, nil
+		},
+	}
+}
+
+type gzipWriter struct {
+	*gzip.Writer
+	inner io.WriteCloser
+}
+
+func (g *gzipWriter) Close() error {
+	return closeInner(g.Writer.Close(), g.inner)
+}
+
+// lazyReader opens its reader on the first Read
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
+
+// EncryptChunkSize is the plaintext size of every chunk but the last
+const EncryptChunkSize = 64 << 10
+
+// EncryptLayer encrypts with AES-GCM under key, which must be 16, 24 or 32
+// bytes. The stream starts with a random nonce prefix; every chunk is its
+// length followed by the sealed chunk.
+func EncryptLayer(key []byte) StreamLayer {
+	newAEAD := func() (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+	return StreamLayer{
+		Name: "encrypt",
+		Writer: func(w io.WriteCloser) (io.WriteCloser, error) {
+			aead, err := newAEAD()
+			if err != nil {
+				return nil, err
+			}
+			e := &encryptWriter{aead: aead, inner: w}
+			if _, err := rand.Read(e.prefix[:]); err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(e.prefix[:]); err != nil {
+				return nil, err
+			}
+			return e, nil
+		},
+		Reader: func(r io.Reader) (io.Reader, error) {
+			aead, err := newAEAD()
+			if err != nil {
+				return nil, err
+			}
+			return &decryptReader{aead: aead, r: r}, nil
+		},
+	}
+}
+
+// chunkNonce is the 7-byte stream prefix, the chunk counter and a last-chunk flag
+func chunkNonce(prefix [7]byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint32(nonce[7:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	aead    cipher.AEAD
+	inner   io.WriteCloser
+	prefix  [7]byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, ErrClosed
+	}
+	e.buf = append(e.buf, p...)
+	// A full chunk is only sealed once more data shows it is not the last
+	for len(e.buf) > EncryptChunkSize {
+		if err := e.seal(e.buf[:EncryptChunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[EncryptChunkSize:]
+	}
+	return len(p), nil
+}
+
+func (e *encryptWriter) seal(chunk []byte, last bool) error {
+	if e.counter == ^uint32(0) {
+		return errors.New("decorator: stream too long to encrypt")
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), chunk, nil)
+	e.counter++
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(sealed)))
+	if _, err := e.inner.Write(n[:]); err != nil {
+		return err
+	}
+	_, err := e.inner.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	err := e.seal(e.buf, true)
+	e.buf = nil
+	return closeInner(err, e.inner)
+}
+
+type decryptReader struct {
+	aead    cipher.AEAD
+	r       io.Reader
+	prefix  [7]byte
+	started bool
+	counter uint32
+	plain   []byte
+	done    bool
+	err     error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and opens one chunk
+func (d *decryptReader) next() error {
+	if !d.started {
+		if _, err := io.ReadFull(d.r, d.prefix[:]); err != nil {
+			return fmt.Errorf("%w: %v", ErrTruncated, err)
+		}
+		d.started = true
+	}
+	var n [4]byte
+	if _, err := io.ReadFull(d.r, n[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size < uint32(d.aead.Overhead()) || size > EncryptChunkSize+uint32(d.aead.Overhead()) {
+		return fmt.Errorf("%w: bad chunk length %d", ErrDecrypt, size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	// Try as a middle chunk, then as the last one
+	for _, last := range []bool{false, true} {
+		plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter, last), sealed, nil)
+		if err != nil {
+			continue
+		}
+		if last {
+			// The final chunk must end the stream, or bytes were appended
+			var extra [1]byte
+			if n, err := io.ReadFull(d.r, extra[:]); n > 0 {
+				return fmt.Errorf("%w: data after the final chunk", ErrDecrypt)
+			} else if err != io.EOF {
+				return err
+			}
+		}
+		d.counter++
+		d.plain, d.done = plain, last
+		return nil
+	}
+	return fmt.Errorf("%w: chunk %d", ErrDecrypt, d.counter)
+}
+
+// ChecksumLayer appends the SHA-256 of the stream when writing and checks
+// it when reading; a mismatch is reported instead of io.EOF
+func ChecksumLayer() StreamLayer {
+	return StreamLayer{
+		Name: "sha256",
+		Writer: func(w io.WriteCloser) (io.WriteCloser, error) {
+			return &checksumWriter{h: sha256.New(), inner: w}, nil
+		},
+		Reader: func(r io.Reader) (io.Reader, error) {
+			return &checksumReader{h: sha256.New(), r: r}, nil
+		},
+	}
+}
+
+type checksumWriter struct {
+	h      hash.Hash
+	inner  io.WriteCloser
+	closed bool
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	if c.closed {
+		return 0, ErrClosed
+	}
+	n, err := c.inner.Write(p)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+func (c *checksumWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	_, err := c.inner.Write(c.h.Sum(nil))
+	return closeInner(err, c.inner)
+}
+
+// checksumReader holds back the last sha256.Size bytes it has seen, since
+// they may be the trailer, and checks them at the end of the stream
+type checksumReader struct {
+	h    hash.Hash
+	r    io.Reader
+	held []byte
+	eof  bool
+	err  error
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	for {
+		if len(c.held) > sha256.Size {
+			n := copy(p, c.held[:len(c.held)-sha256.Size])
+			c.h.Write(p[:n])
+			c.held = c.held[n:]
+			return n, nil
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.eof {
+			switch {
+			case len(c.held) < sha256.Size:
+				c.err = fmt.Errorf("%w: no checksum", ErrTruncated)
+			case !bytes.Equal(c.held, c.h.Sum(nil)):
+				c.err = ErrChecksumMismatch
+			default:
+				c.err = io.EOF
+			}
+			c.held = nil
+			continue
+		}
+		buf := make([]byte, max(len(p), 4096))
+		n, err := c.r.Read(buf)
+		c.held = append(c.held, buf[:n]...)
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			c.err = err
+		}
+	}
+}
+
+// ProgressLayer calls report with the running byte count after every
+// write and read at its position in the stack
+func ProgressLayer(report func(n int64)) StreamLayer {
+	return StreamLayer{
+		Name: "progress",
+		Writer: func(w io.WriteCloser) (io.WriteCloser, error) {
+			return &progressWriter{inner: w, report: report}, nil
+		},
+		Reader: func(r io.Reader) (io.Reader, error) {
+			return &progressReader{r: r, report: report}, nil
+		},
+	}
+}
+
+type progressWriter struct {
+	inner  io.WriteCloser
+	report func(int64)
+	n      int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.inner.Write(b)
+	p.n += int64(n)
+	p.report(p.n)
+	return n, err
+}
+
+func (p *progressWriter) Close() error {
+	return p.inner.Close()
+}
+
+type progressReader struct {
+	r      io.Reader
+	report func(int64)
+	n      int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.report(p.n)
+	}
+	return n, err
+}
+
+// Usage
+func ExecuteStreams() {
+	key := sha256.Sum256([]byte("example key, use a real one"))
+	var written, read int64
+	layers := []StreamLayer{
+		ProgressLayer(func(n int64) { written = n }),
+		GzipLayer(gzip.BestSpeed),
+		EncryptLayer(key[:]),
+		ChecksumLayer(),
+		BufferLayer(4096),
+	}
+
+	report := strings.Repeat("timestamp,service,latency_ms\n2024-01-01T09:00:00Z,checkout,42\n", 2000)
+	var stored bytes.Buffer
+	w, err := Stack(&stored, layers...)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := io.WriteString(w, report); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("wrote %d bytes as %d\n", written, stored.Len())
+
+	layers[0] = ProgressLayer(func(n int64) { read = n })
+	r, err := Unstack(bytes.NewReader(stored.Bytes()), layers...)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	back, err := io.ReadAll(r)
+	fmt.Printf("read %d bytes back, identical: %t, err: %v\n", read, string(back) == report, err)
+
+	// Flip one bit in the middle of the stored stream
+	tampered := bytes.Clone(stored.Bytes())
+	tampered[len(tampered)/2] ^= 1
+	if r, err = Unstack(bytes.NewReader(tampered), layers...); err == nil {
+		_, err = io.ReadAll(r)
+	}
+	fmt.Println("tampered:", err)
+}
@@ -0,0 +1,225 @@
+package decorator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"strings"
+	"testing"
+)
+
+var streamKey = sha256.Sum256([]byte("test key"))
+
+func streamLayers() []StreamLayer {
+	return []StreamLayer{
+		ProgressLayer(func(int64) {}),
+		GzipLayer(gzip.BestSpeed),
+		EncryptLayer(streamKey[:]),
+		ChecksumLayer(),
+		BufferLayer(4096),
+	}
+}
+
+// permute calls fn with every ordering of layers
+func permute(layers []StreamLayer, fn func([]StreamLayer)) {
+	order := append([]StreamLayer(nil), layers...)
+	var rec func(k int)
+	rec = func(k int) {
+		if k == len(order) {
+			fn(order)
+			return
+		}
+		for i := k; i < len(order); i++ {
+			order[k], order[i] = order[i], order[k]
+			rec(k + 1)
+			order[k], order[i] = order[i], order[k]
+		}
+	}
+	rec(0)
+}
+
+// streamData is half noise and half something to compress
+func streamData(size int, rng *mrand.Rand) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		if rng.IntN(2) == 0 {
+			data[i] = byte(rng.IntN(256))
+		} else {
+			data[i] = "0123456789"[i%10]
+		}
+	}
+	return data
+}
+
+// roundTrip writes data through layers and reads it back, both in pieces of
+// random size
+func roundTrip(data []byte, layers []StreamLayer, rng *mrand.Rand) error {
+	var stored bytes.Buffer
+	w, err := Stack(&stored, layers...)
+	if err != nil {
+		return err
+	}
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 1+rng.IntN(20000))
+		if _, err := w.Write(rest[:n]); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	r, err := Unstack(&stored, layers...)
+	if err != nil {
+		return err
+	}
+	var got []byte
+	buf := make([]byte, 20000)
+	for {
+		n, err := r.Read(buf[:1+rng.IntN(len(buf))])
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("read back %d bytes that differ from the %d written", len(got), len(data))
+	}
+	return nil
+}
+
+func layerNames(layers []StreamLayer) string {
+	names := make([]string, len(layers))
+	for i, l := range layers {
+		names[i] = l.Name
+	}
+	return strings.Join(names, "+")
+}
+
+// Every order of the layers must give back exactly what was written, at the
+// sizes around the buffer and encryption chunk boundaries
+func TestStreamLayerOrders(t *testing.T) {
+	sizes := []int{0, 1, 4095, EncryptChunkSize, EncryptChunkSize + 1, 150_000}
+	if testing.Short() {
+		sizes = []int{0, 1, EncryptChunkSize + 1}
+	}
+	rng := mrand.New(mrand.NewPCG(1, 2))
+	permute(streamLayers(), func(order []StreamLayer) {
+		for _, size := range sizes {
+			if err := roundTrip(streamData(size, rng), order, rng); err != nil {
+				t.Errorf("%s with %d bytes: %v", layerNames(order), size, err)
+			}
+		}
+	})
+}
+
+func FuzzStreamLayers(f *testing.F) {
+	var orders [][]StreamLayer
+	permute(streamLayers(), func(order []StreamLayer) { orders = append(orders, append([]StreamLayer(nil), order...)) })
+	f.Add([]byte("hello"), uint8(0), uint64(1))
+	f.Add([]byte{}, uint8(7), uint64(2))
+	f.Add(bytes.Repeat([]byte("0123456789"), 7000), uint8(119), uint64(3))
+	f.Fuzz(func(t *testing.T, data []byte, order uint8, seed uint64) {
+		layers := orders[int(order)%len(orders)]
+		if err := roundTrip(data, layers, mrand.New(mrand.NewPCG(seed, seed))); err != nil {
+			t.Errorf("%s with %d bytes: %v", layerNames(layers), len(data), err)
+		}
+	})
+}
+
+// Each layer's writer also works on its own
+func TestStreamLayerWriterAlone(t *testing.T) {
+	for _, l := range streamLayers() {
+		var out bytes.Buffer
+		w, err := l.Writer(nopWriteCloser{&out})
+		if err != nil {
+			t.Fatalf("%s: %v", l.Name, err)
+		}
+		if _, err := io.WriteString(w, "data"); err != nil {
+			t.Errorf("%s: Write: %v", l.Name, err)
+		}
+		if err := w.Close(); err != nil || out.Len() == 0 {
+			t.Errorf("%s: Close = %v with %d bytes out", l.Name, err, out.Len())
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	var stored bytes.Buffer
+	w, err := Stack(&stored, EncryptLayer(streamKey[:]), ChecksumLayer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(bytes.Repeat([]byte("x"), 2*EncryptChunkSize+10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(data []byte, layers ...StreamLayer) error {
+		r, err := Unstack(bytes.NewReader(data), layers...)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+	good := stored.Bytes()
+	flipped := bytes.Clone(good)
+	flipped[len(flipped)/2] ^= 1
+
+	tests := []struct {
+		name   string
+		data   []byte
+		layers []StreamLayer
+		want   error
+	}{
+		{"flipped bit", flipped, []StreamLayer{EncryptLayer(streamKey[:]), ChecksumLayer()}, ErrDecrypt},
+		{"flipped bit, checksum only", flipped, []StreamLayer{ChecksumLayer()}, ErrChecksumMismatch},
+		{"truncated", good[:len(good)-sha256.Size-5], []StreamLayer{EncryptLayer(streamKey[:]), ChecksumLayer()}, ErrTruncated},
+		{"no checksum", good[:10], []StreamLayer{ChecksumLayer()}, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := read(tt.data, tt.layers...); !errors.Is(err, tt.want) {
+				t.Errorf("read = %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Bytes after the final chunk were not written by the encrypter
+	var sealed bytes.Buffer
+	w, err = Stack(&sealed, EncryptLayer(streamKey[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "short message"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(sealed.Bytes(), EncryptLayer(streamKey[:])); err != nil {
+		t.Fatalf("read of the untouched stream = %v", err)
+	}
+	appended := append(bytes.Clone(sealed.Bytes()), "junk"...)
+	if err := read(appended, EncryptLayer(streamKey[:])); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("data after the final chunk: read = %v; want ErrDecrypt", err)
+	}
+
+	other := sha256.Sum256([]byte("other key"))
+	if err := read(good, EncryptLayer(other[:]), ChecksumLayer()); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong key: read = %v; want ErrDecrypt", err)
+	}
+	if _, err := Stack(io.Discard, EncryptLayer([]byte("short"))); err == nil {
+		t.Error("Stack accepted a 5-byte key")
+	}
+}
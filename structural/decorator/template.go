@@ -0,0 +1,44 @@
+package decorator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+/*
+Templates
+
+TemplateDecorator rewrites every message through a text/template before
+passing it on, for example to add an environment prefix or a footer. The
+template sees the original text as .Message.
+*/
+
+// TemplateData is what a TemplateDecorator's template is executed with
+type TemplateData struct {
+	Message string
+}
+
+// TemplateDecorator formats each message with Template
+type TemplateDecorator struct {
+	NotifierDecorator
+	Template *template.Template
+}
+
+// NewTemplateDecorator parses text and wraps n with it
+func NewTemplateDecorator(n Notifier, text string) (*TemplateDecorator, error) {
+	t, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("decorator: %w", err)
+	}
+	return &TemplateDecorator{NotifierDecorator{wrapped: n}, t}, nil
+}
+
+func (d *TemplateDecorator) Send(ctx context.Context, message string) error {
+	var b strings.Builder
+	if err := d.Template.Execute(&b, TemplateData{Message: message}); err != nil {
+		return Permanent(fmt.Errorf("decorator: %w", err))
+	}
+	return d.NotifierDecorator.Send(ctx, b.String())
+}